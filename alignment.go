@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// labelledToken a sanitized word and a label of its segment, e.g. its speaker or its language, with the timing
+// of its word and the index of its segment
+type labelledToken struct {
+	token string
+	label string
+
+	segment     int
+	startTimeMs int32
+	stopTimeMs  int32
+}
+
+// labelledTokens the sanitized words of the asset, the way sclite saw them, labelled by their segment.
+// labelled is false when no segment has a label.
+func labelledTokens(asset *api.Asset, labelOf func(api.TranscriptSegment) string) (tokens []labelledToken, labelled bool) {
+	for i, segment := range asset.Segments {
+		label := labelOf(segment)
+		labelled = labelled || label != ""
+		for _, w := range asset.Words[segment.FirstWord : segment.FirstWord+segment.WordCount] {
+			for _, token := range strings.Fields(sanitize(w.Word)) {
+				tokens = append(tokens, labelledToken{
+					token:       token,
+					label:       label,
+					segment:     i,
+					startTimeMs: w.StartTimeMs,
+					stopTimeMs:  w.StopTimeMs,
+				})
+			}
+		}
+	}
+	return tokens, labelled
+}
+
+// alignedPair a step of the sclite alignment, with the index of its reference and hypothesis tokens,
+// -1 for the missing side of a deletion or an insertion
+type alignedPair struct {
+	action string
+	ref    int
+	hyp    int
+}
+
+// pairAlignment map the sclite alignment to the reference and hypothesis tokens. It returns nil when the
+// alignment does not match the tokens.
+func pairAlignment(reference, hypothesis []labelledToken, alignment []word) []alignedPair {
+	pairs := make([]alignedPair, 0, len(alignment))
+	var r, h int
+	for _, aligned := range alignment {
+		pair := alignedPair{action: aligned.Action, ref: -1, hyp: -1}
+		if aligned.Action != "I" {
+			if r >= len(reference) || !strings.EqualFold(reference[r].token, aligned.Reference) {
+				return nil
+			}
+			pair.ref = r
+			r++
+		}
+		if aligned.Action != "D" {
+			if h >= len(hypothesis) || !strings.EqualFold(hypothesis[h].token, aligned.Hypothesis) {
+				return nil
+			}
+			pair.hyp = h
+			h++
+		}
+		pairs = append(pairs, pair)
+	}
+	if r != len(reference) || h != len(hypothesis) {
+		return nil
+	}
+	return pairs
+}
+
+// indexLabels index the distinct labels of the tokens
+func indexLabels(tokens []labelledToken) map[string]int {
+	labels := make(map[string]int)
+	for _, t := range tokens {
+		if _, ok := labels[t.label]; !ok {
+			labels[t.label] = len(labels)
+		}
+	}
+	return labels
+}
@@ -1,12 +1,16 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/veritone/graphql"
@@ -19,8 +23,37 @@ const (
 
 	tokenKey            contextKey = "token"
 	correllationIDField            = "Veritone-Correlation-ID"
+
+	// assetFragment the asset fields needed to benchmark an asset. The output itself is downloaded with OpenAssetContent.
+	assetFragment = `
+		fragment assetFields on Asset {
+			id
+			createdDateTime
+			modifiedDateTime
+			contentType
+			signedUri
+			container {
+				id
+			}
+			sourceData {
+				taskId
+				engine {
+					name
+					id
+					deployedVersion
+					categoryId
+				}
+			}
+		}
+	`
+
+	// jsonContentType the content type of the VTN-standard outputs, which are read as stored
+	jsonContentType = "application/json"
 )
 
+// contentHTTPClient downloads the signed URIs of assets, which carry their own authorization
+var contentHTTPClient = &http.Client{Timeout: 5 * time.Minute}
+
 // Options some options for graphql
 type Options struct {
 	VeritoneAPIBaseURL string `json:"veritoneApiBaseUrl"`
@@ -30,15 +63,54 @@ type Options struct {
 	TimeoutDurationStr string `json:"timeoutDurationStr"`
 	Debug              bool   `json:"debug"`
 	InstanceID         string `json:"instanceId"`
+	// Observer is notified of every request and retry, e.g. to export metrics
+	Observer Observer `json:"-"`
+	// Logger receives the retry lines and, with Debug, the request traces. The standard logger is used without one.
+	Logger Logger `json:"-"`
+	// CorrelationID the Veritone-Correlation-ID header value, e.g. the one logged by the caller. Without one it is
+	// CorrelationID(InstanceID).
+	CorrelationID string `json:"-"`
+}
+
+// Logger receives the lines of the client with the context of the request, when there is one, so that they can carry
+// its fields
+type Logger interface {
+	Debugf(ctx context.Context, format string, args ...interface{})
+	Warnf(ctx context.Context, format string, args ...interface{})
+}
+
+// stdLogger writes the lines of the client to the standard logger
+type stdLogger struct{}
+
+func (stdLogger) Debugf(ctx context.Context, format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
+func (stdLogger) Warnf(ctx context.Context, format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
+
+// Observer receives the timing of every GraphQL round trip and every retry
+type Observer interface {
+	ObserveRequest(duration time.Duration, err error)
+	ObserveRetry(attempt int)
 }
 
 type contextKey string
 
-func beforeRetryHandler(req *http.Request, resp *http.Response, err error, num int) {
-	if err != nil {
-		log.Printf("Retrying (attempt %d) after err: %s -- response: %+v", num, err, resp)
-	} else {
-		log.Printf("Retrying (attempt %d) after status: %s -- response: %+v", num, resp.Status, resp)
+func newBeforeRetryHandler(observer Observer, logger Logger) func(req *http.Request, resp *http.Response, err error, num int) {
+	return func(req *http.Request, resp *http.Response, err error, num int) {
+		if observer != nil {
+			observer.ObserveRetry(num)
+		}
+		ctx := context.Background()
+		if req != nil {
+			ctx = req.Context()
+		}
+		if err != nil {
+			logger.Warnf(ctx, "Retrying (attempt %d) after err: %s -- response: %+v", num, err, resp)
+		} else {
+			logger.Warnf(ctx, "Retrying (attempt %d) after status: %s -- response: %+v", num, resp.Status, resp)
+		}
 	}
 }
 
@@ -61,6 +133,17 @@ func ToPlainString(c interface{}) string {
 // PlatformGraphQLClient the client
 type PlatformGraphQLClient struct {
 	*graphql.Client
+	// endpoint, httpClient and headers send the requests whose errors must be told apart, see runWithErrors
+	endpoint   string
+	httpClient *http.Client
+	headers    map[string]string
+}
+
+// responseError an entry of the errors of a GraphQL response. Path starts with the field, or its alias, the error
+// belongs to.
+type responseError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path"`
 }
 
 func (options *Options) defaults() {
@@ -79,56 +162,109 @@ func NewCoreAPI(config Options) (*PlatformGraphQLClient, error) {
 		return nil, fmt.Errorf("Missing connection info")
 	}
 	config.defaults()
+	logger := config.Logger
+	if logger == nil {
+		logger = stdLogger{}
+	}
 	timeoutDur, err := time.ParseDuration(config.TimeoutDurationStr)
 	if err != nil {
 		return nil, fmt.Errorf(`invalid timeout given "%s": %s`, config.TimeoutDurationStr, err)
 	}
 
 	endpoint := config.VeritoneAPIBaseURL + config.GraphQLEndpoint
+	correlationID := config.CorrelationID
+	if correlationID == "" {
+		correlationID = CorrelationID(config.InstanceID)
+	}
+	headers := getDefaultHeaders(correlationID)
+	httpClient := newAuthHTTPClient(config.Token, timeoutDur, config.Observer)
 	cl := graphql.NewClient(endpoint,
 		graphql.UseMultipartForm(),
-		graphql.WithDefaultHeaders(getDefaultHeaders(config.InstanceID)),
+		graphql.WithDefaultHeaders(headers),
 		graphql.WithDefaultExponentialRetryConfig(),
-		withAuthHeader(config.Token, timeoutDur),
-		graphql.WithBeforeRetryHandler(beforeRetryHandler))
+		graphql.WithHTTPClient(httpClient),
+		graphql.WithBeforeRetryHandler(newBeforeRetryHandler(config.Observer, logger)))
 
 	if config.Debug {
-		cl.Log = func(s string) { log.Println(s) }
+		// the client traces carry no request context
+		cl.Log = func(s string) { logger.Debugf(context.Background(), "%s", s) }
 	}
 
-	return &PlatformGraphQLClient{Client: cl}, nil
+	return &PlatformGraphQLClient{Client: cl, endpoint: endpoint, httpClient: httpClient, headers: headers}, nil
 }
 
-func getDefaultHeaders(alternativeHost string) map[string]string {
+func getDefaultHeaders(correlationID string) map[string]string {
 	defaultHeaders := make(map[string]string)
+	defaultHeaders[correllationIDField] = correlationID
+	return defaultHeaders
+}
+
+// CorrelationID the Veritone-Correlation-ID header value sent with every request: the host name, or the
+// alternative host if the host name is unavailable
+func CorrelationID(alternativeHost string) string {
 	hostName, err := os.Hostname()
 	if err != nil {
 		log.Printf("Error getting host name: %s", err)
-		hostName = alternativeHost
+		return alternativeHost
 	}
-	log.Printf("hostName: %s", hostName)
-
-	defaultHeaders[correllationIDField] = hostName
-	return defaultHeaders
+	return hostName
 }
 
-func withAuthHeader(token string, timeout time.Duration) graphql.ClientOption {
+func newAuthHTTPClient(token string, timeout time.Duration, observer Observer) *http.Client {
 	tr := &authHTTPTransport{
 		Transport: &http.Transport{},
 		token:     token,
+		observer:  observer,
 	}
 
-	client := &http.Client{
+	return &http.Client{
 		Transport: tr,
 		Timeout:   timeout,
 	}
+}
+
+// runWithErrors send the query once and decode its data into resp. Unlike Run, which keeps only the first message,
+// it returns every error of the response with its path. The returned error is set when the request itself failed.
+func (c *PlatformGraphQLClient) runWithErrors(ctx context.Context, query string, variables map[string]interface{}, resp interface{}) ([]responseError, error) {
+	if c.httpClient == nil {
+		return nil, fmt.Errorf("the client has no HTTP client")
+	}
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+	for key, value := range c.headers {
+		httpReq.Header.Set(key, value)
+	}
+	httpResp, err := c.httpClient.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
 
-	return graphql.WithHTTPClient(client)
+	gqlResp := struct {
+		Data   interface{}     `json:"data"`
+		Errors []responseError `json:"errors"`
+	}{Data: resp}
+	if err := json.NewDecoder(httpResp.Body).Decode(&gqlResp); err != nil {
+		return nil, fmt.Errorf("failed to decode the response, status %s: %s", httpResp.Status, err)
+	}
+	if httpResp.StatusCode != http.StatusOK && len(gqlResp.Errors) == 0 {
+		return nil, fmt.Errorf("unexpected status %s", httpResp.Status)
+	}
+	return gqlResp.Errors, nil
 }
 
 type authHTTPTransport struct {
 	*http.Transport
-	token string
+	token    string
+	observer Observer
 }
 
 func (t *authHTTPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -141,10 +277,17 @@ func (t *authHTTPTransport) RoundTrip(req *http.Request) (*http.Response, error)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+token)
-	return t.Transport.RoundTrip(req)
+	if t.observer == nil {
+		return t.Transport.RoundTrip(req)
+	}
+
+	start := time.Now()
+	resp, err := t.Transport.RoundTrip(req)
+	t.observer.ObserveRequest(time.Since(start), err)
+	return resp, err
 }
 
-// FetchTDOOutputs fetch the assets of the given asset type from the given tdo
+// FetchTDOOutputs fetch the IDs and sources of the assets of the given asset type from the given tdo, newest first
 func (c *PlatformGraphQLClient) FetchTDOOutputs(ctx context.Context, tdoID string, assetType string) (*TDO, error) {
 	if assetType == "" {
 		assetType = "vtn-standard"
@@ -159,11 +302,12 @@ func (c *PlatformGraphQLClient) FetchTDOOutputs(ctx context.Context, tdoID strin
 					records {
 						id
 						sourceData {
-							name
 							taskId
-							engineId
+							engine {
+								id
+								name
+							}
 						}
-						transform(transformFunction: JSON)
 					}
 				}
 			}
@@ -182,6 +326,48 @@ func (c *PlatformGraphQLClient) FetchTDOOutputs(ctx context.Context, tdoID strin
 	return resp.Result, c.Run(ctx, req, &resp)
 }
 
+// FetchTaskTimes fetch the start and stop times of the TDO and the timestamps of the given tasks in one aliased query.
+// The tasks are keyed by task ID, and those the response has are returned along with an error about the others.
+func (c *PlatformGraphQLClient) FetchTaskTimes(ctx context.Context, tdoID string, taskIDs []string) (*TDO, map[string]*Task, error) {
+	var vars, fields strings.Builder
+	for i := range taskIDs {
+		fmt.Fprintf(&vars, " $id%d: ID!", i)
+		fmt.Fprintf(&fields, " t%d: task(id: $id%d) { id status createdDateTime queuedDateTime startedDateTime completedDateTime }", i, i)
+	}
+	req := graphql.NewRequest("query ($tdoId: ID!" + vars.String() + ") { temporalDataObject(id: $tdoId) { id startDateTime stopDateTime }" + fields.String() + " }")
+	req.Var("tdoId", tdoID)
+	for i, taskID := range taskIDs {
+		req.Var(fmt.Sprintf("id%d", i), taskID)
+	}
+
+	resp := make(map[string]json.RawMessage, len(taskIDs)+1)
+	err := c.Run(ctx, req, &resp)
+	var tdo *TDO
+	if raw, ok := resp["temporalDataObject"]; ok {
+		if decodeErr := json.Unmarshal(raw, &tdo); decodeErr != nil && err == nil {
+			err = decodeErr
+		}
+	}
+	tasks := make(map[string]*Task, len(taskIDs))
+	for i, taskID := range taskIDs {
+		raw, ok := resp[fmt.Sprintf("t%d", i)]
+		if !ok {
+			continue
+		}
+		var task *Task
+		if decodeErr := json.Unmarshal(raw, &task); decodeErr != nil {
+			if err == nil {
+				err = decodeErr
+			}
+			continue
+		}
+		if task != nil {
+			tasks[taskID] = task
+		}
+	}
+	return tdo, tasks, err
+}
+
 // FetchEngineResults fetch the engine output
 func (c *PlatformGraphQLClient) FetchEngineResults(ctx context.Context, tdoID string, engineIDs []string) (*EngineResults, error) {
 	req := graphql.NewRequest(`
@@ -217,23 +403,10 @@ func (c *PlatformGraphQLClient) FetchAsset(ctx context.Context, assetID string)
 			$assetId: ID!
 		) {
 			asset(id: $assetId) {
-				id
-				container {
-					id
-				}
-				sourceData {
-					taskId
-					engine {
-						name
-						id
-						deployedVersion
-						categoryId
-					}
-				}
-				transform(transformFunction: JSON)
+				...assetFields
 			}
 		}
-	`)
+	` + assetFragment)
 
 	req.Var("assetId", assetID)
 
@@ -244,6 +417,97 @@ func (c *PlatformGraphQLClient) FetchAsset(ctx context.Context, assetID string)
 	return resp.Result, c.Run(ctx, req, &resp)
 }
 
+// FetchAssets fetch the assets with one aliased query per batch of batchSize assets.
+// It returns the fetched assets and the error of each asset that could not be fetched, both keyed by asset ID.
+func (c *PlatformGraphQLClient) FetchAssets(ctx context.Context, assetIDs []string, batchSize int) (map[string]*Asset, map[string]error) {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	assets := make(map[string]*Asset, len(assetIDs))
+	errs := make(map[string]error)
+	for start := 0; start < len(assetIDs); start += batchSize {
+		end := start + batchSize
+		if end > len(assetIDs) {
+			end = len(assetIDs)
+		}
+		c.fetchAssetBatch(ctx, assetIDs[start:end], assets, errs)
+	}
+	return assets, errs
+}
+
+func (c *PlatformGraphQLClient) fetchAssetBatch(ctx context.Context, assetIDs []string, assets map[string]*Asset, errs map[string]error) {
+	var vars, fields strings.Builder
+	variables := make(map[string]interface{}, len(assetIDs))
+	for i, assetID := range assetIDs {
+		fmt.Fprintf(&vars, " $id%d: ID!", i)
+		fmt.Fprintf(&fields, " a%d: asset(id: $id%d) { ...assetFields }", i, i)
+		variables[fmt.Sprintf("id%d", i)] = assetID
+	}
+	query := "query (" + vars.String() + ") {" + fields.String() + " }" + assetFragment
+
+	resp := make(map[string]*Asset, len(assetIDs))
+	responseErrs, batchErr := c.runWithErrors(ctx, query, variables, &resp)
+	if batchErr == nil {
+		for assetID, err := range assetErrors(assetIDs, resp, responseErrs) {
+			errs[assetID] = err
+		}
+		for i, assetID := range assetIDs {
+			if asset := resp[fmt.Sprintf("a%d", i)]; asset != nil && errs[assetID] == nil {
+				assets[assetID] = asset
+			}
+		}
+		return
+	}
+
+	for _, assetID := range assetIDs {
+		if ctx.Err() != nil {
+			errs[assetID] = batchErr
+			continue
+		}
+		// The batch request failed as a whole, fetch each asset alone, with the retries of the client
+		asset, err := c.FetchAsset(ctx, assetID)
+		if err == nil && asset == nil {
+			err = fmt.Errorf("asset %s not found", assetID)
+		}
+		if err != nil {
+			errs[assetID] = err
+			continue
+		}
+		assets[assetID] = asset
+	}
+}
+
+// assetErrors the error of each asset of a batch: the errors whose path starts with the alias of the asset, the
+// errors without a path when the asset is missing, or not found
+func assetErrors(assetIDs []string, resp map[string]*Asset, responseErrs []responseError) map[string]error {
+	messages := make(map[string][]string)
+	var unattributed []string
+	for _, e := range responseErrs {
+		if len(e.Path) > 0 {
+			if alias, ok := e.Path[0].(string); ok {
+				messages[alias] = append(messages[alias], e.Message)
+				continue
+			}
+		}
+		unattributed = append(unattributed, e.Message)
+	}
+
+	errs := make(map[string]error)
+	for i, assetID := range assetIDs {
+		alias := fmt.Sprintf("a%d", i)
+		switch {
+		case len(messages[alias]) > 0:
+			errs[assetID] = fmt.Errorf("graphql: %s", strings.Join(messages[alias], "; "))
+		case resp[alias] != nil:
+		case len(unattributed) > 0:
+			errs[assetID] = fmt.Errorf("graphql: %s", strings.Join(unattributed, "; "))
+		default:
+			errs[assetID] = fmt.Errorf("asset %s not found", assetID)
+		}
+	}
+	return errs
+}
+
 // FetchEngine fetch an engine
 func (c *PlatformGraphQLClient) FetchEngine(ctx context.Context, engineID string) (*Engine, error) {
 	req := graphql.NewRequest(`
@@ -308,6 +572,8 @@ func (c *PlatformGraphQLClient) FetchPublishedSchema(ctx context.Context, dataRe
 				publishedSchema {
 					id
 					status
+					majorVersion
+					definition
 					structuredDataObjects {
 						records {
 							id
@@ -332,6 +598,276 @@ func (c *PlatformGraphQLClient) FetchPublishedSchema(ctx context.Context, dataRe
 	return resp.Result, c.Run(ctx, req, &resp)
 }
 
+// FetchAssetContent download the content of an asset, e.g. a file uploaded to a library, from its signed URI
+func (c *PlatformGraphQLClient) FetchAssetContent(ctx context.Context, assetID string) ([]byte, error) {
+	req := graphql.NewRequest(`
+		query (
+			$assetId: ID!
+		) {
+			asset(id: $assetId) {
+				id
+				signedUri
+			}
+		}
+	`)
+
+	req.Var("assetId", assetID)
+
+	var resp struct {
+		Result *Asset `json:"asset"`
+	}
+	if err := c.Run(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Result == nil || resp.Result.SignedURI == "" {
+		return nil, fmt.Errorf("asset %s has no content", assetID)
+	}
+
+	body, err := downloadContent(ctx, assetID, resp.Result.SignedURI)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
+
+// OpenAssetContent open the engine output of an asset as VTN-standard JSON, for the caller to stream and close.
+// A JSON output is downloaded from its signed URI, the outputs in other formats are converted by the platform.
+func (c *PlatformGraphQLClient) OpenAssetContent(ctx context.Context, asset *Asset) (io.ReadCloser, error) {
+	if asset.SignedURI != "" && strings.HasPrefix(asset.ContentType, jsonContentType) {
+		return downloadContent(ctx, asset.ID, asset.SignedURI)
+	}
+
+	req := graphql.NewRequest(`
+		query (
+			$assetId: ID!
+		) {
+			asset(id: $assetId) {
+				transform(transformFunction: JSON)
+			}
+		}
+	`)
+
+	req.Var("assetId", asset.ID)
+
+	var resp struct {
+		Result *struct {
+			Transform string `json:"transform"`
+		} `json:"asset"`
+	}
+	if err := c.Run(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Result == nil {
+		return nil, fmt.Errorf("asset %s not found", asset.ID)
+	}
+	return ioutil.NopCloser(strings.NewReader(resp.Result.Transform)), nil
+}
+
+// downloadContent open the content at the signed URI of an asset
+func downloadContent(ctx context.Context, assetID, signedURI string) (io.ReadCloser, error) {
+	httpReq, err := http.NewRequest(http.MethodGet, signedURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpResp, err := contentHTTPClient.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download asset %s: %s", assetID, err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		httpResp.Body.Close()
+		return nil, fmt.Errorf("failed to download asset %s: %s", assetID, httpResp.Status)
+	}
+	return httpResp.Body, nil
+}
+
+// FetchSDOs get a page of the structured data objects of a schema matching the given filter
+func (c *PlatformGraphQLClient) FetchSDOs(ctx context.Context, schemaID string, filter map[string]interface{}, offset, limit int) (*SDORecords, error) {
+	req := graphql.NewRequest(`
+		query (
+			$schemaId: ID!
+			$filter: JSONData
+			$offset: Int
+			$limit: Int
+		) {
+			structuredDataObjects(schemaId: $schemaId, filter: $filter, offset: $offset, limit: $limit) {
+				records {
+					id
+					schemaId
+					createdDateTime
+					modifiedDateTime
+					data
+				}
+			}
+		}
+	`)
+
+	req.Var("schemaId", schemaID)
+	req.Var("filter", filter)
+	req.Var("offset", offset)
+	req.Var("limit", limit)
+
+	var resp struct {
+		Result *SDORecords `json:"structuredDataObjects"`
+	}
+
+	return resp.Result, c.Run(ctx, req, &resp)
+}
+
+// FetchSDO get a structured data object of a schema
+func (c *PlatformGraphQLClient) FetchSDO(ctx context.Context, sdoID, schemaID string) (*SDO, error) {
+	req := graphql.NewRequest(`
+		query (
+			$id: ID!
+			$schemaId: ID!
+		) {
+			structuredDataObject(id: $id, schemaId: $schemaId) {
+				id
+				schemaId
+				createdDateTime
+				modifiedDateTime
+				data
+			}
+		}
+	`)
+
+	req.Var("id", sdoID)
+	req.Var("schemaId", schemaID)
+
+	var resp struct {
+		Result *SDO `json:"structuredDataObject"`
+	}
+
+	return resp.Result, c.Run(ctx, req, &resp)
+}
+
+// FetchSchema fetch a schema version along with its definition
+func (c *PlatformGraphQLClient) FetchSchema(ctx context.Context, schemaID string) (*Schema, error) {
+	req := graphql.NewRequest(`
+		query (
+			$id: ID!
+		) {
+			schema(id: $id) {
+				id
+				status
+				majorVersion
+				definition
+			}
+		}
+	`)
+	req.Var("id", schemaID)
+
+	var resp struct {
+		Result *Schema `json:"schema"`
+	}
+	return resp.Result, c.Run(ctx, req, &resp)
+}
+
+// FindDataRegistry the data registry with exactly this name, nil if there is none
+func (c *PlatformGraphQLClient) FindDataRegistry(ctx context.Context, name string) (*DataRegistry, error) {
+	req := graphql.NewRequest(`
+		query (
+			$name: String!
+		) {
+			dataRegistries(name: $name, nameMatch: exact, limit: 1) {
+				records {
+					id
+					name
+				}
+			}
+		}
+	`)
+	req.Var("name", name)
+
+	var resp struct {
+		Result *DataRegistryRecords `json:"dataRegistries"`
+	}
+	if err := c.Run(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Result == nil || len(resp.Result.Records) == 0 {
+		return nil, nil
+	}
+	return &resp.Result.Records[0], nil
+}
+
+// CreateDataRegistry create a data registry, which holds the versions of a schema
+func (c *PlatformGraphQLClient) CreateDataRegistry(ctx context.Context, name, description string) (*DataRegistry, error) {
+	req := graphql.NewRequest(`
+		mutation (
+			$name: String!
+			$description: String!
+		) {
+			createDataRegistry(input: {
+				name: $name
+				description: $description
+				source: "field deprecated"
+			}) {
+				id
+				name
+			}
+		}
+	`)
+	req.Var("name", name)
+	req.Var("description", description)
+
+	var resp struct {
+		Result *DataRegistry `json:"createDataRegistry"`
+	}
+	return resp.Result, c.Run(ctx, req, &resp)
+}
+
+// UpsertSchemaDraft create or update the draft of the major version of the data registry schema
+func (c *PlatformGraphQLClient) UpsertSchemaDraft(ctx context.Context, dataRegistryID string, majorVersion int, schema interface{}) (*Schema, error) {
+	req := graphql.NewRequest(`
+		mutation (
+			$dataRegistryId: ID!
+			$majorVersion: Int!
+			$schema: JSONData!
+		) {
+			upsertSchemaDraft(input: {
+				dataRegistryId: $dataRegistryId
+				majorVersion: $majorVersion
+				schema: $schema
+			}) {
+				id
+				status
+			}
+		}
+	`)
+	req.Var("dataRegistryId", dataRegistryID)
+	req.Var("majorVersion", majorVersion)
+	req.Var("schema", schema)
+
+	var resp struct {
+		Result *Schema `json:"upsertSchemaDraft"`
+	}
+	return resp.Result, c.Run(ctx, req, &resp)
+}
+
+// PublishSchema publish a schema draft, so that SDOs can be written against it
+func (c *PlatformGraphQLClient) PublishSchema(ctx context.Context, schemaID string) (*Schema, error) {
+	req := graphql.NewRequest(`
+		mutation (
+			$id: ID!
+		) {
+			updateSchemaState(input: {
+				id: $id
+				status: published
+			}) {
+				id
+				status
+			}
+		}
+	`)
+	req.Var("id", schemaID)
+
+	var resp struct {
+		Result *Schema `json:"updateSchemaState"`
+	}
+	return resp.Result, c.Run(ctx, req, &resp)
+}
+
 // CreateSDO create a structured data object in our platform
 func (c *PlatformGraphQLClient) CreateSDO(ctx context.Context, schemaID string, data interface{}) (*SDO, error) {
 	req := graphql.NewRequest(`
@@ -362,6 +898,37 @@ func (c *PlatformGraphQLClient) CreateSDO(ctx context.Context, schemaID string,
 	return resp.Result, c.Run(ctx, req, &resp)
 }
 
+// UpdateSDO replace the data of an existing structured data object
+func (c *PlatformGraphQLClient) UpdateSDO(ctx context.Context, sdoID, schemaID string, data interface{}) (*SDO, error) {
+	req := graphql.NewRequest(`
+		mutation (
+			$id: ID!
+			$schemaId: ID!
+			$data: JSONData
+		) {
+			createStructuredData(input: {
+				id: $id
+				schemaId: $schemaId
+				data: $data
+			}) {
+				id
+				schemaId
+				createdDateTime
+				modifiedDateTime
+			}
+		}
+	`)
+	req.Var("id", sdoID)
+	req.Var("schemaId", schemaID)
+	req.Var("data", data)
+
+	var resp struct {
+		Result *SDO `json:"createStructuredData"`
+	}
+
+	return resp.Result, c.Run(ctx, req, &resp)
+}
+
 // CreateJob create a job in our platform
 func (c *PlatformGraphQLClient) CreateJob(ctx context.Context, tdoID string, isReprocessJob bool, tasks ...CreateJobTask) (*Job, error) {
 	req := graphql.NewRequest(`
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFetchAssetsFailsOnlyTheAliasesInError(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		found    []string
+		failed   map[string]string
+	}{
+		{
+			name:     "error of one alias",
+			response: `{"data":{"a0":{"id":"x"},"a1":null,"a2":{"id":"z"}},"errors":[{"message":"Not allowed","path":["a1"]}]}`,
+			found:    []string{"x", "z"},
+			failed:   map[string]string{"y": "graphql: Not allowed"},
+		},
+		{
+			name:     "error of a nested field",
+			response: `{"data":{"a0":null,"a1":{"id":"y"},"a2":{"id":"z"}},"errors":[{"message":"Bad jsondata","path":["a0","jsondata"]}]}`,
+			found:    []string{"y", "z"},
+			failed:   map[string]string{"x": "graphql: Bad jsondata"},
+		},
+		{
+			name:     "missing asset without error",
+			response: `{"data":{"a0":{"id":"x"},"a1":{"id":"y"},"a2":null}}`,
+			found:    []string{"x", "y"},
+			failed:   map[string]string{"z": "asset z not found"},
+		},
+		{
+			name:     "error without a path",
+			response: `{"data":null,"errors":[{"message":"Query too complex"}]}`,
+			failed:   map[string]string{"x": "graphql: Query too complex", "y": "graphql: Query too complex", "z": "graphql: Query too complex"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer token" {
+					t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(test.response))
+			}))
+			defer server.Close()
+
+			client := &PlatformGraphQLClient{endpoint: server.URL, httpClient: newAuthHTTPClient("token", 0, nil)}
+			assets, errs := client.FetchAssets(context.Background(), []string{"x", "y", "z"}, 3)
+			if len(assets) != len(test.found) {
+				t.Errorf("found %d assets, want %d", len(assets), len(test.found))
+			}
+			for _, assetID := range test.found {
+				if assets[assetID] == nil {
+					t.Errorf("asset %s not found", assetID)
+				}
+			}
+			if len(errs) != len(test.failed) {
+				t.Errorf("%d assets failed, want %d: %v", len(errs), len(test.failed), errs)
+			}
+			for assetID, want := range test.failed {
+				if err := errs[assetID]; err == nil || err.Error() != want {
+					t.Errorf("error of asset %s = %v, want %s", assetID, err, want)
+				}
+			}
+		})
+	}
+}
@@ -5,9 +5,11 @@ type TDOs []TDO
 
 // TDO a temporal data object
 type TDO struct {
-	ID     string       `json:"id"`
-	Name   string       `json:"name,omitempty"`
-	Assets AssetRecords `json:"assets,omitempty"`
+	ID            string       `json:"id"`
+	Name          string       `json:"name,omitempty"`
+	StartDateTime string       `json:"startDateTime,omitempty"`
+	StopDateTime  string       `json:"stopDateTime,omitempty"`
+	Assets        AssetRecords `json:"assets,omitempty"`
 }
 
 // AssetRecords records of assets
@@ -17,14 +19,51 @@ type AssetRecords struct {
 
 // Asset an asset
 type Asset struct {
-	ID         string     `json:"id,omitempty"`
-	Container  TDO        `json:"container,omitempty"`
-	SourceData SourceData `json:"sourceData,omitempty"`
-	SignedURI  string     `json:"signedUri,omitempty"`
-	Raw        string     `json:"transform"`
-	Data       *EngineOutput
-	Transcript string
-	ModelID    string
+	ID              string     `json:"id,omitempty"`
+	Container       TDO        `json:"container,omitempty"`
+	SourceData      SourceData `json:"sourceData,omitempty"`
+	SignedURI       string     `json:"signedUri,omitempty"`
+	ContentType     string     `json:"contentType,omitempty"`
+	CreatedDateTime string     `json:"createdDateTime,omitempty"`
+	Data            *EngineOutput
+	Transcript      string
+	// RawHash the SHA-256 of the engine output the asset was compiled from
+	RawHash string `json:",omitempty"`
+	// ModifiedDateTime changes when the output of the asset is rewritten
+	ModifiedDateTime string `json:"modifiedDateTime,omitempty"`
+	// Words and Segments the compiled transcript, a segment per series of the output
+	Words    []TranscriptWord    `json:",omitempty"`
+	Segments []TranscriptSegment `json:",omitempty"`
+	// Lattice every alternative of the output, only kept when at least one series has alternatives
+	Lattice []LatticeWord `json:",omitempty"`
+	ModelID string
+}
+
+// LatticeWord an alternative of an output, spanning the series Slot to Slot+UtteranceLength-1
+type LatticeWord struct {
+	Word            string  `json:"word"`
+	Confidence      float64 `json:"confidence,omitempty"`
+	BestPath        bool    `json:"bestPath,omitempty"`
+	Slot            int     `json:"slot"`
+	UtteranceLength int     `json:"utteranceLength"`
+}
+
+// TranscriptWord a best-path word of a compiled transcript, timed by the series it spans
+type TranscriptWord struct {
+	Word        string  `json:"word"`
+	Confidence  float64 `json:"confidence,omitempty"`
+	StartTimeMs int32   `json:"startTimeMs,omitempty"`
+	StopTimeMs  int32   `json:"stopTimeMs,omitempty"`
+}
+
+// TranscriptSegment an utterance of a compiled transcript, holding Words[FirstWord:FirstWord+WordCount]
+type TranscriptSegment struct {
+	StartTimeMs int32  `json:"startTimeMs,omitempty"`
+	StopTimeMs  int32  `json:"stopTimeMs,omitempty"`
+	SpeakerID   string `json:"speakerId,omitempty"`
+	Language    string `json:"language,omitempty"`
+	FirstWord   int    `json:"firstWord"`
+	WordCount   int    `json:"wordCount"`
 }
 
 // SourceData the source data for an asset
@@ -52,6 +91,7 @@ type EngineResult struct {
 type EngineOutput struct {
 	TaskID           string   `json:"taskId,omitempty"`
 	GeneratedDateUTC string   `json:"generatedDateUTC,omitempty"`
+	Language         string   `json:"language,omitempty"`
 	Tags             []Tags   `json:"tags,omitempty"`
 	Series           []Series `json:"series,omitempty"`
 }
@@ -122,6 +162,9 @@ type Schema struct {
 	ID         string      `json:"id"`
 	Status     string      `json:"status"`
 	SDORecords *SDORecords `json:"structuredDataObjects,omitempty"`
+	// MajorVersion and Definition the version and the JSON Schema the SDOs written against it are validated with
+	MajorVersion int                    `json:"majorVersion,omitempty"`
+	Definition   map[string]interface{} `json:"definition,omitempty"`
 }
 
 // SDORecords represent a list of SDO records
@@ -139,6 +182,17 @@ type Schemas struct {
 	Schemas SchemaRecords `json:"schemas"`
 }
 
+// DataRegistry represent a data registry
+type DataRegistry struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// DataRegistryRecords data registry records from graphql
+type DataRegistryRecords struct {
+	Records []DataRegistry `json:"records"`
+}
+
 // PublishedSchema represent one published schema
 type PublishedSchema struct {
 	DataRegistryID string  `json:"id"`
@@ -184,9 +238,13 @@ type Tasks struct {
 
 // Task represent a task
 type Task struct {
-	TaskID string `json:"id"`
-	Status string `json:"status,omitempty"`
-	Engine Engine `json:"engine"`
+	TaskID            string `json:"id"`
+	Status            string `json:"status,omitempty"`
+	Engine            Engine `json:"engine"`
+	CreatedDateTime   string `json:"createdDateTime,omitempty"`
+	QueuedDateTime    string `json:"queuedDateTime,omitempty"`
+	StartedDateTime   string `json:"startedDateTime,omitempty"`
+	CompletedDateTime string `json:"completedDateTime,omitempty"`
 }
 
 type Point struct {
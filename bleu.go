@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+	"strings"
+)
+
+// maxBleuOrder the longest n-grams BLEU counts
+const maxBleuOrder = 4
+
+// bleuStats the n-gram statistics of a hypothesis against its reference. The statistics of several outputs add up
+// to the corpus BLEU of these outputs, they are stored in the benchmark SDOs for that.
+type bleuStats struct {
+	Matches          [maxBleuOrder]int `json:"matches"`
+	Totals           [maxBleuOrder]int `json:"totals"`
+	HypothesisLength int               `json:"hypothesisLength"`
+	ReferenceLength  int               `json:"referenceLength"`
+}
+
+// newBleuStats count the clipped n-gram matches of the hypothesis tokens against the reference tokens
+func newBleuStats(reference, hypothesis []string) bleuStats {
+	stats := bleuStats{HypothesisLength: len(hypothesis), ReferenceLength: len(reference)}
+	for n := 1; n <= maxBleuOrder; n++ {
+		referenceCounts := ngramCounts(reference, n)
+		for ngram, count := range ngramCounts(hypothesis, n) {
+			stats.Matches[n-1] += minInt(count, referenceCounts[ngram])
+			stats.Totals[n-1] += count
+		}
+	}
+	return stats
+}
+
+func ngramCounts(tokens []string, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i+n <= len(tokens); i++ {
+		counts[strings.Join(tokens[i:i+n], " ")]++
+	}
+	return counts
+}
+
+func (s *bleuStats) add(other bleuStats) {
+	for n := range s.Matches {
+		s.Matches[n] += other.Matches[n]
+		s.Totals[n] += other.Totals[n]
+	}
+	s.HypothesisLength += other.HypothesisLength
+	s.ReferenceLength += other.ReferenceLength
+}
+
+// score the corpus BLEU in points, from 0 to 100, of the statistics added up over the outputs. It is not smoothed:
+// the n-gram totals of a corpus are large enough, and smoothing them would bias the comparison of the models.
+func (s bleuStats) score() float64 {
+	return s.bleu(0)
+}
+
+// sentenceScore the BLEU in points of a single output. The orders above unigrams are smoothed by adding one to their
+// matches and totals, so that a short output without a 4-gram match does not score 0.
+func (s bleuStats) sentenceScore() float64 {
+	return s.bleu(1)
+}
+
+// bleu the geometric mean of the n-gram precisions, the orders above unigrams smoothed by adding smoothing to their
+// matches and totals, times the brevity penalty
+func (s bleuStats) bleu(smoothing float64) float64 {
+	if s.HypothesisLength == 0 || s.Matches[0] == 0 {
+		return 0
+	}
+	var logPrecision float64
+	for n := 0; n < maxBleuOrder; n++ {
+		matches, totals := float64(s.Matches[n]), float64(s.Totals[n])
+		if n > 0 {
+			matches += smoothing
+			totals += smoothing
+		}
+		if matches == 0 {
+			return 0
+		}
+		logPrecision += math.Log(matches/totals) / maxBleuOrder
+	}
+	var brevityPenalty float64
+	if s.HypothesisLength < s.ReferenceLength {
+		brevityPenalty = 1 - float64(s.ReferenceLength)/float64(s.HypothesisLength)
+	}
+	return 100 * math.Exp(logPrecision+brevityPenalty)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestBleuSentenceScore(t *testing.T) {
+	tests := []struct {
+		name       string
+		reference  string
+		hypothesis string
+		want       float64
+	}{
+		{"identical", "the cat sat on the mat", "the cat sat on the mat", 100},
+		{"empty hypothesis", "the cat sat on the mat", "", 0},
+		{"no unigram match", "the cat sat on the mat", "a dog ran", 0},
+		// 1-grams 3/4, smoothed 2-grams (2+1)/(3+1), 3-grams (1+1)/(2+1), 4-grams (0+1)/(1+1),
+		// and the brevity penalty of 4 words against 6
+		{"short with partial matches", "the cat sat on the mat", "the cat sat down", 100 * math.Exp((math.Log(0.75)+math.Log(0.75)+math.Log(2.0/3)+math.Log(0.5))/4+1-6.0/4)},
+		// matches are clipped to the reference counts
+		{"repeated word", "the cat", "the the the the", 100 * math.Exp((math.Log(0.25)+math.Log(1.0/4)+math.Log(1.0/3)+math.Log(1.0/2))/4)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stats := newBleuStats(strings.Fields(test.reference), strings.Fields(test.hypothesis))
+			if got := stats.sentenceScore(); math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("sentenceScore() = %f, want %f", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBleuScoreIsNotSmoothed(t *testing.T) {
+	tests := []struct {
+		name       string
+		reference  string
+		hypothesis string
+		want       float64
+	}{
+		{"identical", "the cat sat on the mat", "the cat sat on the mat", 100},
+		// 1-grams 5/6, 2-grams 3/5, 3-grams 2/4, 4-grams 1/3
+		{"partial matches", "the cat sat on the mat", "the cat sat on a mat", 100 * math.Exp((math.Log(5.0/6)+math.Log(3.0/5)+math.Log(2.0/4)+math.Log(1.0/3))/4)},
+		// smoothed, these would score above 0
+		{"no 4-gram match", "the cat sat on the mat", "the cat sat down", 0},
+		{"shorter than 4 words", "the cat", "the cat", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stats := newBleuStats(strings.Fields(test.reference), strings.Fields(test.hypothesis))
+			if got := stats.score(); math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("score() = %f, want %f", got, test.want)
+			}
+		})
+	}
+	if short := newBleuStats(strings.Fields("the cat"), strings.Fields("the cat")); short.sentenceScore() <= 0 {
+		t.Error("sentenceScore() of a short output = 0")
+	}
+}
+
+func TestBleuStatsAdd(t *testing.T) {
+	first := newBleuStats(strings.Fields("the cat sat on the mat"), strings.Fields("the cat sat on the mat"))
+	second := newBleuStats(strings.Fields("a dog ran in the park"), strings.Fields("a dog ran"))
+
+	var corpus bleuStats
+	corpus.add(first)
+	corpus.add(second)
+	if corpus.HypothesisLength != 9 || corpus.ReferenceLength != 12 {
+		t.Errorf("lengths = %d/%d, want 9/12", corpus.HypothesisLength, corpus.ReferenceLength)
+	}
+	if corpus.Matches != [maxBleuOrder]int{9, 7, 5, 3} || corpus.Totals != [maxBleuOrder]int{9, 7, 5, 3} {
+		t.Errorf("matches = %v, totals = %v", corpus.Matches, corpus.Totals)
+	}
+	// the corpus BLEU is not the mean of the BLEU of the outputs
+	if score := corpus.score(); score <= second.sentenceScore() || score >= first.sentenceScore() {
+		t.Errorf("corpus score() = %f, want between %f and %f", score, second.sentenceScore(), first.sentenceScore())
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// compileVersion is part of the cache key of a compiled asset. Bump it whenever compileAsset changes its output.
+const compileVersion = "6"
+
+// AssetCacheConfig the on-disk cache of fetched and compiled assets
+type AssetCacheConfig struct {
+	// Dir where the cache is stored, the cache is disabled when empty
+	Dir string `json:"dir"`
+	// TTL how long a fetched asset is reused before it is fetched again, e.g. "24h"
+	TTL string `json:"ttl"`
+	// MaxSizeMB the size above which the least recently used entries are evicted
+	MaxSizeMB int64 `json:"maxSizeMb"`
+}
+
+// assetCacheIndexEntry maps an asset ID to the content it had when it was fetched
+type assetCacheIndexEntry struct {
+	ContentHash string    `json:"contentHash"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+	// ModifiedDateTime the modified time of the asset when it was fetched, the entry is stale once it changes
+	ModifiedDateTime string `json:"modifiedDateTime"`
+}
+
+// assetCache a content-addressed cache of compiled assets. Entries are stored by a hash of the raw asset output,
+// and an index maps each asset ID to its latest content so a cached asset can be reused without downloading it.
+type assetCache struct {
+	sync.Mutex
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+
+	Hits   int
+	Misses int
+}
+
+// newAssetCache returns nil, a disabled cache, when no directory is configured
+func newAssetCache(config AssetCacheConfig) (*assetCache, error) {
+	if config.Dir == "" {
+		return nil, nil
+	}
+	c := &assetCache{dir: config.Dir, maxSize: config.MaxSizeMB * 1024 * 1024}
+	if config.TTL != "" {
+		ttl, err := time.ParseDuration(config.TTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid cache ttl %q", config.TTL)
+		}
+		c.ttl = ttl
+	}
+	for _, dir := range []string{c.indexDir(), c.contentDir()} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, errors.Wrap(err, "failed to create the asset cache directory")
+		}
+	}
+	return c, nil
+}
+
+func (c *assetCache) indexDir() string   { return filepath.Join(c.dir, "assets") }
+func (c *assetCache) contentDir() string { return filepath.Join(c.dir, "content") }
+
+func (c *assetCache) indexFile(assetID string) string {
+	return filepath.Join(c.indexDir(), hashString(assetID)+".json")
+}
+
+func (c *assetCache) contentFile(contentHash string) string {
+	return filepath.Join(c.contentDir(), contentHash+".json")
+}
+
+// contentHash the cache key of an asset: everything its compilation depends on, its category and the hash of its
+// raw output, and the version of the compilation
+func contentHash(asset *api.Asset) string {
+	var categoryID string
+	if asset.SourceData.Engine != nil {
+		categoryID = asset.SourceData.Engine.CategoryID
+	}
+	return hashString(compileVersion + "\n" + categoryID + "\n" + asset.RawHash)
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookup returns the compiled asset if it was fetched within the TTL and has not been modified since. The asset is
+// the one just fetched, without its content.
+func (c *assetCache) lookup(asset *api.Asset) (*api.Asset, bool) {
+	if c == nil {
+		return nil, false
+	}
+	var entry assetCacheIndexEntry
+	if err := readJSONFile(c.indexFile(asset.ID), &entry); err != nil {
+		return nil, false
+	}
+	if c.ttl > 0 && time.Since(entry.FetchedAt) > c.ttl {
+		return nil, false
+	}
+	// without a modified time a rewritten output cannot be told apart
+	if entry.ModifiedDateTime == "" || entry.ModifiedDateTime != asset.ModifiedDateTime {
+		return nil, false
+	}
+	cached, ok := c.lookupContent(entry.ContentHash)
+	if !ok {
+		return nil, false
+	}
+	return withMetadataOf(cached, asset), true
+}
+
+// lookupContent returns the compiled asset stored for the content hash
+func (c *assetCache) lookupContent(hash string) (*api.Asset, bool) {
+	if c == nil {
+		return nil, false
+	}
+	var asset api.Asset
+	file := c.contentFile(hash)
+	if err := readJSONFile(file, &asset); err != nil {
+		return nil, false
+	}
+	// a corrupted or tampered entry is not served
+	if contentHash(&asset) != hash {
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(file, now, now)
+	return &asset, true
+}
+
+// store the compiled asset and point its asset ID to it
+func (c *assetCache) store(asset *api.Asset) error {
+	if c == nil {
+		return nil
+	}
+	hash := contentHash(asset)
+	if err := writeJSONFile(c.contentFile(hash), asset); err != nil {
+		return err
+	}
+	entry := assetCacheIndexEntry{ContentHash: hash, FetchedAt: time.Now(), ModifiedDateTime: asset.ModifiedDateTime}
+	if err := writeJSONFile(c.indexFile(asset.ID), entry); err != nil {
+		return err
+	}
+	return c.evict()
+}
+
+// spool copy the raw output of an asset to a temporary file of the cache. It returns the file, rewound, and the
+// SHA-256 of the output. The caller closes and removes the file.
+func (c *assetCache) spool(r io.Reader) (*os.File, string, error) {
+	f, err := ioutil.TempFile(c.dir, ".spool-*")
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to write to the asset cache")
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, hash), r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, "", err
+	}
+	return f, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// evict remove the least recently used content until the cache fits in its maximum size
+func (c *assetCache) evict() error {
+	if c.maxSize <= 0 {
+		return nil
+	}
+	files, err := ioutil.ReadDir(c.contentDir())
+	if err != nil {
+		return errors.Wrap(err, "failed to list the asset cache")
+	}
+	var size int64
+	for _, f := range files {
+		size += f.Size()
+	}
+	if size <= c.maxSize {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	for _, f := range files {
+		if size <= c.maxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.contentDir(), f.Name())); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed to evict from the asset cache")
+		}
+		size -= f.Size()
+	}
+	return c.removeOrphanIndexEntries()
+}
+
+// removeOrphanIndexEntries remove the index entries whose content was evicted
+func (c *assetCache) removeOrphanIndexEntries() error {
+	files, err := ioutil.ReadDir(c.indexDir())
+	if err != nil {
+		return errors.Wrap(err, "failed to list the asset cache index")
+	}
+	for _, f := range files {
+		file := filepath.Join(c.indexDir(), f.Name())
+		var entry assetCacheIndexEntry
+		if err := readJSONFile(file, &entry); err != nil {
+			// a temporary file being written, or a corrupted entry which lookup never serves
+			continue
+		}
+		if _, err := os.Stat(c.contentFile(entry.ContentHash)); !os.IsNotExist(err) {
+			continue
+		}
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed to evict from the asset cache index")
+		}
+	}
+	return nil
+}
+
+// withMetadataOf the compiled asset with the metadata of the asset given, whose content it shares
+func withMetadataOf(compiled, asset *api.Asset) *api.Asset {
+	compiled.ID, compiled.Container, compiled.SourceData = asset.ID, asset.Container, asset.SourceData
+	compiled.SignedURI, compiled.ContentType = asset.SignedURI, asset.ContentType
+	compiled.CreatedDateTime, compiled.ModifiedDateTime = asset.CreatedDateTime, asset.ModifiedDateTime
+	// like compileAsset, an asset without an engine gets an empty one
+	if compiled.SourceData.Engine == nil {
+		compiled.SourceData.Engine = &api.Engine{}
+	}
+	return compiled
+}
+
+func (c *assetCache) hit() {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	c.Hits++
+	c.Unlock()
+}
+
+func (c *assetCache) miss() {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	c.Misses++
+	c.Unlock()
+}
+
+// stats the hit and miss counts of the cache
+func (c *assetCache) stats() (hits, misses int) {
+	if c == nil {
+		return 0, 0
+	}
+	c.Lock()
+	defer c.Unlock()
+	return c.Hits, c.Misses
+}
+
+func readJSONFile(file string, v interface{}) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// writeJSONFile write the file atomically so a concurrent reader never sees a partial entry
+func writeJSONFile(file string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".tmp-*")
+	if err != nil {
+		return errors.Wrap(err, "failed to write to the asset cache")
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "failed to write to the asset cache")
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "failed to write to the asset cache")
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// fetchCompiledAssets fetch and compile the assets, going through the asset cache when one is configured.
+// Fetch and compile errors are returned separately, keyed by asset ID, so the callers can report them differently.
+// An asset that failed to compile is still returned as fetched.
+func fetchCompiledAssets(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, assetIDs []string) (assets map[string]*api.Asset, fetchErrs, compileErrs map[string]error) {
+	cache := myAppContext.AssetCache
+	assets = make(map[string]*api.Asset, len(assetIDs))
+	compileErrs = make(map[string]error)
+
+	// the metadata of every asset is fetched, the cache only saves downloading and compiling the unmodified outputs
+	fetched, fetchErrs := graphQLClient.FetchAssets(ctx, assetIDs, myAppContext.Config.AssetBatchSize)
+	for assetID, asset := range fetched {
+		if cached, ok := cache.lookup(asset); ok {
+			cache.hit()
+			assets[assetID] = cached
+			continue
+		}
+		logger := logFrom(ctx).with("assetId", assetID)
+		compiled, fromCache, downloadErr, compileErr := downloadAndCompile(ctx, graphQLClient, cache, asset)
+		if downloadErr != nil {
+			fetchErrs[assetID] = downloadErr
+			continue
+		}
+		if compileErr != nil {
+			compileErrs[assetID] = compileErr
+			assets[assetID] = asset
+			continue
+		}
+		if fromCache {
+			cache.hit()
+		} else {
+			cache.miss()
+		}
+		if err := cache.store(compiled); err != nil {
+			logger.Warnf("Failed to cache the asset(%s) due to: %s", assetID, err)
+		}
+		assets[assetID] = compiled
+	}
+	return assets, fetchErrs, compileErrs
+}
+
+// downloadAndCompile download the raw output of the asset and compile it. Without a cache the output is compiled as
+// it downloads. With one it is first spooled to a temporary file, as its hash may point to an already compiled copy.
+// A failed download and a failed compilation are returned apart.
+func downloadAndCompile(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, cache *assetCache, asset *api.Asset) (compiled *api.Asset, fromCache bool, downloadErr, compileErr error) {
+	body, err := graphQLClient.OpenAssetContent(ctx, asset)
+	if err != nil {
+		return nil, false, err, nil
+	}
+	defer body.Close()
+
+	if cache == nil {
+		hash := sha256.New()
+		compiled, err := compileAsset(ctx, asset, io.TeeReader(body, hash))
+		if err != nil {
+			return nil, false, nil, err
+		}
+		compiled.RawHash = hex.EncodeToString(hash.Sum(nil))
+		return compiled, false, nil, nil
+	}
+
+	spooled, rawHash, err := cache.spool(body)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "failed to download asset %s", asset.ID), nil
+	}
+	defer os.Remove(spooled.Name())
+	defer spooled.Close()
+	asset.RawHash = rawHash
+
+	// the asset ID is not cached, expired or modified, but its content may already be compiled, e.g. for another asset
+	if cached, ok := cache.lookupContent(contentHash(asset)); ok {
+		return withMetadataOf(cached, asset), true, nil, nil
+	}
+	compiled, err = compileAsset(ctx, asset, spooled)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	return compiled, false, nil, nil
+}
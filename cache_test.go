@@ -0,0 +1,148 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+func newTestAssetCache(t *testing.T, config AssetCacheConfig) (*assetCache, func()) {
+	dir, err := ioutil.TempDir("", "asset-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Dir = dir
+	c, err := newAssetCache(config)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return c, func() { os.RemoveAll(dir) }
+}
+
+func cachedTestAsset(id, modified, rawHash string) *api.Asset {
+	return &api.Asset{
+		ID:               id,
+		ModifiedDateTime: modified,
+		RawHash:          rawHash,
+		SourceData:       api.SourceData{Engine: &api.Engine{ID: "engine-" + id, CategoryID: categoryTranscriptionID}},
+		Transcript:       "hello world",
+	}
+}
+
+func TestAssetCacheLookup(t *testing.T) {
+	c, cleanup := newTestAssetCache(t, AssetCacheConfig{TTL: "1h"})
+	defer cleanup()
+	if err := c.store(cachedTestAsset("a1", "2020-01-01T00:00:00Z", "raw1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.store(cachedTestAsset("a2", "", "raw2")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		asset    *api.Asset
+		found    bool
+		engineID string
+	}{
+		{"unmodified", &api.Asset{ID: "a1", ModifiedDateTime: "2020-01-01T00:00:00Z", SourceData: api.SourceData{Engine: &api.Engine{ID: "current"}}}, true, "current"},
+		{"rewritten since", &api.Asset{ID: "a1", ModifiedDateTime: "2020-02-01T00:00:00Z"}, false, ""},
+		{"without a modified time", &api.Asset{ID: "a2"}, false, ""},
+		{"not cached", &api.Asset{ID: "a3", ModifiedDateTime: "2020-01-01T00:00:00Z"}, false, ""},
+		{"without an engine", &api.Asset{ID: "a1", ModifiedDateTime: "2020-01-01T00:00:00Z"}, true, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cached, found := c.lookup(test.asset)
+			if found != test.found {
+				t.Fatalf("lookup() found = %v, want %v", found, test.found)
+			}
+			if !found {
+				return
+			}
+			if cached.Transcript != "hello world" {
+				t.Errorf("transcript = %q", cached.Transcript)
+			}
+			// the engine of the requesting asset, never the one of the asset that was cached
+			if cached.SourceData.Engine == nil || cached.SourceData.Engine.ID != test.engineID {
+				t.Errorf("engine = %+v, want ID %q", cached.SourceData.Engine, test.engineID)
+			}
+		})
+	}
+}
+
+func TestAssetCacheLookupExpired(t *testing.T) {
+	c, cleanup := newTestAssetCache(t, AssetCacheConfig{TTL: "1ms"})
+	defer cleanup()
+	if err := c.store(cachedTestAsset("a1", "2020-01-01T00:00:00Z", "raw1")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, found := c.lookup(&api.Asset{ID: "a1", ModifiedDateTime: "2020-01-01T00:00:00Z"}); found {
+		t.Error("an expired entry was served")
+	}
+}
+
+func TestAssetCacheEvictRemovesIndexEntries(t *testing.T) {
+	c, cleanup := newTestAssetCache(t, AssetCacheConfig{})
+	defer cleanup()
+	for i, id := range []string{"a1", "a2", "a3"} {
+		asset := cachedTestAsset(id, "2020-01-01T00:00:00Z", "raw-"+id)
+		asset.Transcript = strings.Repeat("word ", 1000)
+		if err := c.store(asset); err != nil {
+			t.Fatal(err)
+		}
+		// the least recently used first
+		used := time.Now().Add(time.Duration(i-10) * time.Minute)
+		os.Chtimes(c.contentFile(contentHash(asset)), used, used)
+	}
+	files, err := ioutil.ReadDir(c.contentDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.maxSize = files[0].Size() + 1
+	if err := c.evict(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		assetID string
+		kept    bool
+	}{
+		{"a1", false},
+		{"a2", false},
+		{"a3", true},
+	}
+	for _, test := range tests {
+		_, err := os.Stat(c.indexFile(test.assetID))
+		if kept := err == nil; kept != test.kept {
+			t.Errorf("index entry of %s kept = %v, want %v", test.assetID, kept, test.kept)
+		}
+	}
+	if entries, _ := filepath.Glob(filepath.Join(c.indexDir(), "*.json")); len(entries) != 1 {
+		t.Errorf("%d index entries left, want 1", len(entries))
+	}
+}
+
+func TestAssetCacheRejectsTamperedContent(t *testing.T) {
+	c, cleanup := newTestAssetCache(t, AssetCacheConfig{})
+	defer cleanup()
+	asset := cachedTestAsset("a1", "2020-01-01T00:00:00Z", "raw1")
+	if err := c.store(asset); err != nil {
+		t.Fatal(err)
+	}
+	hash := contentHash(asset)
+	asset.RawHash = "other"
+	if err := writeJSONFile(c.contentFile(hash), asset); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := c.lookupContent(hash); found {
+		t.Error("content not matching its hash was served")
+	}
+}
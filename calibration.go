@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+const (
+	// calibrationBins the number of equal-width confidence bins of the reliability diagram
+	calibrationBins = 10
+	// confidenceEpsilon keeps the log of a confidence of 0 or 1 finite
+	confidenceEpsilon = 1e-6
+)
+
+// scoredWord a hypothesis word, its confidence and whether the alignment found it correct
+type scoredWord struct {
+	confidence float64
+	correct    bool
+}
+
+// reliabilityBin a bin of the reliability diagram: the words whose confidence is in [Lower, Upper)
+type reliabilityBin struct {
+	Lower          float64 `json:"lower"`
+	Upper          float64 `json:"upper"`
+	Words          int     `json:"words"`
+	MeanConfidence float64 `json:"meanConfidence"`
+	Accuracy       float64 `json:"accuracy"`
+}
+
+// calibrationMetrics how well the word confidences of an output predict the correctness of its words
+type calibrationMetrics struct {
+	Words int              `json:"words"`
+	Bins  []reliabilityBin `json:"bins"`
+	// ExpectedCalibrationError the mean gap between confidence and accuracy of the bins, weighted by their words
+	ExpectedCalibrationError float64 `json:"expectedCalibrationError"`
+	// NormalizedCrossEntropy the information the confidences add over the overall accuracy, 1 is perfect, 0 or less is useless
+	NormalizedCrossEntropy float64 `json:"normalizedCrossEntropy"`
+	// AUROC how well a low confidence detects an error, 0.5 is chance. Omitted when all the words are correct or all wrong.
+	AUROC *float64 `json:"auroc,omitempty"`
+}
+
+// alignConfidences map the confidence of each hypothesis word to the sclite alignment. It returns nil when
+// the words have no confidence or do not match the aligned hypothesis.
+func alignConfidences(words []api.TranscriptWord, alignment []word) []scoredWord {
+	var tokens []string
+	var confidences []float64
+	var hasConfidence bool
+	for _, w := range words {
+		hasConfidence = hasConfidence || w.Confidence > 0
+		// score the words the way sclite saw them
+		for _, token := range strings.Fields(sanitize(w.Word)) {
+			tokens = append(tokens, token)
+			confidences = append(confidences, w.Confidence)
+		}
+	}
+	if !hasConfidence {
+		return nil
+	}
+
+	scored := make([]scoredWord, 0, len(tokens))
+	for _, aligned := range alignment {
+		if aligned.Action == "D" {
+			continue
+		}
+		i := len(scored)
+		if i >= len(tokens) || !strings.EqualFold(tokens[i], aligned.Hypothesis) {
+			return nil
+		}
+		scored = append(scored, scoredWord{confidence: confidences[i], correct: aligned.Action == "C"})
+	}
+	if len(scored) != len(tokens) {
+		return nil
+	}
+	return scored
+}
+
+// newCalibrationMetrics the reliability diagram, ECE, NCE and AUROC of the scored words, nil without words
+func newCalibrationMetrics(words []scoredWord) *calibrationMetrics {
+	if len(words) == 0 {
+		return nil
+	}
+	metrics := &calibrationMetrics{Words: len(words), Bins: make([]reliabilityBin, calibrationBins)}
+
+	var correct int
+	var confidenceSums [calibrationBins]float64
+	var correctCounts [calibrationBins]int
+	for _, w := range words {
+		bin := int(clampConfidence(w.confidence, 0) * calibrationBins)
+		if bin == calibrationBins {
+			bin--
+		}
+		metrics.Bins[bin].Words++
+		confidenceSums[bin] += w.confidence
+		if w.correct {
+			correctCounts[bin]++
+			correct++
+		}
+	}
+	for i := range metrics.Bins {
+		bin := &metrics.Bins[i]
+		bin.Lower = float64(i) / calibrationBins
+		bin.Upper = float64(i+1) / calibrationBins
+		if bin.Words == 0 {
+			continue
+		}
+		bin.MeanConfidence = confidenceSums[i] / float64(bin.Words)
+		bin.Accuracy = float64(correctCounts[i]) / float64(bin.Words)
+		metrics.ExpectedCalibrationError += math.Abs(bin.MeanConfidence-bin.Accuracy) * float64(bin.Words) / float64(len(words))
+	}
+
+	metrics.NormalizedCrossEntropy = normalizedCrossEntropy(words, correct)
+	if correct > 0 && correct < len(words) {
+		auroc := errorDetectionAUROC(words, correct)
+		metrics.AUROC = &auroc
+	}
+	return metrics
+}
+
+// normalizedCrossEntropy the relative entropy reduction of the correctness given the confidences,
+// over the entropy given the overall accuracy alone. It is 0 when all the words are correct or all wrong.
+func normalizedCrossEntropy(words []scoredWord, correct int) float64 {
+	n := float64(len(words))
+	accuracy := float64(correct) / n
+	if accuracy == 0 || accuracy == 1 {
+		return 0
+	}
+	baseline := -(float64(correct)*math.Log2(accuracy) + (n-float64(correct))*math.Log2(1-accuracy))
+
+	var conditional float64
+	for _, w := range words {
+		confidence := clampConfidence(w.confidence, confidenceEpsilon)
+		if w.correct {
+			conditional -= math.Log2(confidence)
+		} else {
+			conditional -= math.Log2(1 - confidence)
+		}
+	}
+	return (baseline - conditional) / baseline
+}
+
+// errorDetectionAUROC the probability that an erroneous word has a lower confidence than a correct one,
+// counting ties as half, computed from the ranks of the confidences (Mann-Whitney U)
+func errorDetectionAUROC(words []scoredWord, correct int) float64 {
+	sorted := make([]scoredWord, len(words))
+	copy(sorted, words)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].confidence < sorted[j].confidence })
+
+	var correctRankSum float64
+	for i := 0; i < len(sorted); {
+		// words of equal confidence share their average rank
+		j := i
+		for j < len(sorted) && sorted[j].confidence == sorted[i].confidence {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if sorted[k].correct {
+				correctRankSum += rank
+			}
+		}
+		i = j
+	}
+	incorrect := len(words) - correct
+	u := correctRankSum - float64(correct)*float64(correct+1)/2
+	return u / (float64(correct) * float64(incorrect))
+}
+
+// clampConfidence keep the confidence within [epsilon, 1-epsilon]
+func clampConfidence(confidence, epsilon float64) float64 {
+	return math.Max(epsilon, math.Min(1-epsilon, confidence))
+}
+
+// engineCalibration the scored words of every asset of an engine in the task
+type engineCalibration struct {
+	engineName string
+	words      []scoredWord
+}
+
+// calibrationSummary the calibration of each engine across the task, for the info message
+func calibrationSummary(byEngine map[string]*engineCalibration) string {
+	engineIDs := make([]string, 0, len(byEngine))
+	for engineID := range byEngine {
+		engineIDs = append(engineIDs, engineID)
+	}
+	sort.Strings(engineIDs)
+
+	parts := make([]string, 0, len(engineIDs))
+	for _, engineID := range engineIDs {
+		calibration := byEngine[engineID]
+		metrics := newCalibrationMetrics(calibration.words)
+		if metrics == nil {
+			continue
+		}
+		name := calibration.engineName
+		if name == "" {
+			name = engineID
+		}
+		part := fmt.Sprintf("%s ECE %.3f, NCE %.3f", name, metrics.ExpectedCalibrationError, metrics.NormalizedCrossEntropy)
+		if metrics.AUROC != nil {
+			part += fmt.Sprintf(", AUROC %.3f", *metrics.AUROC)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "; ")
+}
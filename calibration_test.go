@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// testScoredWords the words with the confidences, correct or not
+func testScoredWords(correct []float64, incorrect []float64) []scoredWord {
+	var words []scoredWord
+	for _, confidence := range correct {
+		words = append(words, scoredWord{confidence: confidence, correct: true})
+	}
+	for _, confidence := range incorrect {
+		words = append(words, scoredWord{confidence: confidence})
+	}
+	return words
+}
+
+func testFloat(f float64) *float64 {
+	return &f
+}
+
+func TestNewCalibrationMetrics(t *testing.T) {
+	tests := []struct {
+		name      string
+		words     []scoredWord
+		ece, nce  float64
+		auroc     *float64
+		tolerance float64
+	}{
+		// the confidences of both bins are 0.1 under their accuracy
+		{"binned gaps", testScoredWords([]float64{0.9, 0.9, 0.4}, []float64{0.4}), 0.1, normalizedCrossEntropy(testScoredWords([]float64{0.9, 0.9, 0.4}, []float64{0.4}), 3), testFloat(5.0 / 6), 1e-9},
+		{"perfect confidences", testScoredWords([]float64{1, 1}, []float64{0, 0}), 0, 1, testFloat(1), 1e-4},
+		{"confidences of the accuracy", testScoredWords([]float64{0.5, 0.5}, []float64{0.5, 0.5}), 0, 0, testFloat(0.5), 1e-9},
+		{"errors ranked above the correct words", testScoredWords([]float64{0.2}, []float64{0.8}), 0.8, normalizedCrossEntropy(testScoredWords([]float64{0.2}, []float64{0.8}), 1), testFloat(0), 1e-9},
+		// AUROC is left out without both correct and wrong words
+		{"all correct", testScoredWords([]float64{0.7, 0.9}, nil), 0.2, 0, nil, 1e-9},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metrics := newCalibrationMetrics(test.words)
+			if metrics.Words != len(test.words) {
+				t.Errorf("%d words, want %d", metrics.Words, len(test.words))
+			}
+			if math.Abs(metrics.ExpectedCalibrationError-test.ece) > test.tolerance {
+				t.Errorf("ECE = %f, want %f", metrics.ExpectedCalibrationError, test.ece)
+			}
+			if math.Abs(metrics.NormalizedCrossEntropy-test.nce) > test.tolerance {
+				t.Errorf("NCE = %f, want %f", metrics.NormalizedCrossEntropy, test.nce)
+			}
+			switch {
+			case test.auroc == nil:
+				if metrics.AUROC != nil {
+					t.Errorf("AUROC = %f, want none", *metrics.AUROC)
+				}
+			case metrics.AUROC == nil:
+				t.Errorf("no AUROC, want %f", *test.auroc)
+			case math.Abs(*metrics.AUROC-*test.auroc) > test.tolerance:
+				t.Errorf("AUROC = %f, want %f", *metrics.AUROC, *test.auroc)
+			}
+		})
+	}
+	if newCalibrationMetrics(nil) != nil {
+		t.Error("metrics without words")
+	}
+}
+
+func TestCalibrationBins(t *testing.T) {
+	metrics := newCalibrationMetrics(testScoredWords([]float64{1, 0.95, 0.05}, []float64{0}))
+	tests := []struct {
+		bin            int
+		words          int
+		meanConfidence float64
+		accuracy       float64
+	}{
+		// a confidence of 1 falls in the last bin
+		{9, 2, 0.975, 1},
+		{0, 2, 0.025, 0.5},
+		{5, 0, 0, 0},
+	}
+	for _, test := range tests {
+		bin := metrics.Bins[test.bin]
+		if bin.Words != test.words || math.Abs(bin.MeanConfidence-test.meanConfidence) > 1e-9 || bin.Accuracy != test.accuracy {
+			t.Errorf("bin %d = %+v, want %d words, mean confidence %f and accuracy %f", test.bin, bin, test.words, test.meanConfidence, test.accuracy)
+		}
+	}
+	if bin := metrics.Bins[3]; bin.Lower != 0.3 || bin.Upper != 0.4 {
+		t.Errorf("bin 3 = [%f, %f), want [0.3, 0.4)", bin.Lower, bin.Upper)
+	}
+}
+
+func TestNormalizedCrossEntropy(t *testing.T) {
+	// 3 of 4 correct: 3.245 bits given the accuracy alone
+	words := testScoredWords([]float64{0.9, 0.9, 0.9}, []float64{0.1})
+	baseline := -(3*math.Log2(0.75) + math.Log2(0.25))
+	conditional := -(3*math.Log2(0.9) + math.Log2(0.9))
+	if got, want := normalizedCrossEntropy(words, 3), (baseline-conditional)/baseline; math.Abs(got-want) > 1e-9 {
+		t.Errorf("normalizedCrossEntropy() = %f, want %f", got, want)
+	}
+	// confidently wrong words are worse than the accuracy alone
+	if got := normalizedCrossEntropy(testScoredWords([]float64{0.1}, []float64{0.9}), 1); got >= 0 {
+		t.Errorf("normalizedCrossEntropy() = %f, want a negative NCE", got)
+	}
+}
+
+func TestErrorDetectionAUROC(t *testing.T) {
+	tests := []struct {
+		name               string
+		correct, incorrect []float64
+		want               float64
+	}{
+		{"separated", []float64{0.9, 0.8}, []float64{0.1, 0.2}, 1},
+		{"reversed", []float64{0.1}, []float64{0.9}, 0},
+		{"ties count half", []float64{0.5, 0.5}, []float64{0.5}, 0.5},
+		{"one pair out of order", []float64{0.9, 0.4}, []float64{0.5}, 0.5},
+		{"mixed with ties", []float64{0.9, 0.5, 0.3}, []float64{0.5, 0.1}, (2 + 0.5 + 1 + 1 + 0) / 6},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			words := testScoredWords(test.correct, test.incorrect)
+			if got := errorDetectionAUROC(words, len(test.correct)); math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("errorDetectionAUROC() = %f, want %f", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAlignConfidences(t *testing.T) {
+	alignment := []word{
+		{Action: "C", Reference: "the", Hypothesis: "the"},
+		{Action: "D", Reference: "big"},
+		{Action: "S", Reference: "cat", Hypothesis: "hat"},
+		{Action: "I", Hypothesis: "sat"},
+	}
+	tests := []struct {
+		name  string
+		words []api.TranscriptWord
+		want  []scoredWord
+	}{
+		{"aligned", []api.TranscriptWord{{Word: "The", Confidence: 0.9}, {Word: "hat", Confidence: 0.4}, {Word: "sat", Confidence: 0.2}},
+			[]scoredWord{{0.9, true}, {0.4, false}, {0.2, false}}},
+		{"without confidences", []api.TranscriptWord{{Word: "the"}, {Word: "hat"}, {Word: "sat"}}, nil},
+		{"not the aligned hypothesis", []api.TranscriptWord{{Word: "the", Confidence: 0.9}, {Word: "cat", Confidence: 0.4}, {Word: "sat", Confidence: 0.2}}, nil},
+		{"more words than aligned", []api.TranscriptWord{{Word: "the", Confidence: 0.9}, {Word: "hat", Confidence: 0.4}, {Word: "sat", Confidence: 0.2}, {Word: "down", Confidence: 0.2}}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := alignConfidences(test.words, alignment)
+			if len(got) != len(test.want) || (got == nil) != (test.want == nil) {
+				t.Fatalf("alignConfidences() = %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("word %d = %v, want %v", i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCalibrationSummary(t *testing.T) {
+	byEngine := map[string]*engineCalibration{
+		// errors ranked above the correct words, an AUROC of 0 is still reported
+		"engine2": {engineName: "Engine 2", words: testScoredWords([]float64{0.2}, []float64{0.8})},
+		"engine1": {words: testScoredWords([]float64{0.7, 0.9}, nil)},
+		"engine3": {engineName: "Engine 3"},
+	}
+	want := "engine1 ECE 0.200, NCE 0.000; Engine 2 ECE 0.800, NCE " + fmt.Sprintf("%.3f", normalizedCrossEntropy(byEngine["engine2"].words, 1)) + ", AUROC 0.000"
+	if summary := calibrationSummary(byEngine); summary != want {
+		t.Errorf("calibrationSummary() = %q, want %q", summary, want)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// checkpointPageSize the number of benchmark SDOs fetched per page when loading a checkpoint
+const checkpointPageSize = 100
+
+// checkpointEntry one (TDO, asset) pair that already has a benchmark SDO
+type checkpointEntry struct {
+	TDOID           string `json:"tdoId"`
+	AssetID         string `json:"assetId"`
+	BaselineAssetID string `json:"baselineAssetId,omitempty"`
+	SDOID           string `json:"sdoId,omitempty"`
+	// Scores the scores of the output, nil in the checkpoints written before they were recorded
+	Scores *outputScores `json:"scores,omitempty"`
+	// JobID the job created on the TDO by the job mode, set on the entries without an asset
+	JobID string `json:"jobId,omitempty"`
+}
+
+// pairKey the key of an asset of a TDO in the checkpoint
+func pairKey(tdoID, assetID string) string {
+	return tdoID + "/" + assetID
+}
+
+// checkpoint tracks the (TDO, asset) pairs of a task that were already benchmarked, so a retried task only processes what's left
+type checkpoint struct {
+	sync.Mutex
+	key  string
+	file string
+	// assets and baselineAssets keyed by pairKey
+	assets         map[string]checkpointEntry
+	baselineAssets map[string]bool
+	// jobs the jobs created by the job mode, keyed by TDO
+	jobs map[string]string
+}
+
+// checkpointKey the task the checkpoint belongs to and the benchmark SDO field holding it.
+// Falls back to the job when the payload has no task ID.
+func checkpointKey(enginePayload *BenchmarkEnginePayload) (key, sdoField string) {
+	if enginePayload.TaskID != "" {
+		return enginePayload.TaskID, "benchmarkTaskId"
+	}
+	return enginePayload.JobID, "benchmarkJobId"
+}
+
+// loadCheckpoint gather the assets already benchmarked for this task from the benchmark SDOs written to the
+// published schema and, when a checkpoint directory is configured, from the local checkpoint file
+func loadCheckpoint(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, enginePayload *BenchmarkEnginePayload, benchmarkSchemaID, checkpointDir string) (*checkpoint, error) {
+	key, sdoField := checkpointKey(enginePayload)
+	c := &checkpoint{
+		key:            key,
+		assets:         make(map[string]checkpointEntry),
+		baselineAssets: make(map[string]bool),
+	}
+	if c.key == "" {
+		return c, nil
+	}
+
+	if !enginePayload.Test {
+		if err := c.loadFromSDOs(ctx, graphQLClient, benchmarkSchemaID, sdoField); err != nil {
+			return nil, err
+		}
+	}
+
+	if checkpointDir != "" {
+		c.file = filepath.Join(checkpointDir, c.key+".jsonl")
+		if err := c.loadFromFile(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	logFrom(ctx).Infof("Found %d assets already benchmarked for %s", len(c.assets), c.key)
+	return c, nil
+}
+
+func (c *checkpoint) loadFromSDOs(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, benchmarkSchemaID, sdoField string) error {
+	filter := map[string]interface{}{sdoField: c.key}
+	err := fetchBenchmarkSDOs(ctx, graphQLClient, benchmarkSchemaID, filter, func(sdo api.SDO) {
+		tdoID, _ := sdo.Data["tdoId"].(string)
+		assetID, _ := sdo.Data["assetId"].(string)
+		baselineAssetID, _ := sdo.Data["baselineAssetId"].(string)
+		if tdoID == "" || assetID == "" {
+			return
+		}
+		entry := checkpointEntry{TDOID: tdoID, AssetID: assetID, BaselineAssetID: baselineAssetID, SDOID: sdo.ID}
+		// the scores have the field names of the SDO
+		if b, err := json.Marshal(sdo.Data); err == nil {
+			var scores outputScores
+			if json.Unmarshal(b, &scores) == nil {
+				entry.Scores = &scores
+			}
+		}
+		c.add(entry)
+	})
+	return errors.Wrapf(err, "failed to fetch the benchmark SDOs of %s", c.key)
+}
+
+// fetchBenchmarkSDOs page through the benchmark SDOs of the schema matching the filter
+func fetchBenchmarkSDOs(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, benchmarkSchemaID string, filter map[string]interface{}, onSDO func(api.SDO)) error {
+	for offset := 0; ; offset += checkpointPageSize {
+		records, err := graphQLClient.FetchSDOs(ctx, benchmarkSchemaID, filter, offset, checkpointPageSize)
+		if err != nil {
+			return err
+		}
+		if records == nil {
+			return nil
+		}
+		for _, sdo := range records.SDOs {
+			onSDO(sdo)
+		}
+		if len(records.SDOs) < checkpointPageSize {
+			return nil
+		}
+	}
+}
+
+func (c *checkpoint) loadFromFile(ctx context.Context) error {
+	reader, err := os.Open(c.file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to open checkpoint file %s", c.file)
+	}
+	defer reader.Close()
+
+	s := bufio.NewScanner(reader)
+	for s.Scan() {
+		var entry checkpointEntry
+		if err := json.Unmarshal(s.Bytes(), &entry); err != nil {
+			// a partially written last line is expected if the engine was killed while writing it
+			logFrom(ctx).Warnf("Skipping malformed checkpoint line in %s: %s", c.file, err)
+			continue
+		}
+		c.add(entry)
+	}
+	return errors.Wrapf(s.Err(), "failed to read checkpoint file %s", c.file)
+}
+
+func (c *checkpoint) add(entry checkpointEntry) {
+	if entry.JobID != "" && entry.AssetID == "" {
+		if c.jobs == nil {
+			c.jobs = make(map[string]string)
+		}
+		c.jobs[entry.TDOID] = entry.JobID
+		return
+	}
+	key := pairKey(entry.TDOID, entry.AssetID)
+	if previous, ok := c.assets[key]; ok && entry.Scores == nil {
+		entry.Scores = previous.Scores
+	}
+	c.assets[key] = entry
+	if entry.BaselineAssetID != "" {
+		c.baselineAssets[pairKey(entry.TDOID, entry.BaselineAssetID)] = true
+	}
+}
+
+// isAssetDone returns if the asset of the TDO already has a benchmark SDO for this task
+func (c *checkpoint) isAssetDone(tdoID, assetID string) bool {
+	if c == nil {
+		return false
+	}
+	c.Lock()
+	defer c.Unlock()
+	_, ok := c.assets[pairKey(tdoID, assetID)]
+	return ok
+}
+
+// isBaselineDone returns if the baseline asset of the TDO was already used by a benchmark SDO for this task
+func (c *checkpoint) isBaselineDone(tdoID, baselineAssetID string) bool {
+	if c == nil {
+		return false
+	}
+	c.Lock()
+	defer c.Unlock()
+	return c.baselineAssets[pairKey(tdoID, baselineAssetID)]
+}
+
+// sdoReferences the benchmark SDOs recorded by the checkpoint, written by this attempt of the task or a previous one
+func (c *checkpoint) sdoReferences(benchmarkSchemaID string) []SDOReference {
+	if c == nil {
+		return nil
+	}
+	c.Lock()
+	defer c.Unlock()
+	references := make([]SDOReference, 0, len(c.assets))
+	for _, entry := range c.assets {
+		if entry.SDOID != "" {
+			references = append(references, SDOReference{ID: entry.SDOID, SchemaID: benchmarkSchemaID})
+		}
+	}
+	sort.Slice(references, func(i, j int) bool { return references[i].ID < references[j].ID })
+	return references
+}
+
+// markDone record a benchmark SDO that was written, appending it to the local checkpoint file if there is one
+func (c *checkpoint) markDone(entry checkpointEntry) error {
+	if c == nil {
+		return nil
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.add(entry)
+	return c.append(entry)
+}
+
+// markJob record the job created on the TDO, so a retried task waits for it instead of creating another one.
+// The jobs are only kept across attempts in the local checkpoint file.
+func (c *checkpoint) markJob(tdoID, jobID string) error {
+	if c == nil {
+		return nil
+	}
+	c.Lock()
+	defer c.Unlock()
+	entry := checkpointEntry{TDOID: tdoID, JobID: jobID}
+	c.add(entry)
+	return c.append(entry)
+}
+
+// jobID the job a previous attempt of the task created on the TDO, empty if there is none
+func (c *checkpoint) jobID(tdoID string) string {
+	if c == nil {
+		return ""
+	}
+	c.Lock()
+	defer c.Unlock()
+	return c.jobs[tdoID]
+}
+
+// append write the entry to the local checkpoint file if there is one
+func (c *checkpoint) append(entry checkpointEntry) error {
+	if c.file == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.file), 0755); err != nil {
+		return errors.Wrap(err, "failed to create the checkpoint directory")
+	}
+	f, err := os.OpenFile(c.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open checkpoint file %s", c.file)
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(entry)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// testGraphQLServer a client of a GraphQL server answering each request with the data respond returns for its query
+// and variables, sent as a multipart form or as JSON
+func testGraphQLServer(t *testing.T, respond func(query string, variables map[string]interface{}) interface{}) (*api.PlatformGraphQLClient, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+			json.NewDecoder(r.Body).Decode(&request)
+		} else {
+			request.Query = r.FormValue("query")
+			json.Unmarshal([]byte(r.FormValue("variables")), &request.Variables)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": respond(request.Query, request.Variables)})
+	}))
+	client, err := api.NewCoreAPI(api.Options{VeritoneAPIBaseURL: server.URL, GraphQLEndpoint: "/", Token: "token"})
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return client, server.Close
+}
+
+func newTestCheckpoint(file string) *checkpoint {
+	return &checkpoint{key: "task", file: file, assets: make(map[string]checkpointEntry), baselineAssets: make(map[string]bool)}
+}
+
+func TestCheckpointKey(t *testing.T) {
+	tests := []struct {
+		name          string
+		payload       BenchmarkEnginePayload
+		key, sdoField string
+	}{
+		{"task", BenchmarkEnginePayload{TaskID: "task1", JobID: "job1"}, "task1", "benchmarkTaskId"},
+		{"job without a task", BenchmarkEnginePayload{JobID: "job1"}, "job1", "benchmarkJobId"},
+		{"neither", BenchmarkEnginePayload{}, "", "benchmarkJobId"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if key, sdoField := checkpointKey(&test.payload); key != test.key || sdoField != test.sdoField {
+				t.Errorf("checkpointKey() = %s, %s, want %s, %s", key, sdoField, test.key, test.sdoField)
+			}
+		})
+	}
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the local file has an SDO the published schema doesn't return yet
+	previous := newTestCheckpoint(filepath.Join(dir, "task1.jsonl"))
+	if err := previous.markDone(checkpointEntry{TDOID: "tdo2", AssetID: "a3", BaselineAssetID: "b2", SDOID: "s3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var filters []interface{}
+	client, closeServer := testGraphQLServer(t, func(query string, variables map[string]interface{}) interface{} {
+		filters = append(filters, variables["filter"])
+		return map[string]interface{}{"structuredDataObjects": map[string]interface{}{"records": []map[string]interface{}{
+			{"id": "s1", "data": map[string]interface{}{"tdoId": "tdo1", "assetId": "a1", "baselineAssetId": "b1"}},
+			// not a benchmark SDO of an asset
+			{"id": "s2", "data": map[string]interface{}{"tdoId": "tdo1", "name": "summary"}},
+		}}}
+	})
+	defer closeServer()
+
+	ctx := context.Background()
+	cp, err := loadCheckpoint(ctx, client, &BenchmarkEnginePayload{TaskID: "task1", JobID: "job1"}, "schema", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) != 1 || filters[0].(map[string]interface{})["benchmarkTaskId"] != "task1" {
+		t.Errorf("SDO filters = %v, want benchmarkTaskId task1", filters)
+	}
+	tests := []struct {
+		name                     string
+		tdoID, assetID, baseline string
+		assetDone, baselineDone  bool
+	}{
+		{"from the published schema", "tdo1", "a1", "b1", true, true},
+		{"from the checkpoint file", "tdo2", "a3", "b2", true, true},
+		// the same asset on another TDO is another pair
+		{"other TDO", "tdo2", "a1", "b1", false, false},
+		{"not benchmarked", "tdo1", "a2", "b3", false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if done := cp.isAssetDone(test.tdoID, test.assetID); done != test.assetDone {
+				t.Errorf("isAssetDone(%s, %s) = %v, want %v", test.tdoID, test.assetID, done, test.assetDone)
+			}
+			if done := cp.isBaselineDone(test.tdoID, test.baseline); done != test.baselineDone {
+				t.Errorf("isBaselineDone(%s, %s) = %v, want %v", test.tdoID, test.baseline, done, test.baselineDone)
+			}
+		})
+	}
+	references := cp.sdoReferences("schema")
+	if len(references) != 2 || references[0].ID != "s1" || references[1].ID != "s3" {
+		t.Errorf("sdoReferences() = %+v, want s1 and s3", references)
+	}
+
+	// a test task writes no SDO, so only the file is read
+	filters = nil
+	cp, err = loadCheckpoint(ctx, client, &BenchmarkEnginePayload{TaskID: "task1", Test: true}, "schema", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) != 0 || cp.isAssetDone("tdo1", "a1") || !cp.isAssetDone("tdo2", "a3") {
+		t.Errorf("a test task fetched %d SDO pages, want the checkpoint file only", len(filters))
+	}
+
+	// without a task or job there is nothing to resume
+	cp, err = loadCheckpoint(ctx, client, &BenchmarkEnginePayload{}, "schema", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cp.assets) != 0 || cp.file != "" {
+		t.Errorf("checkpoint without a key = %+v", cp)
+	}
+}
+
+func TestCheckpointMarkDone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "nested", "task.jsonl")
+
+	cp := newTestCheckpoint(file)
+	for _, entry := range []checkpointEntry{{TDOID: "tdo1", AssetID: "a1", BaselineAssetID: "b1", SDOID: "s1"}, {TDOID: "tdo1", AssetID: "a2", BaselineAssetID: "b1", SDOID: "s2"}} {
+		if err := cp.markDone(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a line cut short by a kill is skipped
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"tdoId":"tdo1","assetId":"a`)
+	f.Close()
+
+	retried := newTestCheckpoint(file)
+	if err := retried.loadFromFile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(retried.assets) != 2 || !retried.isAssetDone("tdo1", "a2") || !retried.isBaselineDone("tdo1", "b1") {
+		t.Errorf("assets = %+v, want a1 and a2", retried.assets)
+	}
+
+	// without a checkpoint directory the entries are only kept in memory
+	inMemory := newTestCheckpoint("")
+	if err := inMemory.markDone(checkpointEntry{TDOID: "tdo1", AssetID: "a1"}); err != nil || !inMemory.isAssetDone("tdo1", "a1") {
+		t.Errorf("markDone() = %v, want the asset done", err)
+	}
+	var none *checkpoint
+	if none.markDone(checkpointEntry{TDOID: "tdo1", AssetID: "a1"}) != nil || none.isAssetDone("tdo1", "a1") || none.isBaselineDone("tdo1", "b1") || none.sdoReferences("schema") != nil {
+		t.Error("a nil checkpoint has nothing done")
+	}
+}
+
+func TestInfoMessageReportsSkipped(t *testing.T) {
+	tests := []struct {
+		name    string
+		summary benchmarkSummary
+		want    string
+	}{
+		{"resumed", benchmarkSummary{BenchmarkedAssets: 2, SkippedAssets: 3, SkippedBaselineAssets: 1}, "Benchmarked 2 assets, skipped 3 assets and 1 baseline assets already benchmarked by a previous attempt"},
+		{"first attempt", benchmarkSummary{BenchmarkedAssets: 2}, "Benchmarked 2 assets"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := test.summary.infoMessage()
+			if !strings.Contains(message, test.want) || (test.summary.SkippedAssets == 0 && strings.Contains(message, "skipped")) {
+				t.Errorf("infoMessage() = %q, want %q", message, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckpointJobsSurviveRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "task.jsonl")
+	previous := newTestCheckpoint(file)
+	if err := previous.markJob("tdo1", "job1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := previous.markDone(checkpointEntry{TDOID: "tdo1", AssetID: "a1", SDOID: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cp := newTestCheckpoint(file)
+	if err := cp.loadFromFile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		tdoID, jobID string
+	}{
+		{"tdo1", "job1"},
+		{"tdo2", ""},
+	}
+	for _, test := range tests {
+		if jobID := cp.jobID(test.tdoID); jobID != test.jobID {
+			t.Errorf("jobID(%s) = %q, want %q", test.tdoID, jobID, test.jobID)
+		}
+	}
+	// the job line is not an asset of the TDO
+	if len(cp.assets) != 1 || !cp.isAssetDone("tdo1", "a1") {
+		t.Errorf("assets = %+v, want a1 only", cp.assets)
+	}
+	var none *checkpoint
+	if none.jobID("tdo1") != "" || none.markJob("tdo1", "job1") != nil {
+		t.Error("a nil checkpoint records no job")
+	}
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/urfave/cli"
@@ -18,6 +22,17 @@ type ManagerConfig struct {
 	APIOptions        platform.ApiOptions `json:"api"`
 	LocalAPIOptions   api.Options         `json:"localApi"`
 	DataRegistryIDs   DataRegistryIDs     `json:"dataRegistryIds"`
+	// CheckpointDir where the completed assets of each task are recorded, so a retried task can resume
+	CheckpointDir string `json:"checkpointDir"`
+	// ScliteFQN the sclite executable used for scoring
+	ScliteFQN string `json:"scliteFQN"`
+	// AssetBatchSize how many assets are fetched per GraphQL request
+	AssetBatchSize int `json:"assetBatchSize"`
+	// AssetCache the optional on-disk cache of fetched and compiled assets
+	AssetCache AssetCacheConfig `json:"assetCache"`
+	// AutoProvision create the missing data registry of a task category, or find it by name, and publish its schema.
+	// Its ID is used by the task only, the provision command stores it in the config file.
+	AutoProvision bool `json:"autoProvision"`
 }
 
 // AppContext the context
@@ -34,6 +49,10 @@ type AppContext struct {
 	TrainingWorkflowObj persistence.TrainingWorkflowSDO
 	TrainingWorkflowRef persistence.SDOReference
 	Config              ManagerConfig
+	// Logger the logger of the running task, carrying its correlation fields
+	Logger *jsonLogger
+	// AssetCache the asset cache of the running task, nil when disabled
+	AssetCache *assetCache
 }
 
 // DataRegistryIDs ID for Transcription and FaceDetection
@@ -42,3 +61,227 @@ type DataRegistryIDs struct {
 	Transcription string `json:"transcription"`
 	FaceDetection string `json:"faceDetection"`
 }
+
+const (
+	// defaultConfigFile the config file read when CONFIG_FILE is not set
+	defaultConfigFile = "./config.json"
+	// defaultAssetBatchSize how many assets are fetched per GraphQL request by default
+	defaultAssetBatchSize = 25
+)
+
+// configError lists every problem found in the engine config
+type configError struct {
+	problems []string
+}
+
+func (e *configError) Error() string {
+	return "Invalid engine config: " + strings.Join(e.problems, "; ")
+}
+
+func (e *configError) add(format string, args ...interface{}) {
+	e.problems = append(e.problems, fmt.Sprintf(format, args...))
+}
+
+// orNil returns the error when at least one problem was found
+func (e *configError) orNil() error {
+	if len(e.problems) == 0 {
+		return nil
+	}
+	return e
+}
+
+// defaultConfig the config values used when neither the config file nor the environment set them
+func defaultConfig() ManagerConfig {
+	return ManagerConfig{
+		EngineID:       benchmarkEngineID,
+		ScliteFQN:      defaultScliteFQN,
+		AssetBatchSize: defaultAssetBatchSize,
+	}
+}
+
+// loadConfig layer the defaults, the config file and the environment variables, then validate the result.
+// Unknown keys in the config file are rejected.
+func loadConfig() (ManagerConfig, error) {
+	res := defaultConfig()
+
+	configFile, explicitFile := configFilePath()
+	if err := decodeConfigFile(configFile, explicitFile, &res); err != nil {
+		return res, err
+	}
+
+	applyConfigEnv(&res)
+
+	return res, validateConfig(res)
+}
+
+// configFilePath the config file at CONFIG_FILE, or the default one when it is not set
+func configFilePath() (configFile string, explicit bool) {
+	if configFile := os.Getenv("CONFIG_FILE"); configFile != "" {
+		return configFile, true
+	}
+	return defaultConfigFile, false
+}
+
+// decodeConfigFile decode the config file on top of res. A missing file is only an error if it was explicitly requested.
+func decodeConfigFile(configFile string, required bool, res *ManagerConfig) error {
+	reader, err := os.Open(configFile)
+	if os.IsNotExist(err) && !required {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Failed to open the config file %s: %s", configFile, err)
+	}
+	defer reader.Close()
+
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(res); err != nil {
+		return fmt.Errorf("Failed to parse the config file %s: %s", configFile, err)
+	}
+	return nil
+}
+
+// applyConfigEnv override the config with the environment variables set on the engine container
+func applyConfigEnv(res *ManagerConfig) {
+	if localServiceCmd := os.Getenv("LOCAL_SERVICE_CMD"); localServiceCmd != "" {
+		res.LocalServiceCmd = localServiceCmd
+	}
+	if localServiceURL := os.Getenv("LOCAL_SERVICE_URL"); localServiceURL != "" {
+		res.LocalServiceURL = localServiceURL
+	}
+	if engineID := os.Getenv("ENGINE_ID"); engineID != "" {
+		res.EngineID = engineID
+	}
+	if dataRegistryID := os.Getenv("ASSETBENCHMARKDATAREGISTRYID"); dataRegistryID != "" {
+		res.DataRegistryIDs.Transcription = dataRegistryID
+	}
+}
+
+// validateConfig check the fields that do not depend on the task
+func validateConfig(config ManagerConfig) error {
+	problems := &configError{}
+	if config.EngineID == "" {
+		problems.add("engineId is required")
+	}
+	if config.ScliteFQN == "" {
+		problems.add("scliteFQN is required")
+	}
+	if config.AssetBatchSize < 1 {
+		problems.add("assetBatchSize must be at least 1, got %d", config.AssetBatchSize)
+	}
+	if config.AssetCache.TTL != "" {
+		if _, err := time.ParseDuration(config.AssetCache.TTL); err != nil {
+			problems.add("assetCache.ttl is not a valid duration: %s", err)
+		}
+	}
+	if config.AssetCache.MaxSizeMB < 0 {
+		problems.add("assetCache.maxSizeMb must not be negative, got %d", config.AssetCache.MaxSizeMB)
+	}
+	if config.LocalAPIOptions.TimeoutDurationStr != "" {
+		if _, err := time.ParseDuration(config.LocalAPIOptions.TimeoutDurationStr); err != nil {
+			problems.add("localApi.timeoutDurationStr is not a valid duration: %s", err)
+		}
+	}
+	return problems.orNil()
+}
+
+// applyPayloadOverrides complete the config and the payload with each other: the payload provides the platform
+// connection, the config provides the data registry of the payload category when the payload does not set one
+func applyPayloadOverrides(config *ManagerConfig, enginePayload *BenchmarkEnginePayload) {
+	config.APIOptions.Token = string(enginePayload.Token)
+	config.APIOptions.VeritoneApiBaseUrl = enginePayload.VeritoneAPIBaseURL
+	// TODO: confirm before remove local api
+	config.LocalAPIOptions.Token = string(enginePayload.Token)
+	config.LocalAPIOptions.VeritoneAPIBaseURL = enginePayload.VeritoneAPIBaseURL
+	config.LocalAPIOptions.Debug = config.LocalAPIOptions.Debug || enginePayload.Debug
+
+	// Default to use Translation
+	if enginePayload.TaskPayload.CategoryID == "" {
+		enginePayload.TaskPayload.CategoryID = categoryTranslationID
+	}
+	if enginePayload.TaskPayload.DataRegistryID == "" {
+		enginePayload.TaskPayload.DataRegistryID = config.DataRegistryIDs.forCategory(enginePayload.TaskPayload.CategoryID)
+	}
+}
+
+// validateTaskConfig check the config once the payload overrides were applied
+func validateTaskConfig(config ManagerConfig, enginePayload *BenchmarkEnginePayload) error {
+	problems := &configError{}
+	if config.LocalAPIOptions.VeritoneAPIBaseURL == "" {
+		problems.add("veritoneApiBaseUrl is missing from the payload")
+	}
+	if config.LocalAPIOptions.Token == "" {
+		problems.add("token is missing from the payload")
+	}
+
+	categoryID := enginePayload.TaskPayload.CategoryID
+	switch categoryID {
+	case categoryTranslationID, categoryTranscriptionID, categoryFacialDetectionID:
+	default:
+		problems.add("categoryId %s is not supported", categoryID)
+	}
+	if enginePayload.Test && config.DataRegistryIDs.Transcription == "" {
+		problems.add("dataRegistryIds.transcription (or ASSETBENCHMARKDATAREGISTRYID) is required to run a test")
+	} else if !enginePayload.Test && enginePayload.TaskPayload.DataRegistryID == "" && !config.AutoProvision {
+		problems.add("no data registry for category %s: set taskPayload.dataRegistryId or dataRegistryIds.%s in the config", categoryLabel(categoryID), config.DataRegistryIDs.fieldForCategory(categoryID))
+	}
+	return problems.orNil()
+}
+
+// forCategory the data registry configured for the engine category
+func (ids DataRegistryIDs) forCategory(categoryID string) string {
+	switch categoryID {
+	case categoryTranscriptionID:
+		return ids.Transcription
+	case categoryFacialDetectionID:
+		return ids.FaceDetection
+	}
+	return ids.Translation
+}
+
+// fieldForCategory the config field holding the data registry of the engine category
+func (ids DataRegistryIDs) fieldForCategory(categoryID string) string {
+	switch categoryID {
+	case categoryTranscriptionID:
+		return "transcription"
+	case categoryFacialDetectionID:
+		return "faceDetection"
+	}
+	return "translation"
+}
+
+// redacted a copy of the config safe to display
+func (config ManagerConfig) redacted() ManagerConfig {
+	if config.APIOptions.Token != "" {
+		config.APIOptions.Token = redactedValue
+	}
+	if config.LocalAPIOptions.Token != "" {
+		config.LocalAPIOptions.Token = redactedValue
+	}
+	return config
+}
+
+// configCommand the `config` CLI command
+func configCommand() cli.Command {
+	return cli.Command{
+		Name:  "config",
+		Usage: "Inspect the engine config",
+		Subcommands: []cli.Command{
+			{
+				Name:  "print",
+				Usage: "Print the effective config (defaults, config file and environment) with secrets redacted",
+				Action: func(c *cli.Context) error {
+					config, err := loadConfig()
+					b, marshalErr := json.MarshalIndent(config.redacted(), "", "    ")
+					if marshalErr != nil {
+						return marshalErr
+					}
+					fmt.Println(string(b))
+					if err != nil {
+						return cli.NewExitError(err.Error(), 1)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
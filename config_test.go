@@ -0,0 +1,196 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// inTestDir runs the test in an empty directory, so the default config file is missing until the test writes it
+func inTestDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLoadConfigLayers(t *testing.T) {
+	defer inTestDir(t)()
+	for _, key := range []string{"CONFIG_FILE", "ENGINE_ID", "ASSETBENCHMARKDATAREGISTRYID", "LOCAL_SERVICE_CMD", "LOCAL_SERVICE_URL"} {
+		defer setTestEnv(key, "")()
+	}
+
+	// without the default file, the defaults
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig() without the default file = %v", err)
+	}
+	if config.EngineID != benchmarkEngineID || config.ScliteFQN != defaultScliteFQN || config.AssetBatchSize != defaultAssetBatchSize {
+		t.Errorf("defaults = %+v", config)
+	}
+
+	// the file over the defaults
+	file := `{"engineId": "file-engine", "assetBatchSize": 10, "dataRegistryIds": {"transcription": "file-registry", "translation": "file-translation"}}`
+	if err := ioutil.WriteFile(defaultConfigFile, []byte(file), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err = loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.EngineID != "file-engine" || config.AssetBatchSize != 10 || config.DataRegistryIDs.Transcription != "file-registry" || config.ScliteFQN != defaultScliteFQN {
+		t.Errorf("config of the file = %+v", config)
+	}
+
+	// the environment over the file
+	defer setTestEnv("ENGINE_ID", "env-engine")()
+	defer setTestEnv("ASSETBENCHMARKDATAREGISTRYID", "env-registry")()
+	config, err = loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.EngineID != "env-engine" || config.DataRegistryIDs.Transcription != "env-registry" || config.DataRegistryIDs.Translation != "file-translation" || config.AssetBatchSize != 10 {
+		t.Errorf("config of the environment = %+v", config)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	defer inTestDir(t)()
+	tests := []struct {
+		name       string
+		file       string
+		configFile string
+		want       string
+	}{
+		{"unknown key", `{"engineId": "e", "sclitePath": "/usr/bin/sclite"}`, "", `unknown field "sclitePath"`},
+		{"not JSON", `engineId: e`, "", "Failed to parse the config file ./config.json"},
+		{"explicit file missing", "", "missing.json", "Failed to open the config file missing.json"},
+		{"invalid values", `{"assetBatchSize": -1, "assetCache": {"ttl": "soon", "maxSizeMb": -5}}`, "", "assetBatchSize must be at least 1, got -1; assetCache.ttl is not a valid duration"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Remove(defaultConfigFile)
+			if test.file != "" {
+				if err := ioutil.WriteFile(defaultConfigFile, []byte(test.file), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			defer setTestEnv("CONFIG_FILE", test.configFile)()
+			if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("loadConfig() = %v, want %q", err, test.want)
+			}
+		})
+	}
+
+	// an explicit file is read instead of the default one
+	if err := ioutil.WriteFile("explicit.json", []byte(`{"engineId": "explicit"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer setTestEnv("CONFIG_FILE", "explicit.json")()
+	if config, err := loadConfig(); err != nil || config.EngineID != "explicit" {
+		t.Errorf("loadConfig() = %+v, %v, want the explicit file", config, err)
+	}
+}
+
+func TestValidateTaskConfig(t *testing.T) {
+	var connected ManagerConfig
+	connected.LocalAPIOptions.VeritoneAPIBaseURL = "https://api.veritone.com"
+	connected.LocalAPIOptions.Token = "token"
+
+	tests := []struct {
+		name       string
+		config     ManagerConfig
+		payload    BenchmarkEnginePayload
+		wantErrors []string
+	}{
+		{"registry of the payload", connected, BenchmarkEnginePayload{TaskPayload: TaskPayload{CategoryID: categoryTranslationID, DataRegistryID: "registry"}}, nil},
+		{
+			"no translation registry", connected, BenchmarkEnginePayload{TaskPayload: TaskPayload{CategoryID: categoryTranslationID}},
+			[]string{"no data registry for category translation: set taskPayload.dataRegistryId or dataRegistryIds.translation in the config"},
+		},
+		{
+			"no transcription registry", connected, BenchmarkEnginePayload{TaskPayload: TaskPayload{CategoryID: categoryTranscriptionID}},
+			[]string{"no data registry for category transcription: set taskPayload.dataRegistryId or dataRegistryIds.transcription in the config"},
+		},
+		{
+			"no face detection registry", connected, BenchmarkEnginePayload{TaskPayload: TaskPayload{CategoryID: categoryFacialDetectionID}},
+			[]string{"no data registry for category face_detection: set taskPayload.dataRegistryId or dataRegistryIds.faceDetection in the config"},
+		},
+		{"auto provision", ManagerConfig{LocalAPIOptions: connected.LocalAPIOptions, AutoProvision: true}, BenchmarkEnginePayload{TaskPayload: TaskPayload{CategoryID: categoryTranscriptionID}}, nil},
+		{
+			"test without the transcription registry", connected, BenchmarkEnginePayload{Test: true, TaskPayload: TaskPayload{CategoryID: categoryTranslationID, DataRegistryID: "registry"}},
+			[]string{"dataRegistryIds.transcription (or ASSETBENCHMARKDATAREGISTRYID) is required to run a test"},
+		},
+		{
+			"no platform", ManagerConfig{}, BenchmarkEnginePayload{TaskPayload: TaskPayload{CategoryID: "other", DataRegistryID: "registry"}},
+			[]string{"veritoneApiBaseUrl is missing from the payload", "token is missing from the payload", "categoryId other is not supported"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateTaskConfig(test.config, &test.payload)
+			if test.wantErrors == nil {
+				if err != nil {
+					t.Errorf("validateTaskConfig() = %v", err)
+				}
+				return
+			}
+			if want := "Invalid engine config: " + strings.Join(test.wantErrors, "; "); err == nil || err.Error() != want {
+				t.Errorf("validateTaskConfig() = %v, want %q", err, want)
+			}
+		})
+	}
+}
+
+func TestApplyPayloadOverridesPicksTheCategoryRegistry(t *testing.T) {
+	config := ManagerConfig{DataRegistryIDs: DataRegistryIDs{Translation: "translation", Transcription: "transcription", FaceDetection: "faces"}}
+	tests := []struct {
+		categoryID, registryID, want string
+	}{
+		{"", "", "translation"},
+		{categoryTranscriptionID, "", "transcription"},
+		{categoryFacialDetectionID, "", "faces"},
+		{categoryTranscriptionID, "payload", "payload"},
+	}
+	for _, test := range tests {
+		payload := &BenchmarkEnginePayload{Token: "token", TaskPayload: TaskPayload{CategoryID: test.categoryID, DataRegistryID: test.registryID}}
+		applyPayloadOverrides(&config, payload)
+		if payload.TaskPayload.DataRegistryID != test.want {
+			t.Errorf("registry of category %q = %q, want %q", test.categoryID, payload.TaskPayload.DataRegistryID, test.want)
+		}
+	}
+	if config.APIOptions.Token != "token" || config.LocalAPIOptions.Token != "token" {
+		t.Errorf("tokens = %q, %q, want the payload token", config.APIOptions.Token, config.LocalAPIOptions.Token)
+	}
+}
+
+func TestConfigRedacted(t *testing.T) {
+	config := ManagerConfig{EngineID: "engine"}
+	config.APIOptions.Token = "secret"
+	config.LocalAPIOptions.Token = "secret"
+
+	redacted := config.redacted()
+	if redacted.APIOptions.Token != redactedValue || redacted.LocalAPIOptions.Token != redactedValue || redacted.EngineID != "engine" {
+		t.Errorf("redacted() = %+v", redacted)
+	}
+	// a copy, the config keeps its tokens
+	if config.APIOptions.Token != "secret" || config.LocalAPIOptions.Token != "secret" {
+		t.Error("redacted() changed the config")
+	}
+	// an unset token stays unset rather than looking set
+	if redacted := (ManagerConfig{}).redacted(); redacted.APIOptions.Token != "" || redacted.LocalAPIOptions.Token != "" {
+		t.Errorf("redacted() of a config without tokens = %+v", redacted)
+	}
+}
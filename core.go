@@ -11,11 +11,11 @@ import (
 	"math"
 	"os"
 	"os/exec"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
-	uuid "github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/veritone/translation-benchmark/api"
 )
@@ -44,6 +44,88 @@ type results struct {
 
 	Words []word `json:"words,omitempty"`
 }
+
+// benchmarkSummary what the benchmark did, reported in the final task status
+type benchmarkSummary struct {
+	BenchmarkedAssets     int
+	SkippedAssets         int
+	SkippedBaselineAssets int
+	CacheHits             int
+	CacheMisses           int
+	// DuplicateAssets the outputs set aside by the duplicate asset policy
+	DuplicateAssets int
+	// Calibration the scored words of each engine, by engine ID
+	Calibration map[string]*engineCalibration
+	// Timing the word timing errors of each engine, by engine ID, checked against TimingTolerancesMs
+	Timing             map[string]*engineTiming
+	TimingTolerancesMs []int
+	// Performance the speed of each engine version, by engine ID and deployed version
+	Performance map[string]*enginePerformance
+	// Models the metrics of the benchmarked assets of each model ID, or engine ID without a model
+	Models map[string]*modelMetrics
+	// CandidateModelID the model benchmarked by the training mode
+	CandidateModelID string
+	// Comparison the comparison of the compare-tasks mode, which benchmarks nothing
+	Comparison *taskComparison
+	// Rankings and Decisions the champion/challenger selection among the models of each engine
+	Rankings  []modelRanking
+	Decisions []promotionDecision
+}
+
+// infoMessage the info message of the completed task
+func (s *benchmarkSummary) infoMessage() string {
+	if s.Comparison != nil {
+		return "Engine run successfully. " + s.Comparison.message()
+	}
+	msg := fmt.Sprintf("Engine run successfully. Benchmarked %d assets", s.BenchmarkedAssets)
+	if s.CandidateModelID != "" {
+		msg += fmt.Sprintf(", %d of the candidate model %s", s.modelAssets(s.CandidateModelID), s.CandidateModelID)
+	}
+	if s.SkippedAssets > 0 || s.SkippedBaselineAssets > 0 {
+		msg += fmt.Sprintf(", skipped %d assets and %d baseline assets already benchmarked by a previous attempt", s.SkippedAssets, s.SkippedBaselineAssets)
+	}
+	if s.DuplicateAssets > 0 {
+		msg += fmt.Sprintf(", set aside %d duplicate assets", s.DuplicateAssets)
+	}
+	if s.CacheHits > 0 || s.CacheMisses > 0 {
+		msg += fmt.Sprintf(", asset cache: %d hits, %d misses", s.CacheHits, s.CacheMisses)
+	}
+	if calibration := calibrationSummary(s.Calibration); calibration != "" {
+		msg += ". Confidence calibration: " + calibration
+	}
+	if timing := timingSummary(s.Timing, s.TimingTolerancesMs); timing != "" {
+		msg += ". Word timing: " + timing
+	}
+	if performance := performanceSummary(s.Performance); performance != "" {
+		msg += ". Speed: " + performance
+	}
+	if selection := selectionSummary(s.Rankings, s.Decisions); selection != "" {
+		msg += ". Model selection: " + selection
+	}
+	return msg
+}
+
+// addCalibration add the scored words of an asset to the calibration of its engine
+func (s *benchmarkSummary) addCalibration(engineID, engineName string, scored []scoredWord) {
+	calibration, ok := s.Calibration[engineID]
+	if !ok {
+		calibration = &engineCalibration{engineName: engineName}
+		s.Calibration[engineID] = calibration
+	}
+	calibration.words = append(calibration.words, scored...)
+}
+
+// addTiming add the word timing errors of an asset to the timing of its engine
+func (s *benchmarkSummary) addTiming(engineID, engineName string, wordErrors *timingErrors) {
+	timing, ok := s.Timing[engineID]
+	if !ok {
+		timing = &engineTiming{engineName: engineName}
+		s.Timing[engineID] = timing
+	}
+	timing.words.onsets = append(timing.words.onsets, wordErrors.onsets...)
+	timing.words.offsets = append(timing.words.offsets, wordErrors.offsets...)
+}
+
 type word struct {
 	Action     string `json:"action,omitempty"`
 	Reference  string `json:"reference,omitempty"`
@@ -52,196 +134,326 @@ type word struct {
 
 // invokeService is the core logic entrypoint for the engine. It will setup the payload data accordingly,
 // pass it to the benchmark engine, and generate the benchmark SDO
-func invokeService(shutdownCtx context.Context, graphQLClient *api.PlatformGraphQLClient, enginePayload *BenchmarkEnginePayload) (err error) {
+func invokeService(shutdownCtx context.Context, graphQLClient *api.PlatformGraphQLClient, enginePayload *BenchmarkEnginePayload) (summary *benchmarkSummary, err error) {
+	logger := logFrom(shutdownCtx)
 	var benchmarkDataRegistryID = enginePayload.TaskPayload.DataRegistryID
 	var benchmarkSchemaID string
+	var cp *checkpoint
 
-	// Check that the payload has assets in it. There must be at least 1 asset in both payload fields.
-	if len(enginePayload.TaskPayload.AssetIDs) == 0 || len(enginePayload.TaskPayload.BaselineAssetIDs) == 0 {
-		return fmt.Errorf("Expected an array of assetIDs and baseline assetIDs provided in the payload, but instead got %d assetIDs and %d baseline assetIDs",
-			len(enginePayload.TaskPayload.AssetIDs), len(enginePayload.TaskPayload.BaselineAssetIDs))
+	// Report the outcome, failures included, to the training workflow the task belongs to
+	defer func() {
+		if updateErr := updateTrainingSDO(shutdownCtx, graphQLClient, enginePayload, benchmarkSchemaID, summary, cp, err); updateErr != nil {
+			if err != nil {
+				logger.Warnf("Failed to report the failure to the training SDO due to: %s", updateErr)
+				return
+			}
+			summary, err = nil, updateErr
+		}
+	}()
+
+	// The payload was validated for its mode before the task started
+	modeName, err := payloadMode(enginePayload)
+	if err != nil {
+		return nil, err
 	}
+	mode := benchmarkModes[modeName]
+	logger.Infof("Running the benchmark in the %s mode", modeName)
 
 	// Get the benchmark data registry ID
 	if enginePayload.Test {
-		fmt.Printf("For test, setting asset benchmark data registry ID: %s\n", myAppContext.Config.DataRegistryIDs.Transcription)
+		logger.Infof("For test, setting asset benchmark data registry ID: %s", myAppContext.Config.DataRegistryIDs.Transcription)
 		benchmarkDataRegistryID = myAppContext.Config.DataRegistryIDs.Transcription
-	} else {
-		if enginePayload.TaskPayload.DataRegistryID == "" {
-			return fmt.Errorf("[ERROR] Unable to find a data registry ID to write benchmark data to. enginePayload: %+v", enginePayload)
+	} else if myAppContext.Config.AutoProvision {
+		// Create what is missing of the data registry on a fresh environment. The registry is found again by its name
+		// by the next tasks, only the provision command stores its ID in the config file.
+		benchmarkDataRegistryID, benchmarkSchemaID, err = provisionBenchmarkSchema(shutdownCtx, graphQLClient, enginePayload.TaskPayload.CategoryID, benchmarkDataRegistryID)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to provision the benchmark data registry")
 		}
+	} else if enginePayload.TaskPayload.DataRegistryID == "" {
+		return nil, fmt.Errorf("[ERROR] Unable to find a data registry ID to write benchmark data to. enginePayload: %+v", enginePayload)
 	}
 
-	publishedSchema, err := graphQLClient.FetchPublishedSchema(shutdownCtx, benchmarkDataRegistryID)
+	if benchmarkSchemaID == "" {
+		publishedSchema, err := graphQLClient.FetchPublishedSchema(shutdownCtx, benchmarkDataRegistryID)
+		if err != nil {
+			return nil, fmt.Errorf("[ERROR] Failed to fetch the schemas given the data registry ID(%s): %s", benchmarkDataRegistryID, err)
+		} else if publishedSchema.DataRegistryID == "" || publishedSchema.Schema == nil || publishedSchema.Schema.ID == "" {
+			return nil, fmt.Errorf("Unable to find a published schema to use for writing benchmark data using data registry ID: %s. Run `provision` or set autoProvision in the config", benchmarkDataRegistryID)
+		}
+		benchmarkSchemaID = publishedSchema.Schema.ID
+	}
+
+	logger.Infof("BENCHMARK SCHEMA ID FOUND: %s", benchmarkSchemaID)
+	logger.Debugf("task payload: %+v", enginePayload.TaskPayload)
+
+	// Reuse the assets fetched and compiled by previous runs
+	myAppContext.AssetCache, err = newAssetCache(myAppContext.Config.AssetCache)
 	if err != nil {
-		return fmt.Errorf("[ERROR] Failed to fetch the schemas given the data registry ID(%s): %s", benchmarkDataRegistryID, err)
-	} else if publishedSchema.DataRegistryID == "" || publishedSchema.Schema == nil || publishedSchema.Schema.ID == "" {
-		return fmt.Errorf("Unable to find a published schema to use for writing benchmark data using data registry ID: %s", benchmarkDataRegistryID)
+		return nil, errors.Wrap(err, "Failed to open the asset cache")
 	}
-	benchmarkSchemaID = publishedSchema.Schema.ID
 
-	fmt.Printf("[InvokeService] BENCHMARK SCHEMA ID FOUND: %s\n", benchmarkSchemaID)
-	if enginePayload.Debug {
-		fmt.Printf("[InvokeService] [DEBUG] task payload: %+v\n", enginePayload.TaskPayload)
+	// Add the terms of the glossary asset to the glossary of the payload
+	if err := loadGlossary(shutdownCtx, graphQLClient, enginePayload); err != nil {
+		return nil, errors.Wrap(err, "Failed to load the glossary")
 	}
 
-	// Now run the main asset benchmarking logic
-	err = processAssets(shutdownCtx, graphQLClient, enginePayload, benchmarkSchemaID)
+	// Find what a previous attempt of this task already benchmarked
+	cp, err = loadCheckpoint(shutdownCtx, graphQLClient, enginePayload, benchmarkSchemaID, myAppContext.Config.CheckpointDir)
 	if err != nil {
-		return fmt.Errorf("Failed to process assets due to: %s", err)
+		return nil, errors.Wrap(err, "Failed to load the benchmark checkpoint")
 	}
 
-	return nil
+	// Now run the benchmark of the mode
+	summary, err = mode.run(shutdownCtx, graphQLClient, enginePayload, benchmarkSchemaID, cp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to benchmark in the %s mode", modeName)
+	}
+
+	return summary, nil
 }
 
-// processAssets Take a slice of assetIDs from the engine payload and run the benchmark logic.
-func processAssets(shutdownCtx context.Context, graphQLClient *api.PlatformGraphQLClient, enginePayload *BenchmarkEnginePayload, benchmarkSchemaID string) error {
-	assetIDs := enginePayload.TaskPayload.AssetIDs
-	baselineAssetIDs := enginePayload.TaskPayload.BaselineAssetIDs
+// processAssets Take the assetIDs found by the mode and run the benchmark logic against the baseline assets.
+func processAssets(shutdownCtx context.Context, graphQLClient *api.PlatformGraphQLClient, enginePayload *BenchmarkEnginePayload, benchmarkSchemaID string, cp *checkpoint, assetIDs, baselineAssetIDs []string) (*benchmarkSummary, error) {
+	logger := logFrom(shutdownCtx)
 
-	fmt.Printf("[processAssets] Running the asset benchmark for %d assets on %d different baselines\n", len(assetIDs), len(baselineAssetIDs))
+	logger.Infof("Running the asset benchmark for %d assets on %d different baselines", len(assetIDs), len(baselineAssetIDs))
 
 	// Gather all the assets and map them by TDOID
 	// tdoAssetMap - map the TDOID to its corresponding assets and baseline asset
 	// failedAssets - track the list of failed asset IDs
-	tdoAssetMap, failedAssets := gatherAssetsByTDO(shutdownCtx, graphQLClient, enginePayload.TaskID, assetIDs)
+	// skippedAssets - the assets a previous attempt of this task already benchmarked
+	tdoAssetMap, failedAssets, skippedAssets := gatherAssetsByTDO(shutdownCtx, graphQLClient, enginePayload.TaskID, assetIDs, cp)
 
 	// Fetch the baseline asset for each baseline in the array and add it to the map
 
 	// failedBaselineAssets - Track the list of failed baseline assets
-	tdoAssetMap, failedBaselineAssets := gatherBaselineAssets(shutdownCtx, graphQLClient, enginePayload.TaskID, tdoAssetMap, baselineAssetIDs)
-
-	// Benchmark service endpoint
-	// url := myConfig.LocalServiceURL + "/benchmark"
-	// Run the benchmark service individually for each TDO ID
+	tdoAssetMap, failedBaselineAssets, skippedBaselineAssets := gatherBaselineAssets(shutdownCtx, graphQLClient, enginePayload.TaskID, tdoAssetMap, baselineAssetIDs, cp)
+
+	summary := &benchmarkSummary{
+		SkippedAssets:         skippedAssets,
+		SkippedBaselineAssets: skippedBaselineAssets,
+		Calibration:           make(map[string]*engineCalibration),
+		Timing:                make(map[string]*engineTiming),
+		TimingTolerancesMs:    enginePayload.TaskPayload.TimingTolerancesMs,
+		Models:                make(map[string]*modelMetrics),
+		Performance:           make(map[string]*enginePerformance),
+	}
+	summary.CacheHits, summary.CacheMisses = myAppContext.AssetCache.stats()
+	// The models are ranked and the winner picked on the outputs of the previous attempts of the task too
+	summary.addCheckpointedModels(cp)
+	if shutdownCtx.Err() != nil {
+		return nil, errors.Wrap(errInterrupted, "no TDO was benchmarked")
+	}
+
+	// Run the benchmark individually for each TDO ID
+	category := categoryLabel(enginePayload.TaskPayload.CategoryID)
+	glossary := compileGlossary(enginePayload.TaskPayload.Glossary)
+	var duplicates duplicateRules
+	if enginePayload.TaskPayload.DuplicateAssets != nil {
+		duplicates = *enginePayload.TaskPayload.DuplicateAssets
+	}
+	var processedTDOs int
+	var interrupted bool
 	for TDOID, tdoAssets := range tdoAssetMap {
-		fmt.Printf("[processAssets] Benchmarking assets for TDOID %s\n", TDOID)
+		if shutdownCtx.Err() != nil {
+			interrupted = true
+			break
+		}
+
+		tdoCtx := withLogger(shutdownCtx, logger.with("tdoId", TDOID))
+		logFrom(tdoCtx).Infof("Benchmarking assets for TDOID %s", TDOID)
 		if tdoAssets.baselineAsset == nil {
 			// must have the baseline asset to perform benchmarking
 			for _, asset := range tdoAssets.assets {
 				failedAssets = append(failedAssets, asset.ID)
 			}
+			processedTDOs++
 			continue
 		}
 
-		// Format all the asset outputs to fit the format of the local benchmark service
+		// Choose among the outputs of the engines with several outputs on the TDO
+		kept, selections, dropped := selectDuplicates(tdoAssets.assets, duplicates)
+		if len(dropped) > 0 {
+			logFrom(tdoCtx).Infof("Set aside %d duplicate assets with the %s policy: %v", len(dropped), duplicates.Policy, dropped)
+			summary.DuplicateAssets += len(dropped)
+		}
+		tdoAssets.assets = kept
+
+		// Time the tasks that produced the outputs
+		performance := fetchPerformance(tdoCtx, graphQLClient, TDOID, tdoAssets)
+
+		// Format all the asset outputs to fit the format of the benchmark
 		engineOutputs, newIDToEngineID := formatBenchmarkEngineOutputsPayload(tdoAssets)
+		newIDs := make([]string, 0, len(engineOutputs))
+		for newID := range engineOutputs {
+			newIDs = append(newIDs, newID)
+		}
+		sort.Strings(newIDs)
+
+		reference := sanitize(tdoAssets.baselineAsset.Transcript)
+
+		sdos := make([]AssetBenchmarkSDODataForTranscription, 0, len(engineOutputs))
+		for _, newID := range newIDs {
+			engineOutput := engineOutputs[newID]
+			assetCtx := withLogger(tdoCtx, logFrom(tdoCtx).with("assetId", engineOutput.AssetID))
+			scoringStart := time.Now()
+			hypothesis := sanitize(engineOutput.Output)
+			result, err := sclite(assetCtx, true, []byte(reference), []byte(hypothesis))
+			if err != nil {
+				if shutdownCtx.Err() != nil {
+					interrupted = true
+					break
+				}
+				logFrom(assetCtx).Warnf("Couldn't benchmark asset(%s) due to: %s", engineOutput.AssetID, err)
+				assetFailuresTotal.WithLabelValues(category, "scoring_failed").Inc()
+				failedAssets = append(failedAssets, engineOutput.AssetID)
+				continue
+			}
+			scoringDuration.WithLabelValues(category).Observe(time.Since(scoringStart).Seconds())
+			asset := tdoAssets.asset(engineOutput.AssetID)
+			engineID := newIDToEngineID[newID]
+			newSDO := newAssetBenchmarkSDO(enginePayload, TDOID, tdoAssets.baselineAsset.ID, engineID, engineOutput, result)
+			newSDO.Selection = selections[engineOutput.AssetID]
+			if metrics, ok := performance[engineOutput.AssetID]; ok {
+				newSDO.Performance = metrics
+				newSDO.ProcessingTimeMS = metrics.ProcessingTimeMs
+				summary.addPerformance(engineID, engineOutput.EngineName, engineOutput.DeployedVersion, metrics, newSDO.WordErrorRate)
+			}
+			bleu := newBleuStats(strings.Fields(reference), strings.Fields(hypothesis))
+			newSDO.BLEU, newSDO.BLEUStats = bleu.sentenceScore(), &bleu
+			if enginePayload.TaskPayload.Oracle {
+				// Score the best path reachable through the alternatives of the output
+				newSDO.Oracle = newOracleMetrics(reference, asset, result)
+			}
+			// Attribute the words to the speakers of the baseline
+			newSDO.Speakers = newSpeakerMetrics(tdoAssets.baselineAsset, asset, result.Words)
+			// Break down by language and flag the segments off the target language
+			newSDO.Languages = newLanguageMetrics(tdoAssets.baselineAsset, asset, result.Words, enginePayload.TaskPayload.TargetLanguage)
+			if newSDO.Languages != nil && newSDO.Languages.OffTargetSegments > 0 {
+				logFrom(assetCtx).Warnf("Asset(%s) has %d segments not in the target language %s", engineOutput.AssetID, newSDO.Languages.OffTargetSegments, newSDO.Languages.TargetLanguage)
+			}
+			// Check the glossary terms of the baseline
+			newSDO.Glossary = newGlossaryMetrics(glossary, reference, hypothesis, result.Words)
+			if rules := enginePayload.TaskPayload.Subtitles; rules != nil {
+				newSDO.Subtitles = newSubtitleMetrics(tdoAssets.baselineAsset, asset, *rules)
+			}
+			// Check the timing of the correct words and their segments
+			timing, wordTimingErrors := newTimingMetrics(tdoAssets.baselineAsset, asset, result.Words, enginePayload.TaskPayload.TimingTolerancesMs)
+			if timing != nil {
+				newSDO.Timing = timing
+				summary.addTiming(engineID, engineOutput.EngineName, wordTimingErrors)
+			}
+			// Flag the obvious failures: empty, truncated, untranslated or looping outputs
+			newSDO.QA = newQAMetrics(tdoAssets.baselineAsset, asset, reference, hypothesis, engineOutput.Output, enginePayload.TaskPayload.TargetLanguage)
+			warnings := newSDO.QA.warnings()
+			checks := make([]string, 0, len(warnings))
+			for check := range warnings {
+				checks = append(checks, check)
+			}
+			sort.Strings(checks)
+			for _, check := range checks {
+				logFrom(assetCtx).Warnf("QA check %s flagged asset(%s): %s", check, engineOutput.AssetID, warnings[check])
+				if err := appendQAWarning(assetCtx, graphQLClient, enginePayload.TaskID, engineOutput.AssetID, check, warnings[check]); err != nil {
+					logFrom(assetCtx).Warnf("Failed to update the running task with a QA warning due to: %s", err)
+				}
+			}
+			// Check the word confidences against the alignment
+			if asset != nil {
+				if scored := alignConfidences(asset.Words, result.Words); scored != nil {
+					newSDO.Calibration = newCalibrationMetrics(scored)
+					summary.addCalibration(engineID, engineOutput.EngineName, scored)
+				} else {
+					logFrom(assetCtx).Debugf("No word confidence to calibrate for asset(%s)", engineOutput.AssetID)
+				}
+			}
+			summary.addModel(newSDO.TDOID, newSDO.AssetID, scoresOf(newSDO))
+			sdos = append(sdos, newSDO)
+		}
+
+		// Write what was computed for this TDO, even when a shutdown interrupted the scoring
+		failedSDOs := persistBenchmarkSDOs(tdoCtx, graphQLClient, enginePayload, benchmarkSchemaID, sdos, cp)
+		failedAssets = append(failedAssets, failedSDOs...)
+		summary.BenchmarkedAssets += len(sdos) - len(failedSDOs)
+		assetsBenchmarkedTotal.WithLabelValues(category).Add(float64(len(sdos) - len(failedSDOs)))
+		if interrupted {
+			break
+		}
+		processedTDOs++
+	}
 
-		fmt.Printf("=============== %v", engineOutputs)
-		fmt.Printf("+++++++++++++++ %v", newIDToEngineID)
-
-		// Prepare the benchmark service payload
-		// benchmarkServicePayload := BenchmarkServicePostPayload{
-		// 	EngineOutputs: engineOutputs,
-		// 	GroundTruth:   tdoAssets.baselineAsset.Transcript,
-		// 	TdoID:         TDOID,
-		// 	ScliteFQN:     "sclite",
-		// }
-
-		// sclite(myAppContext, true, []byte(engineOutputs), []byte(tdoAssets.baselineAsset.Transcript))
-		// TODO: remove callBenchmarkService and use sclite instead
-		// resultArray, err := callBenchmarkService(url, &benchmarkServicePayload, myConfig.LocalServiceRetry, enginePayload.Debug)
-		// if err != nil {
-		// 	fmt.Printf("[processAssets] [WARNING] Couldn't benchmark due to: %s\n", err)
-		// 	for _, asset := range tdoAssets.assets {
-		// 		failedAssets = append(failedAssets, asset.ID)
-		// 	}
-		// 	continue
-		// } else if len(resultArray) == 0 {
-		// 	fmt.Printf("[processAssets] [WARNING] No benchmarks recieved from the benchmark service!")
-		// 	for _, asset := range tdoAssets.assets {
-		// 		failedAssets = append(failedAssets, asset.ID)
-		// 	}
-		// 	continue
-		// }
-
-		// for _, result := range resultArray {
-		// 	engineID := newIDToEngineID[result.EngineID]
-
-		// 	newSDO := AssetBenchmarkSDODataForTranscription{
-		// 		BenchmarkJobID:  enginePayload.JobID,
-		// 		BenchmarkTaskID: enginePayload.TaskID,
-		// 		TDOID:           TDOID,
-		// 		AssetID:         result.AssetID,
-		// 		ModelID:         result.ModelID,
-		// 		EngineID:        engineID,
-		// 		OrganizationID:  enginePayload.OrganizationID,
-		// 		BaselineAssetID: tdoAssets.baselineAsset.ID,
-		// 		EngineName:      result.EngineName,
-		// 		DeployedVersion: result.DeployedVersion,
-		// 		// Metrics
-		// 		Accuracy:      result.Accuracy,
-		// 		Precision:     result.Precision,
-		// 		Recall:        result.Recall,
-		// 		WordErrorRate: result.WER,
-		// 	}
-
-		// 	// If a training SDO was passed, include the reference
-		// 	if enginePayload.TaskPayload.TrainingWorkflowSDOID != "" && enginePayload.TaskPayload.TrainingWorkflowSDOSchemaID != "" {
-		// 		newSDO.TrainingSDO = &SDOReference{
-		// 			ID:       enginePayload.TaskPayload.TrainingWorkflowSDOID,
-		// 			SchemaID: enginePayload.TaskPayload.TrainingWorkflowSDOSchemaID,
-		// 		}
-		// 	}
-
-		// 	if !enginePayload.Test {
-		// 		sdo, err := graphQLClient.CreateSDO(shutdownCtx, benchmarkSchemaID, newSDO)
-		// 		if err != nil {
-		// 			failedAssets = append(failedAssets, newSDO.AssetID)
-		// 			fmt.Printf("[processAssets] [ERROR] Error creating the benchmark SDO for asset(%s) due to: %s", newSDO.AssetID, err)
-		// 		} else {
-		// 			fmt.Printf("[processAssets] Benchmark SDO for asset(%s) successfully created with ID: %s\n", newSDO.AssetID, sdo.ID)
-		// 		}
-		// 	} else {
-		// 		fmt.Printf("[processAssets] This is a test, but the SDO would have been created...SDO: %+v\n", newSDO)
-		// 	}
-		// }
+	if interrupted {
+		return nil, errors.Wrapf(errInterrupted, "%d of %d TDOs were benchmarked", processedTDOs, len(tdoAssetMap))
 	}
 
 	if len(failedAssets) > 0 || len(failedBaselineAssets) > 0 {
-		fmt.Printf("[processAssets] [ERROR] Some of the assets failed to benchmark. Here is the list...\n Assets: %+v\nBaseline Assets: %+v\n", failedAssets, failedBaselineAssets)
-		return fmt.Errorf("Too many assets failed to benchmark. Assets: %v, Baseline Assets: %v", failedAssets, failedBaselineAssets)
+		logger.Errorf("Some of the assets failed to benchmark. Here is the list...\n Assets: %+v\nBaseline Assets: %+v", failedAssets, failedBaselineAssets)
+		return nil, fmt.Errorf("Too many assets failed to benchmark. Assets: %v, Baseline Assets: %v", failedAssets, failedBaselineAssets)
 	}
 
-	return nil
+	// Rank the models of each engine and decide whether the challengers replace the champions
+	rules := promotionRules{}
+	if enginePayload.TaskPayload.Promotion != nil {
+		rules = *enginePayload.TaskPayload.Promotion
+	}
+	summary.Rankings, summary.Decisions = selectModels(summary, rules.withDefaults(), enginePayload.TaskPayload.CandidateModelID)
+	for _, decision := range summary.Decisions {
+		logger.Infof("Model %s of engine %s against champion %s: %s, %s", decision.ChallengerModelID, decision.EngineID, decision.ChampionModelID, decision.Decision, strings.Join(decision.Reasons, ", "))
+	}
+	if len(summary.Rankings) > 0 {
+		if err := persistSelectionSDO(shutdownCtx, graphQLClient, enginePayload, benchmarkSchemaID, summary.Rankings, summary.Decisions); err != nil {
+			logger.Warnf("Failed to create the model selection SDO due to: %s", err)
+		}
+	}
+
+	return summary, nil
 }
 
 // gatherAssetsByTDO Gather the asset data and organize them by their corresponding TDO ID
-func gatherAssetsByTDO(shutdownCtx context.Context, graphQLClient *api.PlatformGraphQLClient, taskID string, assetIDs []string) (tdoAssetMap map[string]*TDOAssets, failedAssets []string) {
-	fmt.Printf("[gatherAssetsByTDO] Gathering assets from the payload and organizing them by TDO\n")
+func gatherAssetsByTDO(shutdownCtx context.Context, graphQLClient *api.PlatformGraphQLClient, taskID string, assetIDs []string, cp *checkpoint) (tdoAssetMap map[string]*TDOAssets, failedAssets []string, skippedAssets int) {
+	logFrom(shutdownCtx).Infof("Gathering assets from the payload and organizing them by TDO")
 	tdoAssetMap = make(map[string]*TDOAssets)
 	failedAssets = make([]string, 0)
+
+	// the checkpoint is keyed by TDO, which is only known once the asset is fetched
+	fetchedAssets, fetchErrs, compileErrs := fetchCompiledAssets(shutdownCtx, graphQLClient, assetIDs)
+
 	for _, assetID := range assetIDs {
-		fmt.Printf("[gatherAssetsByTDO] Gather asset ID: %s\n", assetID)
-		asset, err := graphQLClient.FetchAsset(shutdownCtx, assetID)
+		logger := logFrom(shutdownCtx).with("assetId", assetID)
+		asset, err := fetchedAssets[assetID], fetchErrs[assetID]
+		if err == nil && asset.Container.ID != "" && cp.isAssetDone(asset.Container.ID, assetID) {
+			logger.Infof("Skipping asset ID %s of TDO %s, it was already benchmarked", assetID, asset.Container.ID)
+			skippedAssets++
+			continue
+		}
+		logger.Infof("Gather asset ID: %s", assetID)
 		if err != nil {
 			// Skip the asset if there is any failure, and add it the list of failed assets
 			failedAssets = append(failedAssets, assetID)
-			fmt.Printf("[gatherAssetsByTDO] [WARNING] Failed to fetch asset(%s) due to: %s\n", assetID, err)
-			err := graphQLClient.AppendWarningToTask(shutdownCtx, taskID, assetID, "asset_unavailable", fmt.Sprintf("Could not fetch %s to benchmark.", assetID))
+			logger.Warnf("Failed to fetch asset(%s) due to: %s", assetID, err)
+			err := appendAssetWarning(shutdownCtx, graphQLClient, taskID, assetID, "asset_unavailable", fmt.Sprintf("Could not fetch %s to benchmark.", assetID))
 			if err != nil {
-				fmt.Printf("[gatherAssetsByTDO] [WARNING] Failed to update the running task with a warning about a failed asset")
+				logger.Warnf("Failed to update the running task with a warning about a failed asset")
 			}
 			continue
 		}
 
-		// Format the asset into something usable by the engine
-		asset, err = compileAsset(asset)
-		if err != nil {
+		// The asset was formatted into something usable by the engine when it was fetched
+		if err := compileErrs[assetID]; err != nil {
 			failedAssets = append(failedAssets, assetID)
-			fmt.Printf("[gatherAssetsByTDO] [WARNING] Error compiling the asset(%s) due to: %s\n", assetID, err)
-			err := graphQLClient.AppendWarningToTask(shutdownCtx, taskID, assetID, "invalid_transcript_asset", fmt.Sprintf("%s is not a valid VTN-standard transcript.", assetID))
+			logger.Warnf("Error compiling the asset(%s) due to: %s", assetID, err)
+			err := appendAssetWarning(shutdownCtx, graphQLClient, taskID, assetID, "invalid_transcript_asset", fmt.Sprintf("%s is not a valid VTN-standard transcript.", assetID))
 			if err != nil {
-				fmt.Printf("[gatherAssetsByTDO] [WARNING] Failed to update the running task about a failed asset due to: %s", err)
+				logger.Warnf("Failed to update the running task about a failed asset due to: %s", err)
 			}
 			continue
 		} else if asset.Container.ID == "" {
 			// For some reason this asset does not have a TDOID, so fail this asset
 			failedAssets = append(failedAssets, assetID)
-			fmt.Printf("[gatherAssetsByTDO] [WARNING] Error compiling the asset(%s) because it did not have a TDO ID associated with it\n", assetID)
-			err := graphQLClient.AppendWarningToTask(shutdownCtx, taskID, assetID, "invalid_transcript_asset", fmt.Sprintf("%s did not have a TDO ID associated with it.", assetID))
+			logger.Warnf("Error compiling the asset(%s) because it did not have a TDO ID associated with it", assetID)
+			err := appendAssetWarning(shutdownCtx, graphQLClient, taskID, assetID, "invalid_transcript_asset", fmt.Sprintf("%s did not have a TDO ID associated with it.", assetID))
 			if err != nil {
-				fmt.Printf("[gatherAssetsByTDO] [WARNING] Failed to update the running task about a failed asset due to: %s", err)
+				logger.Warnf("Failed to update the running task about a failed asset due to: %s", err)
 			}
 			continue
 		}
@@ -257,93 +469,94 @@ func gatherAssetsByTDO(shutdownCtx context.Context, graphQLClient *api.PlatformG
 		tdoAssetMap[asset.Container.ID].assets = assets
 	}
 
-	return tdoAssetMap, failedAssets
+	return tdoAssetMap, failedAssets, skippedAssets
 }
 
 // gatherBaselineAssets Gather the baseline asset data and add them to the tdoAssetMap according to its corresponding TDOID
-func gatherBaselineAssets(shutdownCtx context.Context, graphQLClient *api.PlatformGraphQLClient, taskID string, tdoAssetMap map[string]*TDOAssets, baselineAssetIDs []string) (map[string]*TDOAssets, []string) {
-	fmt.Printf("[gatherBaselineAssets] Gathering baseline assets from the payload and organizing them by TDO\n")
+func gatherBaselineAssets(shutdownCtx context.Context, graphQLClient *api.PlatformGraphQLClient, taskID string, tdoAssetMap map[string]*TDOAssets, baselineAssetIDs []string, cp *checkpoint) (map[string]*TDOAssets, []string, int) {
+	logFrom(shutdownCtx).Infof("Gathering baseline assets from the payload and organizing them by TDO")
 	failedBaselineAssets := make([]string, 0)
+	skippedBaselineAssets := 0
+	fetchedAssets, fetchErrs, compileErrs := fetchCompiledAssets(shutdownCtx, graphQLClient, baselineAssetIDs)
 	for _, baselineAssetID := range baselineAssetIDs {
-		baselineAsset, err := graphQLClient.FetchAsset(shutdownCtx, baselineAssetID)
+		logger := logFrom(shutdownCtx).with("assetId", baselineAssetID)
+		baselineAsset, err := fetchedAssets[baselineAssetID], fetchErrs[baselineAssetID]
 		if err != nil {
 			failedBaselineAssets = append(failedBaselineAssets, baselineAssetID)
-			fmt.Printf("[gatherBaselineAssets] [WARNING] Failed to fetch the baseline asset for assetID(%s) due to: %s", baselineAssetID, err)
-			err := graphQLClient.AppendWarningToTask(shutdownCtx, taskID, baselineAssetID, "asset_unavailable", fmt.Sprintf("Could not fetch baseline asset %s to benchmark.", baselineAssetID))
+			logger.Warnf("Failed to fetch the baseline asset for assetID(%s) due to: %s", baselineAssetID, err)
+			err := appendAssetWarning(shutdownCtx, graphQLClient, taskID, baselineAssetID, "asset_unavailable", fmt.Sprintf("Could not fetch baseline asset %s to benchmark.", baselineAssetID))
 			if err != nil {
-				fmt.Printf("[gatherBaselineAssets] [WARNING] Failed to update the running task about a failed asset due to: %s", err)
+				logger.Warnf("Failed to update the running task about a failed asset due to: %s", err)
 			}
 			continue
 		}
 
 		// If the TDO asset map doesn't have the TDO associated with this baseline, then that means no assets were gathered in the previous step. Therefore, we should fail this baseline asset.
 		if _, ok := tdoAssetMap[baselineAsset.Container.ID]; !ok {
+			if cp.isBaselineDone(baselineAsset.Container.ID, baselineAssetID) {
+				// All the assets of this baseline were benchmarked by a previous attempt
+				skippedBaselineAssets++
+				continue
+			}
 			failedBaselineAssets = append(failedBaselineAssets, baselineAssetID)
-			fmt.Printf("[gatherBaselineAssets] [WARNING] The baseline asset(%s) has no other assets to benchmark against\n", baselineAssetID)
-			err := graphQLClient.AppendWarningToTask(shutdownCtx, taskID, baselineAssetID, "asset_unavailable", fmt.Sprintf("Baseline asset %s has no other assets to benchmark against.", baselineAssetID))
+			logger.Warnf("The baseline asset(%s) has no other assets to benchmark against", baselineAssetID)
+			err := appendAssetWarning(shutdownCtx, graphQLClient, taskID, baselineAssetID, "asset_unavailable", fmt.Sprintf("Baseline asset %s has no other assets to benchmark against.", baselineAssetID))
 			if err != nil {
-				fmt.Printf("[gatherBaselineAssets] [WARNING] Failed to update the running task about a failed asset due to: %s", err)
+				logger.Warnf("Failed to update the running task about a failed asset due to: %s", err)
 			}
 			continue
 		}
 
-		// Compile the raw transcript and find the model ID if it exists
-		baselineAsset, err = compileAsset(baselineAsset)
-		if err != nil {
+		// The raw transcript was compiled and the model ID found when the asset was fetched
+		if err := compileErrs[baselineAssetID]; err != nil {
 			failedBaselineAssets = append(failedBaselineAssets, baselineAssetID)
-			fmt.Printf("[gatherBaselineAssets] [WARNING] Failed to compile baseline asset(%s) due to: %s\n", baselineAssetID, err)
-			err := graphQLClient.AppendWarningToTask(shutdownCtx, taskID, baselineAssetID, "invalid_transcript_asset", fmt.Sprintf("Baseline %s is not a valid VTN-standard transcript.", baselineAssetID))
+			logger.Warnf("Failed to compile baseline asset(%s) due to: %s", baselineAssetID, err)
+			err := appendAssetWarning(shutdownCtx, graphQLClient, taskID, baselineAssetID, "invalid_transcript_asset", fmt.Sprintf("Baseline %s is not a valid VTN-standard transcript.", baselineAssetID))
 			if err != nil {
-				fmt.Printf("[gatherBaselineAssets] [WARNING] Failed to update the running task about a failed asset due to: %s", err)
+				logger.Warnf("Failed to update the running task about a failed asset due to: %s", err)
 			}
 			continue
 		}
 
 		tdoAssetMap[baselineAsset.Container.ID].baselineAsset = baselineAsset
 	}
-	return tdoAssetMap, failedBaselineAssets
+	return tdoAssetMap, failedBaselineAssets, skippedBaselineAssets
 }
 
 // compileAsset Compile the provided asset to have the required VTN-standard output as a Golang struct and a string transcript.
-// Also get the model ID from the asset if it exists
-func compileAsset(asset *api.Asset) (*api.Asset, error) {
-	fmt.Printf("[compileAsset] Compiling the asset for asset ID: %s\n", asset.ID)
-	// need to convert asset transform(transformFunction: JSON) which is a string, to EngineOutput (VTN-standard)
-	var output *api.EngineOutput
-	err := json.Unmarshal([]byte(asset.Raw), &output)
-	if err != nil {
-		return nil, fmt.Errorf("Error unmarshalling the asset(%s) data due to: %s", asset.ID, err)
-	}
-	// store the asset as output
-	asset.Data = output
+// The raw output is streamed from content, e.g. the download of the asset, so that multi-hour transcripts are compiled
+// in linear time without being held in memory. Also get the model ID from the asset if it exists
+func compileAsset(ctx context.Context, asset *api.Asset, content io.Reader) (*api.Asset, error) {
+	logFrom(ctx).Debugf("Compiling the asset for asset ID: %s", asset.ID)
 
 	if asset.SourceData.Engine == nil {
 		asset.SourceData.Engine = &api.Engine{}
 	}
-
-	// convert to a string transcript
-	if asset.SourceData.Engine.CategoryID == "" || asset.SourceData.Engine.CategoryID == categoryTranslationID {
-		var transcript string
-		for _, serie := range output.Series {
-			for _, word := range serie.Words {
-				matched, err := regexp.MatchString("!?.,:;", word.Word)
-				if err == nil && matched {
-					transcript = transcript + word.Word
-				} else {
-					transcript = transcript + " " + word.Word
-				}
-				transcript = strings.TrimSpace(transcript)
-			}
-		}
-		// store the transcript as part of the asset (because it is)
-		asset.Transcript = transcript
-	} else {
-		if asset.SourceData.Engine.CategoryID == categoryFacialDetectionID {
-			for i := 0; i < len(output.Series); i++ {
-				output.Series[i].Object.Rectangle = getRectangleFromPoints(output.Series[i].Object.PoundingPoly)
-			}
+	categoryID := asset.SourceData.Engine.CategoryID
+
+	// need to convert the VTN-standard JSON output to EngineOutput
+	var series []api.Series
+	builder := &transcriptBuilder{}
+	onSeries := func(serie api.Series) error {
+		switch categoryID {
+		case "", categoryTranslationID:
+			// convert to a string transcript, the series are not kept
+			return builder.addSeries(serie)
+		case categoryFacialDetectionID:
+			serie.Object.Rectangle = getRectangleFromPoints(serie.Object.PoundingPoly)
 		}
+		series = append(series, serie)
+		return nil
+	}
+	output, err := readVTN(content, onSeries)
+	if err != nil {
+		return nil, fmt.Errorf("Error unmarshalling the asset(%s) data due to: %s", asset.ID, err)
 	}
+	output.Series = series
+	// store the asset as output
+	asset.Data = output
+	// store the transcript as part of the asset (because it is)
+	builder.compile(asset)
 
 	// check if the asset has modelID and add it if so (needed for SRC training workflow)
 	for _, tag := range asset.Data.Tags {
@@ -392,18 +605,27 @@ func getRectangleFromPoints(points []api.Point) api.Rectangle {
 	return rectangle
 }
 
+// asset the asset of the TDO with the given ID, or nil
+func (tdoAssets *TDOAssets) asset(assetID string) *api.Asset {
+	for _, asset := range tdoAssets.assets {
+		if asset.ID == assetID {
+			return asset
+		}
+	}
+	return nil
+}
+
 // formatBenchmarkEngineOutputsPayload compiles the data into a format accepted by the benchmark service.
-// Generates new UUIDs for each asset to cover assets of the same engine ID
+// Keys the outputs by asset ID to cover assets of the same engine ID
 func formatBenchmarkEngineOutputsPayload(tdoAssets *TDOAssets) (map[string]EngineOutput, map[string]string) {
 	engineOutputs := make(map[string]EngineOutput)
 
 	// NOTE: shouldn't map by engine ID since the client may want to benchmark two assets from the same engine,
-	// so we generate a unique ID based on the asset
+	// so the outputs are keyed by asset ID
 	newIDToEngineID := make(map[string]string)
 
 	for _, asset := range tdoAssets.assets {
-		fmt.Printf("[formatBenchmarkEngineOutputsPayload] Formatting the local service payload on asset(%s)\n", asset.ID)
-		newID := uuid.New().String()
+		newID := asset.ID
 		newIDToEngineID[newID] = asset.SourceData.Engine.ID
 
 		engineOutputs[newID] = EngineOutput{
@@ -447,8 +669,8 @@ func sclite(ctx context.Context, includeWordBreakdown bool, ref, hyp []byte) (*r
 		return nil, err
 	}
 	defer os.Remove(refHyp)
-	cmd := exec.CommandContext(ctx, "/app/sclite", "-r", fileRef, "-h", refHyp, "-i", "rm", "-p")
-	cmd.Stderr = os.Stderr
+	cmd := exec.CommandContext(ctx, scliteFQN(), "-r", fileRef, "-h", refHyp, "-i", "rm", "-p")
+	cmd.Stderr = stderrLogger{logger: logFrom(ctx), program: "sclite"}
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return nil, errors.Wrap(err, "cmd.StdoutPipe")
@@ -456,30 +678,58 @@ func sclite(ctx context.Context, includeWordBreakdown bool, ref, hyp []byte) (*r
 	if err := cmd.Start(); err != nil {
 		return nil, errors.Wrap(err, "start")
 	}
-	var debug bool
-	if os.Getenv("DEBUG") != "" {
-		debug = true
+	r, err := readScliteOutput(ctx, stdout, includeWordBreakdown)
+	if err != nil {
+		// stop sclite and reap it, it would otherwise be left blocked on its output or as a zombie
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, err
 	}
+	if err := cmd.Wait(); err != nil {
+		return nil, errors.Wrap(err, "wait")
+	}
+	if r.WordCount == 0 {
+		return r, nil
+	}
+	r.Accuracy = float64(r.Correct) / float64(r.WordCount)
+	recallDenom := float64(r.Correct) + float64(r.Deleted)
+	if recallDenom > 0 {
+		r.Recall = float64(r.Correct) / recallDenom
+	}
+	precisionDenom := float64(r.Correct) + float64(r.Substituted) + float64(r.Inserted)
+	if precisionDenom > 0 {
+		r.Precision = float64(r.Correct) / precisionDenom
+	}
+	errorRateDenom := float64(r.Correct) + float64(r.Substituted) + float64(r.Deleted)
+	if errorRateDenom > 0 {
+		numer := float64(r.Deleted) + float64(r.Substituted) + float64(r.Inserted)
+		r.WordErrorRate = numer / errorRateDenom
+	}
+	return r, nil
+}
+
+// readScliteOutput parse the alignment sclite writes to its output, stopping when the context is cancelled
+func readScliteOutput(ctx context.Context, stdout io.Reader, includeWordBreakdown bool) (*results, error) {
+	logger := logFrom(ctx)
+	r := &results{}
 	var scanning bool
-	var r results
 	s := bufio.NewScanner(stdout)
 	for s.Scan() {
 		if err := ctx.Err(); err != nil {
-			return nil, ctx.Err()
+			return nil, err
 		}
 		line := s.Text()
-		if debug {
-			fmt.Println(line)
-		}
+		logger.Debugf("sclite: %s", line)
 		if strings.HasPrefix(line, "<PATH") {
 			segs := strings.Split(line, `word_cnt="`)
 			if len(segs) == 1 {
 				return nil, errors.New("malformed XML when getting word_cnt")
 			}
-			r.WordCount, err = strconv.Atoi(strings.Split(segs[1], `"`)[0])
+			wordCount, err := strconv.Atoi(strings.Split(segs[1], `"`)[0])
 			if err != nil {
 				return nil, errors.Wrap(err, "malformed XML when getting word_cnt")
 			}
+			r.WordCount = wordCount
 			scanning = true
 			continue
 		}
@@ -517,27 +767,7 @@ func sclite(ctx context.Context, includeWordBreakdown bool, ref, hyp []byte) (*r
 	if err := s.Err(); err != nil {
 		return nil, errors.Wrap(err, "reading stdout")
 	}
-	if err := cmd.Wait(); err != nil {
-		return nil, errors.Wrap(err, "wait")
-	}
-	if r.WordCount == 0 {
-		return &r, nil
-	}
-	r.Accuracy = float64(r.Correct) / float64(r.WordCount)
-	recallDenom := float64(r.Correct) + float64(r.Deleted)
-	if recallDenom > 0 {
-		r.Recall = float64(r.Correct) / recallDenom
-	}
-	precisionDenom := float64(r.Correct) + float64(r.Substituted) + float64(r.Inserted)
-	if precisionDenom > 0 {
-		r.Precision = float64(r.Correct) / precisionDenom
-	}
-	errorRateDenom := float64(r.Correct) + float64(r.Substituted) + float64(r.Deleted)
-	if errorRateDenom > 0 {
-		numer := float64(r.Deleted) + float64(r.Substituted) + float64(r.Inserted)
-		r.WordErrorRate = numer / errorRateDenom
-	}
-	return &r, nil
+	return r, nil
 }
 
 func savefile(b []byte) (string, error) {
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// the policies choosing among the outputs of one engine on a TDO
+const (
+	duplicatePolicyAll            = "all"
+	duplicatePolicyLatest         = "latest"
+	duplicatePolicyHighestVersion = "highestVersion"
+	duplicatePolicyModel          = "model"
+)
+
+// duplicateRules which outputs to benchmark when a TDO has several outputs of one engine
+type duplicateRules struct {
+	// Policy all (default), latest by created time, highestVersion by deployed engine version, or model
+	Policy string `json:"policy"`
+	// ModelID the model the model policy keeps, the latest output of the engine when none is of that model
+	ModelID string `json:"modelId"`
+}
+
+// assetSelection how the output was chosen among the outputs of its engine on the TDO
+type assetSelection struct {
+	Policy string `json:"policy"`
+	// Candidates the outputs of the engine on the TDO, by asset ID
+	Candidates []string `json:"candidates"`
+	Reason     string   `json:"reason"`
+}
+
+// selectDuplicates keep the outputs of each engine the rules choose. It returns the kept assets in asset ID order,
+// the selection of the engines with several outputs by asset ID, and the assets set aside.
+func selectDuplicates(assets []*api.Asset, rules duplicateRules) (kept []*api.Asset, selections map[string]*assetSelection, dropped []string) {
+	policy := rules.Policy
+	if policy == "" {
+		policy = duplicatePolicyAll
+	}
+	byEngine := make(map[string][]*api.Asset)
+	var engineIDs []string
+	for _, asset := range assets {
+		engineID := engineIDOf(asset)
+		if _, ok := byEngine[engineID]; !ok {
+			engineIDs = append(engineIDs, engineID)
+		}
+		byEngine[engineID] = append(byEngine[engineID], asset)
+	}
+	sort.Strings(engineIDs)
+
+	selections = make(map[string]*assetSelection)
+	for _, engineID := range engineIDs {
+		outputs := byEngine[engineID]
+		sort.Slice(outputs, func(i, j int) bool { return outputs[i].ID < outputs[j].ID })
+		if len(outputs) == 1 {
+			kept = append(kept, outputs[0])
+			continue
+		}
+		candidates := make([]string, len(outputs))
+		for i, output := range outputs {
+			candidates[i] = output.ID
+		}
+
+		chosen, reason := chooseOutputs(outputs, policy, rules.ModelID)
+		for _, output := range outputs {
+			if containsAsset(chosen, output) {
+				kept = append(kept, output)
+				selections[output.ID] = &assetSelection{Policy: policy, Candidates: candidates, Reason: reason}
+			} else {
+				dropped = append(dropped, output.ID)
+			}
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].ID < kept[j].ID })
+	return kept, selections, dropped
+}
+
+// chooseOutputs the outputs of one engine the policy keeps, and why
+func chooseOutputs(outputs []*api.Asset, policy, modelID string) ([]*api.Asset, string) {
+	switch policy {
+	case duplicatePolicyLatest:
+		latest := latestAsset(outputs)
+		return []*api.Asset{latest}, fmt.Sprintf("latest of %d outputs, created %s", len(outputs), latest.CreatedDateTime)
+	case duplicatePolicyHighestVersion:
+		highest := outputs[0]
+		for _, output := range outputs[1:] {
+			if deployedVersionOf(output) > deployedVersionOf(highest) {
+				highest = output
+			}
+		}
+		// the latest output of the highest version
+		var sameVersion []*api.Asset
+		for _, output := range outputs {
+			if deployedVersionOf(output) == deployedVersionOf(highest) {
+				sameVersion = append(sameVersion, output)
+			}
+		}
+		highest = latestAsset(sameVersion)
+		return []*api.Asset{highest}, fmt.Sprintf("highest deployed version %d of %d outputs", deployedVersionOf(highest), len(outputs))
+	case duplicatePolicyModel:
+		var ofModel []*api.Asset
+		for _, output := range outputs {
+			if output.ModelID == modelID {
+				ofModel = append(ofModel, output)
+			}
+		}
+		if len(ofModel) == 0 {
+			latest := latestAsset(outputs)
+			return []*api.Asset{latest}, fmt.Sprintf("no output of model %s, latest of %d outputs", modelID, len(outputs))
+		}
+		return []*api.Asset{latestAsset(ofModel)}, fmt.Sprintf("latest output of model %s among %d outputs", modelID, len(outputs))
+	}
+	return outputs, fmt.Sprintf("all %d outputs", len(outputs))
+}
+
+// latestAsset the asset created last, the greatest asset ID among those created at the same time
+func latestAsset(assets []*api.Asset) *api.Asset {
+	latest := assets[0]
+	for _, asset := range assets[1:] {
+		created, latestCreated := createdTime(asset), createdTime(latest)
+		if created.After(latestCreated) || (created.Equal(latestCreated) && asset.ID > latest.ID) {
+			latest = asset
+		}
+	}
+	return latest
+}
+
+// createdTime the created time of the asset, the zero time when it is missing or unreadable
+func createdTime(asset *api.Asset) time.Time {
+	created, err := time.Parse(time.RFC3339, asset.CreatedDateTime)
+	if err != nil {
+		return time.Time{}
+	}
+	return created
+}
+
+func engineIDOf(asset *api.Asset) string {
+	if asset.SourceData.Engine == nil {
+		return ""
+	}
+	return asset.SourceData.Engine.ID
+}
+
+func deployedVersionOf(asset *api.Asset) int64 {
+	if asset.SourceData.Engine == nil {
+		return 0
+	}
+	return asset.SourceData.Engine.DeployedVersion
+}
+
+func containsAsset(assets []*api.Asset, asset *api.Asset) bool {
+	for _, a := range assets {
+		if a == asset {
+			return true
+		}
+	}
+	return false
+}
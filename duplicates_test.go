@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+func testEngineOutput(id, engineID string, deployedVersion int64, modelID, created string) *api.Asset {
+	return &api.Asset{
+		ID:              id,
+		ModelID:         modelID,
+		CreatedDateTime: created,
+		SourceData:      api.SourceData{Engine: &api.Engine{ID: engineID, DeployedVersion: deployedVersion}},
+	}
+}
+
+func TestSelectDuplicates(t *testing.T) {
+	assets := []*api.Asset{
+		testEngineOutput("a3", "e1", 2, "m2", "2020-01-03T00:00:00Z"),
+		testEngineOutput("a1", "e1", 1, "m1", "2020-01-01T00:00:00Z"),
+		testEngineOutput("a2", "e1", 3, "m1", "2020-01-02T00:00:00Z"),
+		testEngineOutput("a4", "e1", 3, "m1", "2020-01-02T00:00:00Z"),
+		// the only output of its engine is always kept
+		testEngineOutput("b1", "e2", 1, "m1", "2020-01-01T00:00:00Z"),
+	}
+	tests := []struct {
+		name    string
+		rules   duplicateRules
+		kept    string
+		dropped string
+	}{
+		{"all by default", duplicateRules{}, "a1,a2,a3,a4,b1", ""},
+		{"latest", duplicateRules{Policy: duplicatePolicyLatest}, "a3,b1", "a1,a2,a4"},
+		// a2 and a4 have the highest version and were created at the same time, the greatest asset ID wins
+		{"highest version", duplicateRules{Policy: duplicatePolicyHighestVersion}, "a4,b1", "a1,a2,a3"},
+		{"model", duplicateRules{Policy: duplicatePolicyModel, ModelID: "m1"}, "a4,b1", "a1,a2,a3"},
+		{"model without outputs", duplicateRules{Policy: duplicatePolicyModel, ModelID: "m9"}, "a3,b1", "a1,a2,a4"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := append([]*api.Asset(nil), assets...)
+			kept, selections, dropped := selectDuplicates(input, test.rules)
+			keptIDs := make([]string, len(kept))
+			for i, asset := range kept {
+				keptIDs[i] = asset.ID
+			}
+			if got := strings.Join(keptIDs, ","); got != test.kept {
+				t.Errorf("kept %s, want %s", got, test.kept)
+			}
+			if got := strings.Join(dropped, ","); got != test.dropped {
+				t.Errorf("dropped %s, want %s", got, test.dropped)
+			}
+			if _, ok := selections["b1"]; ok {
+				t.Error("the only output of its engine has a selection")
+			}
+			for _, asset := range kept {
+				if asset.ID == "b1" {
+					continue
+				}
+				selection := selections[asset.ID]
+				if selection == nil || strings.Join(selection.Candidates, ",") != "a1,a2,a3,a4" {
+					t.Errorf("selection of %s = %+v, want the four outputs of e1 as candidates", asset.ID, selection)
+				}
+			}
+		})
+	}
+}
+
+func TestLatestAsset(t *testing.T) {
+	tests := []struct {
+		name   string
+		assets []*api.Asset
+		want   string
+	}{
+		{"created last", []*api.Asset{{ID: "b", CreatedDateTime: "2020-01-02T00:00:00Z"}, {ID: "a", CreatedDateTime: "2020-01-03T00:00:00Z"}}, "a"},
+		{"same time", []*api.Asset{{ID: "b", CreatedDateTime: "2020-01-02T00:00:00Z"}, {ID: "a", CreatedDateTime: "2020-01-02T00:00:00Z"}}, "b"},
+		// an unreadable created time is the zero time
+		{"unreadable time", []*api.Asset{{ID: "b", CreatedDateTime: "yesterday"}, {ID: "a", CreatedDateTime: "2020-01-01T00:00:00Z"}}, "a"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := latestAsset(test.assets); got.ID != test.want {
+				t.Errorf("latestAsset() = %s, want %s", got.ID, test.want)
+			}
+		})
+	}
+}
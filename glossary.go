@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// maxGlossaryFailures how many failing term occurrences are listed in a benchmark SDO, the others are only counted
+const maxGlossaryFailures = 100
+
+// glossaryTerm a source term and the target term its translation must use
+type glossaryTerm struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// CaseSensitive the target must keep its case, by default the case is ignored
+	CaseSensitive bool `json:"caseSensitive"`
+	// Inflections the other accepted forms of the target, e.g. its plural or declined forms
+	Inflections []string `json:"inflections,omitempty"`
+	// MatchStem accept the words starting with each word of the target, e.g. "Veritone's" for "Veritone"
+	MatchStem bool `json:"matchStem"`
+}
+
+// glossaryFailure an occurrence of a term in the baseline that the output did not render with the target term
+type glossaryFailure struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// Kind "missed" when the output has nothing there, "mistranslated" when it has something else
+	Kind       string `json:"kind"`
+	Reference  string `json:"reference"`
+	Hypothesis string `json:"hypothesis,omitempty"`
+	// WordIndex the position of the occurrence in the baseline transcript, in words
+	WordIndex int `json:"wordIndex"`
+}
+
+// glossaryMetrics how well the output rendered the glossary terms found in the baseline
+type glossaryMetrics struct {
+	Occurrences   int               `json:"occurrences"`
+	Hits          int               `json:"hits"`
+	Missed        int               `json:"missed"`
+	Mistranslated int               `json:"mistranslated"`
+	HitRate       float64           `json:"hitRate"`
+	Failures      []glossaryFailure `json:"failures,omitempty"`
+}
+
+// glossaryForms a term and its sanitized accepted forms, longest first
+type glossaryForms struct {
+	term  glossaryTerm
+	forms [][]string
+}
+
+// loadGlossary add the terms of the glossary asset of the payload, if any, to the terms of the payload.
+// The asset is a JSON list of terms, or an object with the list under "terms".
+func loadGlossary(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, enginePayload *BenchmarkEnginePayload) error {
+	assetID := enginePayload.TaskPayload.GlossaryAssetID
+	if assetID == "" {
+		return nil
+	}
+	content, err := graphQLClient.FetchAssetContent(ctx, assetID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch the glossary asset %s", assetID)
+	}
+
+	var terms []glossaryTerm
+	if err := json.Unmarshal(content, &terms); err != nil {
+		var glossary struct {
+			Terms []glossaryTerm `json:"terms"`
+		}
+		if err := json.Unmarshal(content, &glossary); err != nil {
+			return errors.Wrapf(err, "the glossary asset %s is not a JSON list of terms", assetID)
+		}
+		terms = glossary.Terms
+	}
+	logFrom(ctx).Infof("Loaded %d glossary terms from asset %s", len(terms), assetID)
+	enginePayload.TaskPayload.Glossary = append(enginePayload.TaskPayload.Glossary, terms...)
+	return nil
+}
+
+// compileGlossary sanitize the accepted forms of the terms the way sclite sees the transcripts
+func compileGlossary(terms []glossaryTerm) []glossaryForms {
+	compiled := make([]glossaryForms, 0, len(terms))
+	for _, term := range terms {
+		entry := glossaryForms{term: term}
+		for _, form := range append([]string{term.Target}, term.Inflections...) {
+			if tokens := strings.Fields(sanitize(form)); len(tokens) > 0 {
+				entry.forms = append(entry.forms, tokens)
+			}
+		}
+		if len(entry.forms) == 0 {
+			continue
+		}
+		sort.SliceStable(entry.forms, func(i, j int) bool { return len(entry.forms[i]) > len(entry.forms[j]) })
+		compiled = append(compiled, entry)
+	}
+	// match the longest terms first so that a term inside another is not counted twice
+	sort.SliceStable(compiled, func(i, j int) bool { return len(compiled[i].forms[0]) > len(compiled[j].forms[0]) })
+	return compiled
+}
+
+// matchesAt the length of the form of the term matching the tokens at position i, or 0
+func (g glossaryForms) matchesAt(tokens []string, i int) int {
+	for _, form := range g.forms {
+		if i+len(form) > len(tokens) {
+			continue
+		}
+		matched := true
+		for k, want := range form {
+			if !g.matchesToken(tokens[i+k], want) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return len(form)
+		}
+	}
+	return 0
+}
+
+func (g glossaryForms) matchesToken(token, want string) bool {
+	if !g.term.CaseSensitive {
+		token, want = strings.ToLower(token), strings.ToLower(want)
+	}
+	if g.term.MatchStem {
+		return strings.HasPrefix(token, want)
+	}
+	return token == want
+}
+
+// contains whether the tokens contain one of the forms of the term
+func (g glossaryForms) contains(tokens []string) bool {
+	for i := range tokens {
+		if g.matchesAt(tokens, i) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// newGlossaryMetrics find the glossary terms in the baseline and check the output words aligned with each
+// occurrence. It returns nil without a glossary, or when the alignment does not match the transcripts.
+func newGlossaryMetrics(glossary []glossaryForms, reference, hypothesis string, alignment []word) *glossaryMetrics {
+	if len(glossary) == 0 {
+		return nil
+	}
+	refTokens, hypTokens := strings.Fields(reference), strings.Fields(hypothesis)
+	pairs := pairAlignment(unlabelled(refTokens), unlabelled(hypTokens), alignment)
+	if pairs == nil {
+		return nil
+	}
+	// the alignment steps of each reference word
+	refSteps := make([]int, len(refTokens))
+	for step, pair := range pairs {
+		if pair.ref >= 0 {
+			refSteps[pair.ref] = step
+		}
+	}
+
+	metrics := &glossaryMetrics{}
+	covered := make([]bool, len(refTokens))
+	for _, entry := range glossary {
+		for i := 0; i < len(refTokens); i++ {
+			if covered[i] {
+				continue
+			}
+			length := entry.matchesAt(refTokens, i)
+			if length == 0 || isCovered(covered[i:i+length]) {
+				continue
+			}
+			for k := i; k < i+length; k++ {
+				covered[k] = true
+			}
+
+			// the output words aligned from the first to the last word of the occurrence, insertions included
+			var rendered []string
+			for _, pair := range pairs[refSteps[i] : refSteps[i+length-1]+1] {
+				if pair.hyp >= 0 {
+					rendered = append(rendered, hypTokens[pair.hyp])
+				}
+			}
+
+			metrics.Occurrences++
+			failure := glossaryFailure{
+				Source:     entry.term.Source,
+				Target:     entry.term.Target,
+				Reference:  strings.Join(refTokens[i:i+length], " "),
+				Hypothesis: strings.Join(rendered, " "),
+				WordIndex:  i,
+			}
+			switch {
+			case entry.contains(rendered):
+				metrics.Hits++
+				continue
+			case len(rendered) == 0:
+				metrics.Missed++
+				failure.Kind = "missed"
+			default:
+				metrics.Mistranslated++
+				failure.Kind = "mistranslated"
+			}
+			if len(metrics.Failures) < maxGlossaryFailures {
+				metrics.Failures = append(metrics.Failures, failure)
+			}
+		}
+	}
+	if metrics.Occurrences > 0 {
+		metrics.HitRate = float64(metrics.Hits) / float64(metrics.Occurrences)
+	}
+	sort.SliceStable(metrics.Failures, func(i, j int) bool { return metrics.Failures[i].WordIndex < metrics.Failures[j].WordIndex })
+	return metrics
+}
+
+// isCovered whether a word of the span is already part of another occurrence
+func isCovered(span []bool) bool {
+	for _, covered := range span {
+		if covered {
+			return true
+		}
+	}
+	return false
+}
+
+// unlabelled the tokens without labels, to pair them with an alignment
+func unlabelled(tokens []string) []labelledToken {
+	labelled := make([]labelledToken, len(tokens))
+	for i, token := range tokens {
+		labelled[i].token = token
+	}
+	return labelled
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testGlossaryMetrics the glossary metrics of the output against the reference, aligned word by word as a
+// substitution, a deletion ("-" in the output) or an insertion ("+word" in the output)
+func testGlossaryMetrics(terms []glossaryTerm, reference string, output ...string) *glossaryMetrics {
+	var hypothesis []string
+	var steps []string
+	refTokens := strings.Fields(reference)
+	r := 0
+	for _, token := range output {
+		switch {
+		case token == "-":
+			steps = append(steps, "D "+refTokens[r])
+			r++
+		case strings.HasPrefix(token, "+"):
+			hypothesis = append(hypothesis, token[1:])
+			steps = append(steps, "I "+token[1:])
+		default:
+			hypothesis = append(hypothesis, token)
+			if strings.EqualFold(token, refTokens[r]) {
+				steps = append(steps, "C "+token)
+			} else {
+				steps = append(steps, "S "+refTokens[r]+" "+token)
+			}
+			r++
+		}
+	}
+	return newGlossaryMetrics(compileGlossary(terms), reference, strings.Join(hypothesis, " "), testAlignment(steps...))
+}
+
+func TestNewGlossaryMetrics(t *testing.T) {
+	tests := []struct {
+		name      string
+		terms     []glossaryTerm
+		reference string
+		output    []string
+		// the kind of each failure, the hits are not listed
+		hits, occurrences int
+		failures          []string
+	}{
+		{
+			name:      "hit",
+			terms:     []glossaryTerm{{Source: "ordenador", Target: "computer"}},
+			reference: "my computer is slow",
+			output:    []string{"my", "Computer", "is", "slow"},
+			hits:      1, occurrences: 1,
+		},
+		{
+			name:        "missed",
+			terms:       []glossaryTerm{{Source: "ordenador", Target: "computer"}},
+			reference:   "my computer is slow",
+			output:      []string{"my", "-", "is", "slow"},
+			occurrences: 1, failures: []string{"missed computer at 1"},
+		},
+		{
+			name:        "mistranslated",
+			terms:       []glossaryTerm{{Source: "ordenador", Target: "computer"}},
+			reference:   "my computer is slow",
+			output:      []string{"my", "laptop", "is", "slow"},
+			occurrences: 1, failures: []string{"mistranslated computer as laptop at 1"},
+		},
+		{
+			name:      "inflection",
+			terms:     []glossaryTerm{{Source: "ordenador", Target: "computer", Inflections: []string{"computers"}}},
+			reference: "two computers and a computer",
+			output:    []string{"two", "computers", "and", "a", "computers"},
+			hits:      2, occurrences: 2,
+		},
+		{
+			name:      "term of several words",
+			terms:     []glossaryTerm{{Source: "Nueva York", Target: "New York"}},
+			reference: "in new york today",
+			output:    []string{"in", "new", "york", "+city", "today"},
+			hits:      1, occurrences: 1,
+		},
+		{
+			// the insertion inside the occurrence is part of what the output rendered
+			name:        "insertion inside a term",
+			terms:       []glossaryTerm{{Source: "Nueva York", Target: "New York"}},
+			reference:   "in new york today",
+			output:      []string{"in", "new", "+big", "york", "today"},
+			occurrences: 1, failures: []string{"mistranslated new york as new big york at 1"},
+		},
+		{
+			name:      "nested terms match the longest first",
+			terms:     []glossaryTerm{{Source: "York", Target: "York"}, {Source: "Nueva York", Target: "New York"}},
+			reference: "new york and york",
+			output:    []string{"new", "yolk", "and", "york"},
+			hits:      1, occurrences: 2, failures: []string{"mistranslated new york as new yolk at 0"},
+		},
+		{
+			name:        "case sensitive",
+			terms:       []glossaryTerm{{Source: "Apple", Target: "Apple", CaseSensitive: true}},
+			reference:   "Apple sells apple juice",
+			output:      []string{"apple", "sells", "apple", "juice"},
+			occurrences: 1, failures: []string{"mistranslated Apple as apple at 0"},
+		},
+		{
+			name:      "stem",
+			terms:     []glossaryTerm{{Source: "Veritone", Target: "Veritone", MatchStem: true}},
+			reference: "the veritones engine",
+			output:    []string{"the", "veritones", "engine"},
+			hits:      1, occurrences: 1,
+		},
+		{
+			name:        "no stem",
+			terms:       []glossaryTerm{{Source: "Veritone", Target: "Veritone"}},
+			reference:   "the veritone engine of veritones",
+			output:      []string{"the", "veritones", "engine", "of", "veritones"},
+			occurrences: 1, failures: []string{"mistranslated veritone as veritones at 1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metrics := testGlossaryMetrics(test.terms, test.reference, test.output...)
+			if metrics == nil {
+				t.Fatal("newGlossaryMetrics() = nil")
+			}
+			if metrics.Hits != test.hits || metrics.Occurrences != test.occurrences || metrics.Missed+metrics.Mistranslated != len(test.failures) {
+				t.Errorf("%d hits of %d occurrences, %d missed, %d mistranslated, want %d of %d, %d failures", metrics.Hits, metrics.Occurrences, metrics.Missed, metrics.Mistranslated, test.hits, test.occurrences, len(test.failures))
+			}
+			var failures []string
+			for _, failure := range metrics.Failures {
+				description := failure.Kind + " " + failure.Reference
+				if failure.Hypothesis != "" {
+					description += " as " + failure.Hypothesis
+				}
+				failures = append(failures, fmt.Sprintf("%s at %d", description, failure.WordIndex))
+			}
+			if !reflect.DeepEqual(failures, test.failures) {
+				t.Errorf("failures = %q, want %q", failures, test.failures)
+			}
+		})
+	}
+
+	if testGlossaryMetrics(nil, "my computer", "my", "computer") != nil {
+		t.Error("metrics without a glossary")
+	}
+}
+
+func TestLoadGlossary(t *testing.T) {
+	var content string
+	download := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer download.Close()
+	client, closeServer := testGraphQLServer(t, func(query string, variables map[string]interface{}) interface{} {
+		return map[string]interface{}{"asset": map[string]interface{}{"id": variables["assetId"], "signedUri": download.URL}}
+	})
+	defer closeServer()
+
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{"list", `[{"source":"ordenador","target":"computer"}]`, []string{"payload", "computer"}, false},
+		{"terms object", `{"terms":[{"source":"ratón","target":"mouse","matchStem":true},{"source":"red","target":"network"}]}`, []string{"payload", "mouse", "network"}, false},
+		{"not a glossary", `"computer"`, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content = test.content
+			payload := &BenchmarkEnginePayload{TaskPayload: TaskPayload{GlossaryAssetID: "glossary", Glossary: []glossaryTerm{{Source: "payload", Target: "payload"}}}}
+			err := loadGlossary(context.Background(), client, payload)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("loadGlossary() error = %v, want an error %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			var targets []string
+			for _, term := range payload.TaskPayload.Glossary {
+				targets = append(targets, term.Target)
+			}
+			if !reflect.DeepEqual(targets, test.want) {
+				t.Errorf("glossary = %v, want %v", targets, test.want)
+			}
+		})
+	}
+
+	// without a glossary asset nothing is fetched
+	payload := &BenchmarkEnginePayload{}
+	if err := loadGlossary(context.Background(), nil, payload); err != nil || payload.TaskPayload.Glossary != nil {
+		t.Errorf("loadGlossary() = %v, %v", err, payload.TaskPayload.Glossary)
+	}
+}
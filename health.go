@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+)
+
+const (
+	// defaultScliteFQN where the Dockerfile installs sclite
+	defaultScliteFQN = "/app/sclite"
+	// maxConcurrentTasks how many /process requests the engine runs at once. The payload, config, logger, clients
+	// and asset cache of the running task are process globals, so a second task would overwrite them.
+	maxConcurrentTasks = 1
+)
+
+var (
+	processStartTime = time.Now()
+	// processSlots limits the number of /process requests running at once
+	processSlots = make(chan struct{}, maxConcurrentTasks)
+)
+
+// healthCheck the result of one readiness check
+type healthCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// healthReport the body returned by /readyz and /livez
+type healthReport struct {
+	Status string        `json:"status"`
+	Checks []healthCheck `json:"checks,omitempty"`
+
+	UptimeSeconds int64 `json:"uptimeSeconds,omitempty"`
+	Goroutines    int   `json:"goroutines,omitempty"`
+	InFlight      int   `json:"inFlight"`
+	Draining      bool  `json:"draining,omitempty"`
+}
+
+// acquireProcessSlot reserve a slot for a /process request. It returns false when the engine is saturated.
+func acquireProcessSlot() bool {
+	select {
+	case processSlots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func releaseProcessSlot() {
+	<-processSlots
+}
+
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	config, configErr := loadConfig()
+	checks := []healthCheck{
+		checkConfig(configErr),
+		checkSclite(config.ScliteFQN),
+		checkCapacity(),
+		checkDraining(),
+	}
+
+	report := healthReport{Status: "ok", Checks: checks, InFlight: len(processSlots)}
+	status := http.StatusOK
+	for _, check := range checks {
+		if !check.OK {
+			report.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeHealthReport(w, status, report)
+}
+
+func handleLive(w http.ResponseWriter, r *http.Request) {
+	shutdownMutex.Lock()
+	isDraining := draining
+	shutdownMutex.Unlock()
+
+	writeHealthReport(w, http.StatusOK, healthReport{
+		Status:        "ok",
+		UptimeSeconds: int64(time.Since(processStartTime).Seconds()),
+		Goroutines:    runtime.NumGoroutine(),
+		InFlight:      len(processSlots),
+		Draining:      isDraining,
+	})
+}
+
+func writeHealthReport(w http.ResponseWriter, status int, report healthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		engineLogger.Errorf("Failed to write the health report: %s", err)
+	}
+}
+
+// checkConfig the engine configuration must parse
+func checkConfig(configErr error) healthCheck {
+	if configErr != nil {
+		return healthCheck{Name: "config", Message: configErr.Error()}
+	}
+	return healthCheck{Name: "config", OK: true}
+}
+
+// checkSclite the sclite scorer must exist and be executable
+func checkSclite(path string) healthCheck {
+	info, err := os.Stat(path)
+	if err != nil {
+		return healthCheck{Name: "sclite", Message: err.Error()}
+	}
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		return healthCheck{Name: "sclite", Message: fmt.Sprintf("%s is not executable", path)}
+	}
+	return healthCheck{Name: "sclite", OK: true}
+}
+
+// checkCapacity the engine must have a free slot to run another task. The message states the limit, which is not
+// configurable.
+func checkCapacity() healthCheck {
+	limit := fmt.Sprintf("the engine runs at most %d task at a time", cap(processSlots))
+	if len(processSlots) >= cap(processSlots) {
+		return healthCheck{Name: "capacity", Message: fmt.Sprintf("%d tasks running, %s", len(processSlots), limit)}
+	}
+	return healthCheck{Name: "capacity", OK: true, Message: limit}
+}
+
+// checkDraining the engine must not be shutting down
+func checkDraining() healthCheck {
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+	if draining {
+		return healthCheck{Name: "draining", Message: "the engine is shutting down"}
+	}
+	return healthCheck{Name: "draining", OK: true}
+}
+
+// scliteFQN the sclite executable to score with
+func scliteFQN() string {
+	if myAppContext.Config.ScliteFQN != "" {
+		return myAppContext.Config.ScliteFQN
+	}
+	return defaultScliteFQN
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setTestEnv set the environment variable, or unset it when value is empty, and return how to restore it
+func setTestEnv(key, value string) func() {
+	previous, wasSet := os.LookupEnv(key)
+	if value == "" {
+		os.Unsetenv(key)
+	} else {
+		os.Setenv(key, value)
+	}
+	return func() {
+		if wasSet {
+			os.Setenv(key, previous)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+// testConfigFile write the config to a file that CONFIG_FILE points to until the returned function is called
+func testConfigFile(t *testing.T, config string) func() {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	restore := setTestEnv("CONFIG_FILE", file)
+	return func() {
+		restore()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestHandleReady(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sclite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sclite := filepath.Join(dir, "sclite")
+	if err := ioutil.WriteFile(sclite, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	notExecutable := filepath.Join(dir, "notes")
+	if err := ioutil.WriteFile(notExecutable, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		config     string
+		running    bool
+		draining   bool
+		wantStatus int
+		// the checks failing, with a part of their message
+		wantFailed map[string]string
+	}{
+		{"ready", `{"scliteFQN": "` + sclite + `"}`, false, false, http.StatusOK, nil},
+		{"invalid config", `{"scliteFQN": "` + sclite + `", "assetBatchSize": 0}`, false, false, http.StatusServiceUnavailable, map[string]string{"config": "assetBatchSize must be at least 1"}},
+		{"sclite missing", `{"scliteFQN": "` + filepath.Join(dir, "missing") + `"}`, false, false, http.StatusServiceUnavailable, map[string]string{"sclite": "no such file"}},
+		{"sclite not executable", `{"scliteFQN": "` + notExecutable + `"}`, false, false, http.StatusServiceUnavailable, map[string]string{"sclite": "is not executable"}},
+		{"task running", `{"scliteFQN": "` + sclite + `"}`, true, false, http.StatusServiceUnavailable, map[string]string{"capacity": "1 tasks running, the engine runs at most 1 task at a time"}},
+		{"draining", `{"scliteFQN": "` + sclite + `"}`, false, true, http.StatusServiceUnavailable, map[string]string{"draining": "shutting down"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer testConfigFile(t, test.config)()
+			if test.running {
+				acquireProcessSlot()
+				defer releaseProcessSlot()
+			}
+			shutdownMutex.Lock()
+			draining = test.draining
+			shutdownMutex.Unlock()
+			defer func() {
+				shutdownMutex.Lock()
+				draining = false
+				shutdownMutex.Unlock()
+			}()
+
+			recorder := httptest.NewRecorder()
+			handleReady(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			var report healthReport
+			if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			if recorder.Code != test.wantStatus || (report.Status == "ok") != (test.wantStatus == http.StatusOK) {
+				t.Errorf("/readyz = %d %s, want %d", recorder.Code, report.Status, test.wantStatus)
+			}
+			if len(report.Checks) != 4 {
+				t.Errorf("checks = %+v, want config, sclite, capacity and draining", report.Checks)
+			}
+			for _, check := range report.Checks {
+				want, failing := test.wantFailed[check.Name]
+				if check.OK == failing || failing && !strings.Contains(check.Message, want) {
+					t.Errorf("check %+v, want failing %v with %q", check, failing, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCapacityStatesTheLimit(t *testing.T) {
+	if check := checkCapacity(); !check.OK || check.Message != "the engine runs at most 1 task at a time" {
+		t.Errorf("checkCapacity() = %+v", check)
+	}
+}
+
+func TestHandleLive(t *testing.T) {
+	acquireProcessSlot()
+	defer releaseProcessSlot()
+	shutdownMutex.Lock()
+	draining = true
+	shutdownMutex.Unlock()
+	defer func() {
+		shutdownMutex.Lock()
+		draining = false
+		shutdownMutex.Unlock()
+	}()
+
+	// live while running a task and draining
+	recorder := httptest.NewRecorder()
+	handleLive(recorder, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	var report healthReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != http.StatusOK || report.Status != "ok" || report.InFlight != 1 || !report.Draining || report.Goroutines == 0 {
+		t.Errorf("/livez = %d %+v", recorder.Code, report)
+	}
+}
+
+func TestHandleProcessWhileRunning(t *testing.T) {
+	acquireProcessSlot()
+	defer releaseProcessSlot()
+
+	recorder := httptest.NewRecorder()
+	handleProcess(recorder, httptest.NewRequest(http.MethodPost, "/process", nil))
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("/process while a task runs = %d, want %d", recorder.Code, http.StatusTooManyRequests)
+	}
+}
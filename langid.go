@@ -0,0 +1,150 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxLanguageIDTokens how many words of a transcript the language identifier reads
+	maxLanguageIDTokens = 5000
+	// minLanguageIDTrigrams the fewest trigrams the language identifier decides on
+	minLanguageIDTrigrams = 50
+	// languageIDMargin how much the best language must score over the second one
+	languageIDMargin = 1.2
+	// minScriptLetters the fewest letters the script of a transcript is decided on
+	minScriptLetters = 20
+)
+
+// trigramProfiles the most frequent word trigrams of the Latin-script languages, most frequent first.
+// A word is padded with "_" so that the trigrams mark the word starts and ends.
+var trigramProfiles = map[string][]string{
+	"en": {"_th", "the", "he_", "_an", "and", "nd_", "_of", "of_", "ed_", "ing", "ng_", "_to", "to_", "er_", "_in", "in_", "is_", "ion", "re_", "_is",
+		"on_", "tio", "ent", "es_", "at_", "_wa", "hat", "tha", "_be", "_he", "ly_", "_fo", "for", "or_", "_it", "it_", "_yo", "you", "ou_", "his"},
+	"es": {"_de", "de_", "_la", "la_", "os_", "_el", "el_", "es_", "_qu", "que", "ue_", "_co", "_en", "en_", "as_", "ión", "ón_", "_se", "ado", "_lo",
+		"_pa", "par", "ara", "ra_", "_un", "nte", "_es", "est", "_po", "por", "or_", "ent", "do_", "_no", "con", "_me", "aci", "cio", "los", "_su"},
+	"fr": {"_de", "de_", "es_", "_le", "le_", "ent", "_la", "la_", "nt_", "_et", "et_", "on_", "_qu", "que", "ue_", "_pa", "_co", "ion", "re_", "les",
+		"_un", "_en", "en_", "_du", "du_", "ai_", "_ce", "our", "ous", "_po", "par", "eme", "ait", "_il", "il_", "est", "_es", "tio", "ons", "_vo"},
+	"de": {"en_", "er_", "_de", "der", "ie_", "_di", "die", "ich", "ein", "sch", "_ei", "_un", "und", "nd_", "che", "_da", "den", "_ge", "gen", "_zu",
+		"cht", "ch_", "ten", "_ve", "te_", "ine", "_mi", "_in", "in_", "_au", "auf", "ung", "ng_", "_ni", "nic", "es_", "_si", "sie", "ist", "_is"},
+	"it": {"_di", "di_", "_ch", "che", "he_", "_la", "la_", "_il", "il_", "re_", "to_", "_de", "del", "_co", "_pe", "per", "er_", "ent", "one", "ne_",
+		"_un", "no_", "ell", "lla", "_in", "_no", "non", "_si", "ato", "are", "_al", "zio", "ion", "_ad", "_pr", "ta_", "con", "ono", "lle", "gli"},
+	"pt": {"_de", "de_", "_qu", "que", "ue_", "os_", "_do", "do_", "_da", "da_", "ão_", "ção", "_co", "com", "_pa", "par", "ara", "_se", "nte", "ent",
+		"_em", "em_", "_nã", "não", "_um", "um_", "as_", "es_", "_po", "por", "or_", "_re", "men", "ado", "_es", "est", "ões", "_na", "uma", "ser"},
+	"nl": {"en_", "_de", "de_", "an_", "_he", "het", "et_", "_va", "van", "_ee", "een", "_en", "_in", "in_", "er_", "_da", "dat", "at_", "ie_", "_ge",
+		"oor", "_vo", "_ni", "nie", "iet", "_is", "is_", "_op", "op_", "ijk", "_te", "te_", "aar", "_me", "_zi", "ver", "_ve", "sch", "cht", "ing"},
+}
+
+// languageScripts the script each language is written in, for the languages that can be told by their script
+var languageScripts = map[string]string{
+	"en": "Latin", "es": "Latin", "fr": "Latin", "de": "Latin", "it": "Latin", "pt": "Latin", "nl": "Latin",
+	"ru": "Cyrillic", "uk": "Cyrillic", "bg": "Cyrillic", "sr": "Cyrillic",
+	"el": "Greek", "ar": "Arabic", "fa": "Arabic", "ur": "Arabic", "he": "Hebrew",
+	"zh": "Han", "ja": "Japanese", "ko": "Hangul", "hi": "Devanagari", "mr": "Devanagari", "ne": "Devanagari", "th": "Thai",
+}
+
+// scripts the scripts told apart, Japanese covering the kana
+var scripts = []struct {
+	name   string
+	tables []*unicode.RangeTable
+}{
+	{"Latin", []*unicode.RangeTable{unicode.Latin}},
+	{"Cyrillic", []*unicode.RangeTable{unicode.Cyrillic}},
+	{"Greek", []*unicode.RangeTable{unicode.Greek}},
+	{"Arabic", []*unicode.RangeTable{unicode.Arabic}},
+	{"Hebrew", []*unicode.RangeTable{unicode.Hebrew}},
+	{"Han", []*unicode.RangeTable{unicode.Han}},
+	{"Japanese", []*unicode.RangeTable{unicode.Hiragana, unicode.Katakana}},
+	{"Hangul", []*unicode.RangeTable{unicode.Hangul}},
+	{"Devanagari", []*unicode.RangeTable{unicode.Devanagari}},
+	{"Thai", []*unicode.RangeTable{unicode.Thai}},
+}
+
+// trigramWeights the weight of each trigram of each profile, decreasing with its rank
+var trigramWeights = func() map[string]map[string]float64 {
+	weights := make(map[string]map[string]float64, len(trigramProfiles))
+	for language, profile := range trigramProfiles {
+		weights[language] = make(map[string]float64, len(profile))
+		for rank, trigram := range profile {
+			if _, ok := weights[language][trigram]; !ok {
+				weights[language][trigram] = 1 - float64(rank)/float64(len(profile))
+			}
+		}
+	}
+	return weights
+}()
+
+// languageWords the lowercase words of the text, split on anything but letters
+func languageWords(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) })
+	if len(words) > maxLanguageIDTokens {
+		words = words[:maxLanguageIDTokens]
+	}
+	return words
+}
+
+// dominantScript the script most of the letters of the text are written in, or "" with too few letters
+func dominantScript(text string) string {
+	counts := make([]int, len(scripts))
+	var letters int
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for i, script := range scripts {
+			if unicode.In(r, script.tables...) {
+				counts[i]++
+				break
+			}
+		}
+	}
+	if letters < minScriptLetters {
+		return ""
+	}
+	best := 0
+	for i := range counts {
+		if counts[i] > counts[best] {
+			best = i
+		}
+	}
+	if counts[best] == 0 {
+		return ""
+	}
+	return scripts[best].name
+}
+
+// identifyLanguage the Latin-script language of the text from its word trigrams, or "" when the text is too short
+// or no language clearly wins
+func identifyLanguage(text string) string {
+	trigrams := make(map[string]int)
+	var total int
+	for _, w := range languageWords(text) {
+		padded := []rune("_" + w + "_")
+		for i := 0; i+3 <= len(padded); i++ {
+			trigrams[string(padded[i:i+3])]++
+			total++
+		}
+	}
+	if total < minLanguageIDTrigrams {
+		return ""
+	}
+
+	var best, second float64
+	var bestLanguage string
+	for language, weights := range trigramWeights {
+		var score float64
+		for trigram, count := range trigrams {
+			score += float64(count) * weights[trigram]
+		}
+		if score > best {
+			best, second, bestLanguage = score, best, language
+		} else if score > second {
+			second = score
+		}
+	}
+	if best == 0 || best < second*languageIDMargin {
+		return ""
+	}
+	return bestLanguage
+}
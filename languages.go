@@ -0,0 +1,209 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// maxFlaggedSegments how many off-target segments are listed in a benchmark SDO, the others are only counted
+const maxFlaggedSegments = 100
+
+// languageBreakdown the metrics of the words of one reference language
+type languageBreakdown struct {
+	Language       string  `json:"language"`
+	ReferenceWords int     `json:"referenceWords"`
+	Correct        int     `json:"correct"`
+	Substituted    int     `json:"substituted"`
+	Deleted        int     `json:"deleted"`
+	Inserted       int     `json:"inserted"`
+	WordErrorRate  float64 `json:"wordErrorRate"`
+}
+
+// flaggedSegment a segment of the output whose language is not the target language
+type flaggedSegment struct {
+	StartTimeMs int32  `json:"startTimeMs"`
+	StopTimeMs  int32  `json:"stopTimeMs"`
+	Language    string `json:"language"`
+}
+
+// languageMetrics the per-language breakdown of an output, how much of the time its language tags agree with
+// the baseline, and its segments off the target language
+type languageMetrics struct {
+	Languages []languageBreakdown `json:"languages,omitempty"`
+
+	// LanguageIDAgreement the share of the time tagged on both sides where the output and the baseline agree
+	LanguageIDAgreement float64 `json:"languageIdAgreement"`
+	ComparedMs          int64   `json:"comparedMs"`
+	AgreedMs            int64   `json:"agreedMs"`
+
+	// TargetLanguage the language the output should be in, the segments of another language are off target
+	TargetLanguage      string `json:"targetLanguage,omitempty"`
+	OffTargetSegments   int    `json:"offTargetSegments"`
+	OffTargetDurationMs int64  `json:"offTargetDurationMs"`
+	// FlaggedSegments the first off-target segments
+	FlaggedSegments []flaggedSegment `json:"flaggedSegments,omitempty"`
+}
+
+// baseLanguage compare the languages by their primary subtag, "en-US" is "en"
+func baseLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if i := strings.IndexAny(language, "-_"); i >= 0 {
+		language = language[:i]
+	}
+	return language
+}
+
+func segmentLanguage(segment api.TranscriptSegment) string {
+	return baseLanguage(segment.Language)
+}
+
+// newLanguageMetrics the language metrics of the output against its baseline. The target language is the one
+// requested by the payload, or else the language of the baseline output. It returns nil when neither side has languages.
+func newLanguageMetrics(baseline, asset *api.Asset, alignment []word, targetLanguage string) *languageMetrics {
+	if baseline == nil || asset == nil {
+		return nil
+	}
+	reference, refLabelled := labelledTokens(baseline, segmentLanguage)
+	hypothesis, hypLabelled := labelledTokens(asset, segmentLanguage)
+	if !refLabelled && !hypLabelled {
+		return nil
+	}
+
+	metrics := &languageMetrics{}
+	if refLabelled {
+		if pairs := pairAlignment(reference, hypothesis, alignment); pairs != nil {
+			metrics.Languages = languageBreakdowns(reference, hypothesis, pairs)
+		}
+	}
+	if refLabelled && hypLabelled {
+		metrics.ComparedMs, metrics.AgreedMs = languageAgreement(baseline.Segments, asset.Segments)
+		if metrics.ComparedMs > 0 {
+			metrics.LanguageIDAgreement = float64(metrics.AgreedMs) / float64(metrics.ComparedMs)
+		}
+	}
+
+	if targetLanguage == "" && baseline.Data != nil {
+		targetLanguage = baseline.Data.Language
+	}
+	metrics.TargetLanguage = targetLanguage
+	if target := baseLanguage(targetLanguage); target != "" {
+		for _, segment := range asset.Segments {
+			language := segmentLanguage(segment)
+			if language == "" || language == target || segment.WordCount == 0 {
+				continue
+			}
+			metrics.OffTargetSegments++
+			metrics.OffTargetDurationMs += int64(segment.StopTimeMs - segment.StartTimeMs)
+			if len(metrics.FlaggedSegments) < maxFlaggedSegments {
+				metrics.FlaggedSegments = append(metrics.FlaggedSegments, flaggedSegment{
+					StartTimeMs: segment.StartTimeMs,
+					StopTimeMs:  segment.StopTimeMs,
+					Language:    segment.Language,
+				})
+			}
+		}
+	}
+	return metrics
+}
+
+// languageBreakdowns attribute the aligned words to the language of the reference. An insertion counts against
+// the language of the reference word before it, or of the hypothesis word at the start of the transcript.
+func languageBreakdowns(reference, hypothesis []labelledToken, pairs []alignedPair) []languageBreakdown {
+	byLanguage := make(map[string]*languageBreakdown)
+	breakdownOf := func(language string) *languageBreakdown {
+		breakdown, ok := byLanguage[language]
+		if !ok {
+			breakdown = &languageBreakdown{Language: language}
+			byLanguage[language] = breakdown
+		}
+		return breakdown
+	}
+
+	previous := -1
+	for _, pair := range pairs {
+		if pair.ref < 0 {
+			language := hypothesis[pair.hyp].label
+			if previous >= 0 {
+				language = reference[previous].label
+			}
+			breakdownOf(language).Inserted++
+			continue
+		}
+		previous = pair.ref
+		breakdown := breakdownOf(reference[pair.ref].label)
+		breakdown.ReferenceWords++
+		switch pair.action {
+		case "C":
+			breakdown.Correct++
+		case "S":
+			breakdown.Substituted++
+		case "D":
+			breakdown.Deleted++
+		}
+	}
+
+	breakdowns := make([]languageBreakdown, 0, len(byLanguage))
+	for _, breakdown := range byLanguage {
+		if breakdown.ReferenceWords > 0 {
+			breakdown.WordErrorRate = float64(breakdown.Substituted+breakdown.Deleted+breakdown.Inserted) / float64(breakdown.ReferenceWords)
+		}
+		breakdowns = append(breakdowns, *breakdown)
+	}
+	sort.Slice(breakdowns, func(i, j int) bool { return breakdowns[i].Language < breakdowns[j].Language })
+	return breakdowns
+}
+
+// languageAgreement the time where both the reference and the hypothesis have a language tag, and the part of it
+// where the tags agree
+func languageAgreement(reference, hypothesis []api.TranscriptSegment) (comparedMs, agreedMs int64) {
+	reference, hypothesis = languageSpans(reference), languageSpans(hypothesis)
+	start := 0
+	for _, ref := range reference {
+		// skip the hypothesis spans ending before this reference span, the spans are sorted by start time
+		for start < len(hypothesis) && hypothesis[start].StopTimeMs <= ref.StartTimeMs {
+			start++
+		}
+		for _, hyp := range hypothesis[start:] {
+			if hyp.StartTimeMs >= ref.StopTimeMs {
+				break
+			}
+			overlap := int64(minInt32(ref.StopTimeMs, hyp.StopTimeMs) - maxInt32(ref.StartTimeMs, hyp.StartTimeMs))
+			if overlap <= 0 {
+				continue
+			}
+			comparedMs += overlap
+			if segmentLanguage(ref) == segmentLanguage(hyp) {
+				agreedMs += overlap
+			}
+		}
+	}
+	return comparedMs, agreedMs
+}
+
+// languageSpans the timed segments with a language, sorted by start time
+func languageSpans(segments []api.TranscriptSegment) []api.TranscriptSegment {
+	spans := make([]api.TranscriptSegment, 0, len(segments))
+	for _, segment := range segments {
+		if segmentLanguage(segment) != "" && segment.StopTimeMs > segment.StartTimeMs {
+			spans = append(spans, segment)
+		}
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].StartTimeMs < spans[j].StartTimeMs })
+	return spans
+}
+
+func minInt32(a, b int32) int32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt32(a, b int32) int32 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+func TestBaseLanguage(t *testing.T) {
+	tests := []struct {
+		language, want string
+	}{
+		{"en", "en"},
+		{"en-US", "en"},
+		{"EN_gb", "en"},
+		{" zh-Hant-TW ", "zh"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := baseLanguage(test.language); got != test.want {
+			t.Errorf("baseLanguage(%q) = %q, want %q", test.language, got, test.want)
+		}
+	}
+}
+
+func TestLanguageAgreement(t *testing.T) {
+	tests := []struct {
+		name                  string
+		reference, hypothesis []testSegment
+		compared, agreed      int64
+	}{
+		{
+			name:       "switch in the output",
+			reference:  []testSegment{{language: "en", startTimeMs: 0, stopTimeMs: 10000, text: "a"}},
+			hypothesis: []testSegment{{language: "en", startTimeMs: 0, stopTimeMs: 6000, text: "a"}, {language: "es", startTimeMs: 6000, stopTimeMs: 10000, text: "b"}},
+			compared:   10000, agreed: 6000,
+		},
+		{
+			name:       "regions agree with their language",
+			reference:  []testSegment{{language: "en-US", startTimeMs: 0, stopTimeMs: 4000, text: "a"}},
+			hypothesis: []testSegment{{language: "en", startTimeMs: 1000, stopTimeMs: 3000, text: "a"}},
+			compared:   2000, agreed: 2000,
+		},
+		{
+			name:       "only the time tagged on both sides",
+			reference:  []testSegment{{language: "en", startTimeMs: 0, stopTimeMs: 5000, text: "a"}, {startTimeMs: 5000, stopTimeMs: 9000, text: "b"}},
+			hypothesis: []testSegment{{language: "en", startTimeMs: 3000, stopTimeMs: 9000, text: "a b"}},
+			compared:   2000, agreed: 2000,
+		},
+		{
+			// each overlapping output segment is compared with the baseline
+			name:       "overlapping output segments",
+			reference:  []testSegment{{language: "en", startTimeMs: 0, stopTimeMs: 10000, text: "a"}},
+			hypothesis: []testSegment{{language: "es", startTimeMs: 4000, stopTimeMs: 10000, text: "b"}, {language: "en", startTimeMs: 0, stopTimeMs: 8000, text: "a"}},
+			compared:   14000, agreed: 8000,
+		},
+		{
+			name:       "overlapping baseline segments",
+			reference:  []testSegment{{language: "en", startTimeMs: 0, stopTimeMs: 6000, text: "a"}, {language: "fr", startTimeMs: 2000, stopTimeMs: 4000, text: "b"}, {language: "en", startTimeMs: 5000, stopTimeMs: 8000, text: "c"}},
+			hypothesis: []testSegment{{language: "en", startTimeMs: 0, stopTimeMs: 8000, text: "a b c"}},
+			compared:   11000, agreed: 9000,
+		},
+		{
+			name:       "untimed segments",
+			reference:  []testSegment{{language: "en", text: "a"}},
+			hypothesis: []testSegment{{language: "en", text: "a"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compared, agreed := languageAgreement(testTranscript(test.reference...).Segments, testTranscript(test.hypothesis...).Segments)
+			if compared != test.compared || agreed != test.agreed {
+				t.Errorf("languageAgreement() = %d, %d, want %d, %d", compared, agreed, test.compared, test.agreed)
+			}
+		})
+	}
+}
+
+func TestNewLanguageMetrics(t *testing.T) {
+	baseline := testTranscript(
+		testSegment{language: "en-US", startTimeMs: 0, stopTimeMs: 4000, text: "the cat"},
+		testSegment{language: "es", startTimeMs: 4000, stopTimeMs: 8000, text: "el gato"},
+	)
+	baseline.Data = &api.EngineOutput{Language: "en-US"}
+	asset := testTranscript(
+		testSegment{language: "fr", startTimeMs: 0, stopTimeMs: 1000, text: "euh"},
+		testSegment{language: "en", startTimeMs: 1000, stopTimeMs: 4000, text: "the dog"},
+		testSegment{language: "es", startTimeMs: 4000, stopTimeMs: 8000, text: "el gato gato"},
+	)
+	// the insertion at the start counts against its own language, the others against the reference word before them
+	alignment := testAlignment("I euh", "C the", "S cat dog", "C el", "C gato", "I gato")
+
+	tests := []struct {
+		name           string
+		targetLanguage string
+		offTarget      int
+		offTargetMs    int64
+		flagged        []flaggedSegment
+	}{
+		{"language of the baseline", "", 2, 5000, []flaggedSegment{{0, 1000, "fr"}, {4000, 8000, "es"}}},
+		{"target of the payload", "es-MX", 2, 4000, []flaggedSegment{{0, 1000, "fr"}, {1000, 4000, "en"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metrics := newLanguageMetrics(baseline, asset, alignment, test.targetLanguage)
+			want := []languageBreakdown{
+				{Language: "en", ReferenceWords: 2, Correct: 1, Substituted: 1, WordErrorRate: 0.5},
+				{Language: "es", ReferenceWords: 2, Correct: 2, Inserted: 1, WordErrorRate: 0.5},
+				{Language: "fr", Inserted: 1},
+			}
+			if !reflect.DeepEqual(metrics.Languages, want) {
+				t.Errorf("languages = %+v, want %+v", metrics.Languages, want)
+			}
+			if metrics.ComparedMs != 8000 || metrics.AgreedMs != 7000 || metrics.LanguageIDAgreement != 7.0/8 {
+				t.Errorf("agreement = %d of %d ms, %f, want 7000 of 8000 ms", metrics.AgreedMs, metrics.ComparedMs, metrics.LanguageIDAgreement)
+			}
+			if metrics.OffTargetSegments != test.offTarget || metrics.OffTargetDurationMs != test.offTargetMs || !reflect.DeepEqual(metrics.FlaggedSegments, test.flagged) {
+				t.Errorf("off target %d segments, %d ms, flagged %+v, want %d, %d ms, %+v", metrics.OffTargetSegments, metrics.OffTargetDurationMs, metrics.FlaggedSegments, test.offTarget, test.offTargetMs, test.flagged)
+			}
+		})
+	}
+
+	unlabelled := testTranscript(testSegment{text: "the cat"})
+	if newLanguageMetrics(unlabelled, unlabelled, testAlignment("C the", "C cat"), "en") != nil {
+		t.Error("metrics of outputs without languages")
+	}
+}
+
+func TestFlaggedSegmentsAreCapped(t *testing.T) {
+	segments := make([]testSegment, 0, maxFlaggedSegments+6)
+	for i := int32(0); i < maxFlaggedSegments+5; i++ {
+		segments = append(segments, testSegment{language: "es", startTimeMs: i * 1000, stopTimeMs: i*1000 + 500, text: "hola"})
+	}
+	// neither a segment without words nor one in the target language is off target
+	segments = append(segments, testSegment{language: "es", startTimeMs: 900000, stopTimeMs: 901000}, testSegment{language: "en-GB", startTimeMs: 902000, stopTimeMs: 903000, text: "hello"})
+
+	metrics := newLanguageMetrics(testTranscript(testSegment{text: "hello"}), testTranscript(segments...), nil, "en-US")
+	if metrics.OffTargetSegments != maxFlaggedSegments+5 || metrics.OffTargetDurationMs != int64(maxFlaggedSegments+5)*500 {
+		t.Errorf("off target %d segments, %d ms, want %d, %d ms", metrics.OffTargetSegments, metrics.OffTargetDurationMs, maxFlaggedSegments+5, (maxFlaggedSegments+5)*500)
+	}
+	if len(metrics.FlaggedSegments) != maxFlaggedSegments {
+		t.Errorf("%d flagged segments, want %d", len(metrics.FlaggedSegments), maxFlaggedSegments)
+	}
+	if metrics.Languages != nil {
+		t.Errorf("languages = %+v, want none without baseline languages", metrics.Languages)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logLevel the severity of a log line
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = map[logLevel]string{
+	levelDebug: "debug",
+	levelInfo:  "info",
+	levelWarn:  "warn",
+	levelError: "error",
+}
+
+// correlationFields the fields every log line carries, even when they are empty, so lines can be joined on them
+var correlationFields = []string{"jobId", "taskId", "tdoId", "assetId"}
+
+type loggerContextKey struct{}
+
+// engineLogger the base logger, without any task fields. Its output is scrubbed of secrets.
+var engineLogger = newJSONLogger(newScrubWriter(os.Stdout), levelInfo)
+
+// jsonLogger a leveled logger writing one JSON object per line
+type jsonLogger struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	level  logLevel
+	fields map[string]string
+}
+
+func newJSONLogger(out io.Writer, level logLevel) *jsonLogger {
+	return &jsonLogger{
+		mu:     &sync.Mutex{},
+		out:    out,
+		level:  level,
+		fields: map[string]string{"service": serviceName},
+	}
+}
+
+func (l *jsonLogger) clone() *jsonLogger {
+	fields := make(map[string]string, len(l.fields)+1)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	return &jsonLogger{mu: l.mu, out: l.out, level: l.level, fields: fields}
+}
+
+// with returns a copy of the logger adding the field to every line
+func (l *jsonLogger) with(key, value string) *jsonLogger {
+	copied := l.clone()
+	copied.fields[key] = value
+	return copied
+}
+
+// withLevel returns a copy of the logger writing the lines of the given level and above
+func (l *jsonLogger) withLevel(level logLevel) *jsonLogger {
+	copied := l.clone()
+	copied.level = level
+	return copied
+}
+
+func (l *jsonLogger) Debugf(format string, args ...interface{}) { l.logf(levelDebug, format, args...) }
+func (l *jsonLogger) Infof(format string, args ...interface{})  { l.logf(levelInfo, format, args...) }
+func (l *jsonLogger) Warnf(format string, args ...interface{})  { l.logf(levelWarn, format, args...) }
+func (l *jsonLogger) Errorf(format string, args ...interface{}) { l.logf(levelError, format, args...) }
+
+func (l *jsonLogger) logf(level logLevel, format string, args ...interface{}) {
+	if level < l.level {
+		return
+	}
+	line := make(map[string]string, len(l.fields)+len(correlationFields)+3)
+	for _, field := range correlationFields {
+		line[field] = ""
+	}
+	for k, v := range l.fields {
+		line[k] = v
+	}
+	line["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	line["level"] = levelNames[level]
+	line["msg"] = fmt.Sprintf(format, args...)
+
+	b, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(append(b, '\n'))
+}
+
+// Write lets the standard library logger, used by the api package, write through the structured logger
+func (l *jsonLogger) Write(p []byte) (int, error) {
+	l.Infof("%s", strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+// graphQLLogger writes the lines of the GraphQL client through the logger of the request context, or the given
+// logger for the requests without one
+type graphQLLogger struct {
+	logger *jsonLogger
+}
+
+func (l graphQLLogger) from(ctx context.Context) *jsonLogger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*jsonLogger); ok {
+		return logger
+	}
+	return l.logger
+}
+
+func (l graphQLLogger) Debugf(ctx context.Context, format string, args ...interface{}) {
+	l.from(ctx).Debugf(format, args...)
+}
+
+func (l graphQLLogger) Warnf(ctx context.Context, format string, args ...interface{}) {
+	l.from(ctx).Warnf(format, args...)
+}
+
+// stderrLogger logs every line written to it as a warning, e.g. the stderr of a subprocess
+type stderrLogger struct {
+	logger  *jsonLogger
+	program string
+}
+
+func (w stderrLogger) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(string(p), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			w.logger.Warnf("%s: %s", w.program, line)
+		}
+	}
+	return len(p), nil
+}
+
+// withLogger returns a context carrying the logger
+func withLogger(ctx context.Context, l *jsonLogger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, l)
+}
+
+// logFrom the logger carried by the context, or the base engine logger
+func logFrom(ctx context.Context) *jsonLogger {
+	if l, ok := ctx.Value(loggerContextKey{}).(*jsonLogger); ok {
+		return l
+	}
+	return engineLogger
+}
+
+// detachedContext a context that is never cancelled but keeps the logger of ctx, used to flush results during a shutdown
+func detachedContext(ctx context.Context) context.Context {
+	return withLogger(context.Background(), logFrom(ctx))
+}
+
+// newTaskLogger the logger of a task, carrying its correlation fields. The payload debug flag enables the debug lines.
+func newTaskLogger(enginePayload *BenchmarkEnginePayload, correlationID string) *jsonLogger {
+	level := levelInfo
+	if enginePayload.Debug {
+		level = levelDebug
+	}
+	return engineLogger.withLevel(level).
+		with("jobId", enginePayload.JobID).
+		with("taskId", enginePayload.TaskID).
+		with("correlationId", correlationID)
+}
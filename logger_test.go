@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// testLogLines the JSON lines written to out
+func testLogLines(t *testing.T, out *bytes.Buffer) []map[string]string {
+	var lines []map[string]string
+	for _, text := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if text == "" {
+			continue
+		}
+		var line map[string]string
+		if err := json.Unmarshal([]byte(text), &line); err != nil {
+			t.Fatalf("log line %q: %v", text, err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestLoggerLevels(t *testing.T) {
+	tests := []struct {
+		level logLevel
+		want  []string
+	}{
+		{levelDebug, []string{"debug", "info", "warn", "error"}},
+		{levelInfo, []string{"info", "warn", "error"}},
+		{levelError, []string{"error"}},
+	}
+	for _, test := range tests {
+		t.Run(levelNames[test.level], func(t *testing.T) {
+			var out bytes.Buffer
+			logger := newJSONLogger(&out, levelInfo).withLevel(test.level)
+			logger.Debugf("d")
+			logger.Infof("i")
+			logger.Warnf("w")
+			logger.Errorf("e")
+
+			var levels []string
+			for _, line := range testLogLines(t, &out) {
+				levels = append(levels, line["level"])
+			}
+			if strings.Join(levels, " ") != strings.Join(test.want, " ") {
+				t.Errorf("levels written = %v, want %v", levels, test.want)
+			}
+		})
+	}
+}
+
+func TestLoggerCorrelationFields(t *testing.T) {
+	var out bytes.Buffer
+	base := newJSONLogger(&out, levelInfo)
+	base.Infof("no field")
+	logger := base.with("tdoId", "tdo1")
+	logger.with("assetId", "a1").Infof("asset %s", "a1")
+	// the copies leave the logger they came from alone
+	logger.Infof("tdo")
+
+	lines := testLogLines(t, &out)
+	want := []map[string]string{
+		{"jobId": "", "taskId": "", "tdoId": "", "assetId": "", "msg": "no field"},
+		{"jobId": "", "taskId": "", "tdoId": "tdo1", "assetId": "a1", "msg": "asset a1"},
+		{"jobId": "", "taskId": "", "tdoId": "tdo1", "assetId": "", "msg": "tdo"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("%d lines, want %d", len(lines), len(want))
+	}
+	for i, line := range lines {
+		if line["service"] != serviceName || line["level"] != "info" || line["time"] == "" {
+			t.Errorf("line %d = %v", i, line)
+		}
+		for field, value := range want[i] {
+			if got, ok := line[field]; !ok || got != value {
+				t.Errorf("line %d %s = %q, want %q", i, field, got, value)
+			}
+		}
+	}
+}
+
+func TestNewTaskLogger(t *testing.T) {
+	defer func(logger *jsonLogger) { engineLogger = logger }(engineLogger)
+	var out bytes.Buffer
+	engineLogger = newJSONLogger(&out, levelInfo)
+
+	payload := &BenchmarkEnginePayload{JobID: "job1", TaskID: "task1"}
+	logger := newTaskLogger(payload, "host1")
+	logger.Debugf("hidden")
+	logger.Infof("shown")
+	payload.Debug = true
+	newTaskLogger(payload, "host1").Debugf("debug")
+
+	lines := testLogLines(t, &out)
+	if len(lines) != 2 || lines[0]["msg"] != "shown" || lines[1]["msg"] != "debug" {
+		t.Fatalf("lines = %v, want the info line, then the debug line of the debug payload", lines)
+	}
+	for _, line := range lines {
+		if line["jobId"] != "job1" || line["taskId"] != "task1" || line["correlationId"] != "host1" {
+			t.Errorf("correlation fields of %v", line)
+		}
+	}
+}
+
+func TestCorrelationIDHeader(t *testing.T) {
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("Veritone-Correlation-ID")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"appendWarningToTask":true}}`))
+	}))
+	defer server.Close()
+
+	// the ID logged by the task, whatever the host name
+	client, err := api.NewCoreAPI(api.Options{VeritoneAPIBaseURL: server.URL, GraphQLEndpoint: "/", Token: "token", InstanceID: "instance", CorrelationID: "task1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AppendWarningToTask(context.Background(), "task1", "a1", "reason", "message"); err != nil {
+		t.Fatal(err)
+	}
+	if header != "task1" {
+		t.Errorf("Veritone-Correlation-ID = %q, want the logged ID", header)
+	}
+}
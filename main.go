@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -13,6 +12,9 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
 	"github.com/urfave/cli"
 	"github.com/veritone/src-training-workflow/platform"
 	"github.com/veritone/translation-benchmark/api"
@@ -32,6 +34,9 @@ const (
 	// Default MinPrecision: 40
 	defaultMinPrecision = float64(40)
 	serviceName         = "translation-benchmark"
+
+	// failureReasonInterrupted the failure reason sent when a shutdown interrupts a benchmark that can be resumed by a retry
+	failureReasonInterrupted = "service_unavailable"
 )
 
 var (
@@ -42,145 +47,197 @@ var (
 )
 
 func main() {
-	fmt.Println("Starting engine server host...")
-	if err := http.ListenAndServe("0.0.0.0:8080", newServer()); err != nil {
-		fmt.Println("Failed to starting engine server host...")
-		fmt.Println(fmt.Sprintf("Error: %v", err))
-		fmt.Fprintf(os.Stderr, "%s", err)
+	// the standard logger, used by the api package, writes through the structured logger
+	log.SetFlags(0)
+	log.SetOutput(engineLogger)
+	myAppContext.Logger = engineLogger
+	myAppContext.App = newApp()
+	if err := myAppContext.App.Run(os.Args); err != nil {
+		engineLogger.Errorf("%s", err)
+		os.Exit(1)
+	}
+}
+
+func newApp() *cli.App {
+	app := cli.NewApp()
+	app.Name = serviceName
+	app.Usage = "Benchmark Translation Engines"
+	app.Version = "0.0.1 (" + runtime.Version() + ")"
+	app.Action = func(c *cli.Context) error {
+		return serve("0.0.0.0:8080")
+	}
+	app.Commands = []cli.Command{
+		configCommand(),
+		validateCommand(),
+		provisionCommand(),
+	}
+	return app
+}
+
+// serve runs the engine server host until a shutdown signal is received
+func serve(addr string) error {
+	engineLogger.Infof("Starting engine server host...")
+	if _, err := loadConfig(); err != nil {
+		// keep serving: /readyz reports the broken config and /process fails the tasks with the reason
+		engineLogger.Warnf("%s", err)
 	}
+
+	server := &http.Server{Addr: addr, Handler: newServer()}
+	exitCode := make(chan int, 1)
+	go listenForSignals(gracefulShutdownCancel, &jobProcessingWaitGroup, server, exitCode)
+
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		engineLogger.Errorf("Failed to starting engine server host: %v", err)
+		return err
+	}
+	return cli.NewExitError("Engine server host shut down", <-exitCode)
 }
 
 func newServer() *http.ServeMux {
 	s := http.NewServeMux()
 	s.HandleFunc("/readyz", handleReady)
+	s.HandleFunc("/livez", handleLive)
 	s.HandleFunc("/process", handleProcess)
+	s.Handle("/metrics", promhttp.Handler())
 	return s
 }
 
-func handleReady(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-}
-
 func handleProcess(w http.ResponseWriter, r *http.Request) {
-	myAppContext.App = cli.NewApp()
-	myAppContext.StartTime = time.Now()
-	myAppContext.App.Name = serviceName
-	myAppContext.App.Usage = "Benchmark Translation Engines"
-	myAppContext.App.Version = "0.0.1 (" + runtime.Version() + ")"
-
-	myAppContext.App.Action = func(c *cli.Context) {
-		log.Println("Start process benchmark translation engine")
-		var err error
-		payload := r.FormValue("payload")
-		var heartbeatWebhook = r.FormValue("heartbeatWebhook")
-		fmt.Println("heartbeatWebhook: ", heartbeatWebhook)
-
-		if payload == "" {
-			updateTaskStatusV3F("failed", "", "The `payload` is undefined  or empty.", "invalid_data", heartbeatWebhook)
-			return
-		}
-		fmt.Printf("Loading payload from %s\n", payload)
-
-		myEnginePayload = BenchmarkEnginePayload{}
-		if err := json.Unmarshal([]byte(payload), &myEnginePayload); err != nil {
-			updateTaskStatusV3F("failed", "", "Unable to unmarshal payload: "+err.Error(), "invalid_data", heartbeatWebhook)
-			return
-		}
+	if !beginProcessing() {
+		http.Error(w, "The engine is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer endProcessing()
+	if !acquireProcessSlot() {
+		http.Error(w, "The engine is already running the maximum number of tasks", http.StatusTooManyRequests)
+		return
+	}
+	defer releaseProcessSlot()
 
-		myEnginePayload.HeartbeatWebhook = heartbeatWebhook
-		maxTTL, err := strconv.Atoi(r.FormValue("maxTTL"))
-		if err != nil {
-			updateTaskStatusV3F("failed", "", "Failed to parse maxTTL value: "+err.Error(), "invalid_data", heartbeatWebhook)
+	myAppContext.StartTime = time.Now()
+	myAppContext.Logger = engineLogger
+	engineLogger.Infof("Start process benchmark translation engine")
+	var err error
+	payload := r.FormValue("payload")
+	var heartbeatWebhook = r.FormValue("heartbeatWebhook")
+	engineLogger.Infof("heartbeatWebhook: %s", heartbeatWebhook)
+
+	if payload == "" {
+		updateTaskStatusV3F("failed", "", "The `payload` is undefined  or empty.", "invalid_data", heartbeatWebhook)
+		return
+	}
+	if err := validatePayload([]byte(payload)); err != nil {
+		updateTaskStatusV3F("failed", "", err.Error(), "invalid_data", heartbeatWebhook)
+		return
+	}
+	// The fields left out of the payload keep their defaults
+	myEnginePayload = BenchmarkEnginePayload{TaskPayload: TaskPayload{MinPrecision: defaultMinPrecision}}
+	if err := json.Unmarshal([]byte(payload), &myEnginePayload); err != nil {
+		updateTaskStatusV3F("failed", "", "Unable to unmarshal payload: "+err.Error(), "invalid_data", heartbeatWebhook)
+		return
+	}
+	logRedactor.register(string(myEnginePayload.Token))
+	// the tokens of the finished tasks would pile up, and their values scrubbed from unrelated text
+	defer logRedactor.unregister(string(myEnginePayload.Token))
+	// the same ID is logged and sent with the GraphQL requests, so that they can be joined
+	correlationID := api.CorrelationID(myEnginePayload.TaskID)
+	myAppContext.Logger = newTaskLogger(&myEnginePayload, correlationID)
+	myAppContext.Logger.Debugf("Loaded payload: %s", toJSONString(myEnginePayload))
+
+	myEnginePayload.HeartbeatWebhook = heartbeatWebhook
+	maxTTL := defaultMaxTTL
+	if value := r.FormValue("maxTTL"); value != "" {
+		maxTTL, err = strconv.Atoi(value)
+		if err != nil || maxTTL < 0 {
+			updateTaskStatusV3F("failed", "", fmt.Sprintf("maxTTL must be a number of seconds, got %q", value), "invalid_data", heartbeatWebhook)
 			return
 		}
+	} else {
+		myAppContext.Logger.Infof("No maxTTL, estimating the processing time to %d seconds", maxTTL)
+	}
 
-		// Response for the end func
-		resp := &api.Response{
-			EstimatedProcessingTimeInSeconds: maxTTL,
-		}
-
-		defer func() {
-			if err := json.NewEncoder(w).Encode(resp); err != nil {
-				fmt.Fprintf(os.Stderr, "%s", err)
-			}
-			fmt.Printf("Engine Exit successfully.")
-		}()
-		// End: Response for the end func
-
-		myConfig = loadEngineWrapperConfigFile()
-		myConfig.APIOptions.Token = myEnginePayload.Token
-		myConfig.APIOptions.VeritoneApiBaseUrl = myEnginePayload.VeritoneAPIBaseURL
-		// TODO: confirm before remove local api
-		myConfig.LocalAPIOptions.Token = myEnginePayload.Token
-		myConfig.LocalAPIOptions.VeritoneAPIBaseURL = myEnginePayload.VeritoneAPIBaseURL
-
-		// Default to use Translation
-		if myEnginePayload.TaskPayload.DataRegistryID == "" {
-			myEnginePayload.TaskPayload.DataRegistryID = myConfig.DataRegistryIDs.Translation
-			myEnginePayload.TaskPayload.CategoryID = categoryTranslationID
-		}
-
-		// Check Category
-		if myEnginePayload.TaskPayload.CategoryID == "" {
-			myEnginePayload.TaskPayload.CategoryID = categoryTranslationID
-		}
+	// Response for the end func
+	resp := &api.Response{
+		EstimatedProcessingTimeInSeconds: maxTTL,
+	}
 
-		// Check MinPrecision
-		if myEnginePayload.TaskPayload.MinPrecision < 0 {
-			myEnginePayload.TaskPayload.MinPrecision = defaultMinPrecision
+	defer func() {
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			myAppContext.Logger.Errorf("Failed to write the process response: %s", err)
 		}
+		myAppContext.Logger.Infof("Engine Exit successfully.")
+	}()
+	// End: Response for the end func
 
-		// Add config to current context
-		myAppContext.Config = myConfig
-
-		// let's get the API
-		myAppContext.GraphQLClient, err = platform.NewCoreApi(myConfig.APIOptions)
-		if err != nil {
-			updateTaskStatusV3F("failed", "", "(GraphQLClient) Failed to get connection to Veritone platform: "+err.Error(), "invalid_data", heartbeatWebhook)
-			return
-		}
+	myConfig, err = loadConfig()
+	if err != nil {
+		updateTaskStatusV3F("failed", "", err.Error(), "invalid_data", heartbeatWebhook)
+		return
+	}
+	applyPayloadOverrides(&myConfig, &myEnginePayload)
+	if err := validateTaskConfig(myConfig, &myEnginePayload); err != nil {
+		updateTaskStatusV3F("failed", "", err.Error(), "invalid_data", heartbeatWebhook)
+		return
+	}
 
-		// Local api implementation vs. platform api from src-training-workflow...this is so you don't have to make changes in src-training-workflow for things used only here
-		myAppContext.LocalGraphQLClient, err = api.NewCoreAPI(myConfig.LocalAPIOptions)
-		if err != nil {
-			updateTaskStatusV3F("failed", "", "(LocalGraphQLClient) Failed to get connection to Veritone platform: "+err.Error(), "invalid_data", heartbeatWebhook)
-			return
-		}
+	category := categoryLabel(myEnginePayload.TaskPayload.CategoryID)
+	benchmarksInFlight.WithLabelValues(category).Inc()
+	defer benchmarksInFlight.WithLabelValues(category).Dec()
+	myConfig.LocalAPIOptions.Observer = graphQLObserver{category: category}
+	myConfig.LocalAPIOptions.Logger = graphQLLogger{logger: myAppContext.Logger}
+	myConfig.LocalAPIOptions.CorrelationID = correlationID
 
-		// set up stuff for shutting down handling due to signal or errors
-		gracefulShutdownCtx, _ := context.WithCancel(context.Background())
-		// var jobProcessingWaitGroup sync.WaitGroup
-		// go listenForSignals(gracefulShutdownCancelFn, &jobProcessingWaitGroup)
+	// Add config to current context
+	myAppContext.Config = myConfig
 
-		err = invokeService(gracefulShutdownCtx, myAppContext.LocalGraphQLClient, &myEnginePayload)
-		if err != nil {
+	// let's get the API
+	myAppContext.GraphQLClient, err = platform.NewCoreApi(myConfig.APIOptions)
+	if err != nil {
+		updateTaskStatusV3F("failed", "", "(GraphQLClient) Failed to get connection to Veritone platform: "+err.Error(), "invalid_data", heartbeatWebhook)
+		return
+	}
 
-			fmt.Printf("[ERROR]: Failed to benchmark -- err=%s\n", err)
-			// exitCode = 1
+	// Local api implementation vs. platform api from src-training-workflow...this is so you don't have to make changes in src-training-workflow for things used only here
+	myAppContext.LocalGraphQLClient, err = api.NewCoreAPI(myConfig.LocalAPIOptions)
+	if err != nil {
+		updateTaskStatusV3F("failed", "", "(LocalGraphQLClient) Failed to get connection to Veritone platform: "+err.Error(), "invalid_data", heartbeatWebhook)
+		return
+	}
 
-			// Update task status
-			updateTaskStatusV3F("failed", "", "Failed to benchmark: "+err.Error(), "internal_error", heartbeatWebhook)
+	// The shutdown context is cancelled by listenForSignals, which then waits for this request to flush its results
+	taskCtx := withLogger(gracefulShutdownCtx, myAppContext.Logger)
+	summary, err := invokeService(taskCtx, myAppContext.LocalGraphQLClient, &myEnginePayload)
+	if err != nil {
+		myAppContext.Logger.Errorf("Failed to benchmark -- err=%s", err)
 
+		if errors.Cause(err) == errInterrupted {
+			// The benchmark SDOs computed so far were written, so a retry of this task can pick up from here
+			updateTaskStatusV3F("failed", "", "Benchmark interrupted by an engine shutdown, retry the task to resume: "+err.Error(), failureReasonInterrupted, heartbeatWebhook)
 			return
 		}
 
 		// Update task status
-		updateTaskStatusV3F("complete", "Engine run successfully", "", "", heartbeatWebhook)
+		updateTaskStatusV3F("failed", "", "Failed to benchmark: "+err.Error(), "internal_error", heartbeatWebhook)
 
 		return
 	}
+
+	// Update task status
+	updateTaskStatusV3F("complete", summary.infoMessage(), "", "", heartbeatWebhook)
 }
 
 func updateTaskStatusV3F(taskStatus, infoMsg, failureMessage, failureReason, webhook string) error {
+	benchmarksTotal.WithLabelValues(categoryLabel(myEnginePayload.TaskPayload.CategoryID), taskStatus).Inc()
+
 	updateStatus := &api.UpdateStatus{
 		Status:         taskStatus,
-		InfoMsg:        infoMsg,
+		InfoMsg:        scrub(infoMsg),
 		FailureReason:  failureReason,
-		FailureMessage: failureMessage,
+		FailureMessage: scrub(failureMessage),
 	}
 	b, err := json.Marshal(updateStatus)
 	if err != nil {
-		fmt.Println("error:", err)
+		myAppContext.Logger.Errorf("Failed to marshal the task status: %s", err)
 		return err
 	}
 
@@ -192,41 +249,6 @@ func updateTaskStatusV3F(taskStatus, infoMsg, failureMessage, failureReason, web
 		return err
 	}
 	defer resp.Body.Close()
-	fmt.Printf("Success when UpdateTask to %s with status: %s, InfoMsg: %s, FailureReason: %s, FailureMessage: %s", resp.Status, taskStatus, infoMsg, failureReason, failureMessage)
+	myAppContext.Logger.Infof("Success when UpdateTask to %s with status: %s, InfoMsg: %s, FailureReason: %s, FailureMessage: %s", resp.Status, taskStatus, updateStatus.InfoMsg, failureReason, updateStatus.FailureMessage)
 	return nil
 }
-
-func loadEngineWrapperConfigFile() ManagerConfig {
-	res := ManagerConfig{
-		LocalServiceURL:   "http://localhost:35000",
-		LocalServiceCmd:   "python3 /app/main.py --port 35000",
-		LocalServiceRetry: 5}
-	configFile := os.Getenv("CONFIG_FILE")
-	if configFile != "" {
-		reader, err := os.Open(configFile)
-		if err == nil {
-			defer reader.Close()
-			err = json.NewDecoder(reader).Decode(&res)
-		}
-	} else {
-		reader, err := os.Open("./config.json")
-		if err == nil {
-			defer reader.Close()
-			err = json.NewDecoder(reader).Decode(&res)
-		}
-	}
-	// still need to read from command line
-	if localServiceCmd := os.Getenv("LOCAL_SERVICE_CMD"); localServiceCmd != "" {
-		res.LocalServiceCmd = localServiceCmd
-	}
-	if localServiceURL := os.Getenv("LOCAL_SERVICE_URL"); localServiceURL != "" {
-		res.LocalServiceURL = localServiceURL
-	}
-	if benchmarkID := os.Getenv("ENGINE_ID"); benchmarkID != "" {
-		res.EngineID = benchmarkID
-	} else {
-		res.EngineID = benchmarkEngineID
-	}
-
-	return res
-}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/veritone/translation-benchmark/api"
+)
+
+const metricsNamespace = "translation_benchmark"
+
+var (
+	benchmarksInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "benchmarks_in_flight",
+		Help:      "Number of benchmark tasks currently being processed.",
+	}, []string{"category"})
+
+	benchmarksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "benchmarks_total",
+		Help:      "Number of benchmark tasks processed, by final status.",
+	}, []string{"category", "status"})
+
+	assetsBenchmarkedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "assets_benchmarked_total",
+		Help:      "Number of assets scored and written as a benchmark SDO.",
+	}, []string{"category"})
+
+	assetFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "asset_failures_total",
+		Help:      "Number of assets that could not be benchmarked, by failure reason.",
+	}, []string{"category", "reason"})
+
+	qaFindingsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "qa_findings_total",
+		Help:      "Number of benchmarked assets flagged by a QA check, by check.",
+	}, []string{"category", "check"})
+
+	graphQLRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "graphql_request_duration_seconds",
+		Help:      "Duration of the GraphQL round trips to the Veritone platform.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"category", "result"})
+
+	graphQLRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "graphql_retries_total",
+		Help:      "Number of GraphQL requests retried.",
+	}, []string{"category"})
+
+	scoringDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "scoring_duration_seconds",
+		Help:      "Duration of the sclite execution scoring one asset against its baseline.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"category"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		benchmarksInFlight,
+		benchmarksTotal,
+		assetsBenchmarkedTotal,
+		assetFailuresTotal,
+		qaFindingsTotal,
+		graphQLRequestDuration,
+		graphQLRetriesTotal,
+		scoringDuration,
+	)
+}
+
+// categoryLabel the metrics label of an engine category ID
+func categoryLabel(categoryID string) string {
+	switch categoryID {
+	case categoryTranslationID, "":
+		return "translation"
+	case categoryTranscriptionID:
+		return "transcription"
+	case categoryFacialDetectionID:
+		return "face_detection"
+	}
+	return "other"
+}
+
+// graphQLObserver exports the GraphQL client timings and retries for one engine category
+type graphQLObserver struct {
+	category string
+}
+
+func (o graphQLObserver) ObserveRequest(duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	graphQLRequestDuration.WithLabelValues(o.category, result).Observe(duration.Seconds())
+}
+
+func (o graphQLObserver) ObserveRetry(attempt int) {
+	graphQLRetriesTotal.WithLabelValues(o.category).Inc()
+}
+
+// appendAssetWarning count the asset failure and append a warning about it to the running task
+func appendAssetWarning(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, taskID, assetID, reason, message string) error {
+	assetFailuresTotal.WithLabelValues(categoryLabel(myEnginePayload.TaskPayload.CategoryID), reason).Inc()
+	return graphQLClient.AppendWarningToTask(ctx, taskID, assetID, reason, scrub(message))
+}
+
+// appendQAWarning count the QA finding and append a warning about it to the running task
+func appendQAWarning(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, taskID, assetID, check, message string) error {
+	qaFindingsTotal.WithLabelValues(categoryLabel(myEnginePayload.TaskPayload.CategoryID), check).Inc()
+	return graphQLClient.AppendWarningToTask(ctx, taskID, assetID, check, scrub(message))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// scrapeMetrics the samples exported on /metrics, by name and labels as written in the exposition format
+func scrapeMetrics(t *testing.T) map[string]float64 {
+	server := httptest.NewServer(newServer())
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.LastIndex(line, " ")
+		if strings.HasPrefix(line, "#") || i < 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("sample %q: %v", line, err)
+		}
+		samples[line[:i]] = value
+	}
+	return samples
+}
+
+func TestMetricsRecordTheCategory(t *testing.T) {
+	defer func(payload BenchmarkEnginePayload) { myEnginePayload = payload }(myEnginePayload)
+	myEnginePayload = BenchmarkEnginePayload{TaskPayload: TaskPayload{CategoryID: categoryTranscriptionID}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"appendWarningToTask":true}}`))
+	}))
+	defer server.Close()
+	observer := graphQLObserver{category: categoryLabel(categoryTranscriptionID)}
+	client, err := api.NewCoreAPI(api.Options{VeritoneAPIBaseURL: server.URL, GraphQLEndpoint: "/", Token: "token", Observer: observer})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := scrapeMetrics(t)
+	ctx := context.Background()
+	if err := appendAssetWarning(ctx, client, "task", "asset", "fetch_failed", "Failed to fetch asset(asset)"); err != nil {
+		t.Fatal(err)
+	}
+	observer.ObserveRequest(2*time.Second, errors.New("timeout"))
+	observer.ObserveRetry(1)
+	after := scrapeMetrics(t)
+
+	samples := []struct {
+		name  string
+		delta float64
+	}{
+		{`translation_benchmark_asset_failures_total{category="transcription",reason="fetch_failed"}`, 1},
+		// the warning through the client
+		{`translation_benchmark_graphql_request_duration_seconds_count{category="transcription",result="success"}`, 1},
+		{`translation_benchmark_graphql_request_duration_seconds_count{category="transcription",result="error"}`, 1},
+		{`translation_benchmark_graphql_request_duration_seconds_bucket{category="transcription",result="error",le="3.2"}`, 1},
+		{`translation_benchmark_graphql_request_duration_seconds_bucket{category="transcription",result="error",le="1.6"}`, 0},
+		{`translation_benchmark_graphql_retries_total{category="transcription"}`, 1},
+	}
+	for _, sample := range samples {
+		if _, ok := after[sample.name]; !ok {
+			t.Errorf("%s is not exported", sample.name)
+			continue
+		}
+		if delta := after[sample.name] - before[sample.name]; delta != sample.delta {
+			t.Errorf("%s went up by %v, want %v", sample.name, delta, sample.delta)
+		}
+	}
+}
+
+func TestCategoryLabel(t *testing.T) {
+	tests := []struct {
+		categoryID, want string
+	}{
+		{"", "translation"},
+		{categoryTranslationID, "translation"},
+		{categoryTranscriptionID, "transcription"},
+		{categoryFacialDetectionID, "face_detection"},
+		{"unknown", "other"},
+	}
+	for _, test := range tests {
+		if got := categoryLabel(test.categoryID); got != test.want {
+			t.Errorf("categoryLabel(%q) = %q, want %q", test.categoryID, got, test.want)
+		}
+	}
+}
@@ -56,7 +56,7 @@ type BenchmarkEnginePayload struct {
 	TaskID             string      `json:"taskId,omitempty"`
 	TDOID              string      `json:"recordingId,omitempty"`
 	OrganizationID     string      `json:"organizationId,omitempty"`
-	Token              string      `json:"token,omitempty"`
+	Token              secret      `json:"token,omitempty"`
 	VeritoneAPIBaseURL string      `json:"veritoneApiBaseUrl,omitempty"`
 	TaskPayload        TaskPayload `json:"taskPayload,omitempty"`
 	Debug              bool        `json:"debug,omitempty"`
@@ -77,6 +77,33 @@ type TaskPayload struct {
 	DataRegistryID   string   `json:"dataRegistryId"`
 	CategoryID       string   `json:"categoryId"`
 	MinPrecision     float64  `json:"minPrecision"`
+	// Oracle also score the best path through the alternatives (n-best) of each output
+	Oracle bool `json:"oracle"`
+	// TargetLanguage the language the outputs should be in, the language of the baseline when empty
+	TargetLanguage string `json:"targetLanguage"`
+	// Glossary the terms the outputs must use, with the terms of the glossary asset when one is set
+	Glossary        []glossaryTerm `json:"glossary"`
+	GlossaryAssetID string         `json:"glossaryAssetId"`
+	// Subtitles score the outputs as subtitles, a subtitle per series, against these rules
+	Subtitles *subtitleRules `json:"subtitles"`
+	// TimingTolerancesMs the tolerances the timing errors are checked against, 100, 250 and 500 ms by default
+	TimingTolerancesMs []int `json:"timingTolerancesMs"`
+	// TDOIDs the TDOs whose outputs are benchmarked in the tdos, job and training modes
+	TDOIDs []string `json:"tdoIds"`
+	// EngineIDs the engines whose outputs on the TDOs are benchmarked, all but the baseline engine when empty
+	EngineIDs []string `json:"engineIds"`
+	// BaselineEngineID the engine whose latest output on each TDO is the baseline, unless baselineAssetIds is set
+	BaselineEngineID string `json:"baselineEngineId"`
+	// Engines the engines the job mode runs on each TDO
+	Engines PayloadEngines `json:"engines"`
+	// CandidateModelID the model the training mode benchmarks, read from the training SDO when empty
+	CandidateModelID string `json:"candidateModelId"`
+	// TaskIDs the two benchmark tasks the compare-tasks mode compares, the first one being the reference
+	TaskIDs []string `json:"taskIds"`
+	// DuplicateAssets which outputs to benchmark when a TDO has several outputs of one engine
+	DuplicateAssets *duplicateRules `json:"duplicateAssets"`
+	// Promotion when a challenger model replaces the champion model of its engine
+	Promotion *promotionRules `json:"promotion"`
 }
 
 // PayloadEngines what an array of PayloadEngine would be
@@ -107,6 +134,10 @@ type BenchmarkSDOData struct {
 	SuccessTDOs         []string     `json:"successTDOs,omitempty"`
 	IsAvg               bool         `json:"isAvg,omitempty"`
 	TrainingJob         SDOReference `json:"trainingJob,omitempty"`
+	// Rankings the models of each engine benchmarked with several models, by decreasing BLEU
+	Rankings []modelRanking `json:"rankings,omitempty"`
+	// Decisions whether the challenger models replace the champion models
+	Decisions []promotionDecision `json:"decisions,omitempty"`
 }
 
 // AssetBenchmarkSDOData the asset benchmark SDO object
@@ -127,11 +158,36 @@ type AssetBenchmarkSDODataForTranscription struct {
 	Precision     float64 `json:"precision"`
 	Recall        float64 `json:"recall"`
 	WordErrorRate float64 `json:"wordErrorRate"`
+	// BLEU the sentence BLEU of the output against the baseline, in points
+	BLEU float64 `json:"bleu"`
+	// BLEUStats the n-gram statistics of the BLEU, to compute the corpus BLEU of the outputs of a model
+	BLEUStats *bleuStats `json:"bleuStats,omitempty"`
+	// Oracle the best path through the alternatives of the output, when requested by the payload
+	Oracle *oracleMetrics `json:"oracle,omitempty"`
+	// Calibration how well the word confidences predict the word errors, when the output has confidences
+	Calibration *calibrationMetrics `json:"calibration,omitempty"`
+	// Speakers the per-speaker breakdown, when both the baseline and the output have speakers
+	Speakers *speakerMetrics `json:"speakers,omitempty"`
+	// Languages the per-language breakdown and language ID agreement, when the baseline or the output have languages
+	Languages *languageMetrics `json:"languages,omitempty"`
+	// Glossary how the glossary terms of the baseline were rendered, when the payload has a glossary
+	Glossary *glossaryMetrics `json:"glossary,omitempty"`
+	// Subtitles the subtitle edit rate and rule violations, when the payload requests subtitle scoring
+	Subtitles *subtitleMetrics `json:"subtitles,omitempty"`
+	// Timing the word and segment timing errors, when both the baseline and the output are timed
+	Timing *timingMetrics `json:"timing,omitempty"`
+	// QA the reference-free sanity checks of the output
+	QA *qaMetrics `json:"qa,omitempty"`
+	// Performance the queue wait, processing time and real-time factor of the task that produced the output
+	Performance *performanceMetrics `json:"performance,omitempty"`
+	// Selection how the output was chosen, when its engine has several outputs on the TDO
+	Selection *assetSelection `json:"selection,omitempty"`
 	// For SRC Training Workflow
 	TrainingSDO *SDOReference `json:"trainingSdo,omitempty"`
 }
 
-// AssetBenchmarkSDODataForFaceDetection the asset benchmark SDO object
+// AssetBenchmarkSDODataForFaceDetection the asset benchmark SDO object. The engine only scores transcription outputs and
+// never writes it, the type only gives the schema of the face detection registry, so ProcessingTimeMs stays unset.
 type AssetBenchmarkSDODataForFaceDetection struct {
 	BenchmarkJobID  string `json:"benchmarkJobId"`
 	BenchmarkTaskID string `json:"benchmarkTaskId"`
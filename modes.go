@@ -0,0 +1,517 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// the modes of the payload, selecting what is benchmarked
+const (
+	// modeAssets benchmark the assets of the payload against its baseline assets, the default
+	modeAssets = "assets"
+	// modeTDOs benchmark the latest outputs found on the TDOs of the payload
+	modeTDOs = "tdos"
+	// modeJob run the engines of the payload on its TDOs, then benchmark their outputs
+	modeJob = "job"
+	// modeTraining benchmark the candidate model of a src-training-workflow SDO
+	modeTraining = "training"
+	// modeCompareTasks compare the benchmark SDOs written by two previous tasks
+	modeCompareTasks = "compare-tasks"
+)
+
+// benchmarkMode how a mode finds what to benchmark. The modes scoring outputs share processAssets and its persistence.
+type benchmarkMode interface {
+	// validate add the problems of the payload fields the mode needs
+	validate(taskPayload *TaskPayload, problems *payloadError)
+	// run benchmark what the payload selects
+	run(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, enginePayload *BenchmarkEnginePayload, benchmarkSchemaID string, cp *checkpoint) (*benchmarkSummary, error)
+}
+
+// benchmarkModes the mode of each mode name
+var benchmarkModes = map[string]benchmarkMode{
+	modeAssets:       assetsMode{},
+	modeTDOs:         tdosMode{},
+	modeJob:          jobMode{},
+	modeTraining:     trainingMode{},
+	modeCompareTasks: compareTasksMode{},
+}
+
+// payloadMode the mode of the payload, set at its top level or in its task payload, assets by default
+func payloadMode(enginePayload *BenchmarkEnginePayload) (string, error) {
+	mode, taskMode := enginePayload.Mode, enginePayload.TaskPayload.Mode
+	if mode != "" && taskMode != "" && mode != taskMode {
+		return "", fmt.Errorf("payload.mode %q and payload.taskPayload.mode %q disagree", mode, taskMode)
+	}
+	if mode == "" {
+		mode = taskMode
+	}
+	if mode == "" {
+		mode = modeAssets
+	}
+	if _, ok := benchmarkModes[mode]; !ok {
+		return "", fmt.Errorf("mode %q is not one of %s", mode, strings.Join(modeNames(), ", "))
+	}
+	return mode, nil
+}
+
+func modeNames() []string {
+	names := make([]string, 0, len(benchmarkModes))
+	for name := range benchmarkModes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateMode add the problems of the mode of the payload and of the fields it needs
+func validateMode(enginePayload *BenchmarkEnginePayload, problems *payloadError) {
+	mode, err := payloadMode(enginePayload)
+	if err != nil {
+		problems.add("%s", err)
+		return
+	}
+	benchmarkModes[mode].validate(&enginePayload.TaskPayload, problems)
+}
+
+// assetsMode benchmark the asset lists of the payload
+type assetsMode struct{}
+
+func (assetsMode) validate(taskPayload *TaskPayload, problems *payloadError) {
+	if len(taskPayload.AssetIDs) == 0 {
+		problems.add("payload.taskPayload.assetIds needs at least one asset in the %s mode", modeAssets)
+	}
+	if len(taskPayload.BaselineAssetIDs) == 0 {
+		problems.add("payload.taskPayload.baselineAssetIds needs at least one asset in the %s mode", modeAssets)
+	}
+}
+
+func (assetsMode) run(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, enginePayload *BenchmarkEnginePayload, benchmarkSchemaID string, cp *checkpoint) (*benchmarkSummary, error) {
+	return processAssets(ctx, graphQLClient, enginePayload, benchmarkSchemaID, cp, enginePayload.TaskPayload.AssetIDs, enginePayload.TaskPayload.BaselineAssetIDs)
+}
+
+// tdosMode benchmark the latest output of each engine on the TDOs of the payload
+type tdosMode struct{}
+
+func (tdosMode) validate(taskPayload *TaskPayload, problems *payloadError) {
+	if len(taskPayload.TDOIDs) == 0 {
+		problems.add("payload.taskPayload.tdoIds needs at least one TDO in the %s mode", modeTDOs)
+	}
+	validateBaselineSource(taskPayload, modeTDOs, problems)
+}
+
+func (tdosMode) run(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, enginePayload *BenchmarkEnginePayload, benchmarkSchemaID string, cp *checkpoint) (*benchmarkSummary, error) {
+	taskPayload := &enginePayload.TaskPayload
+	assetIDs, baselineAssetIDs, err := discoverTDOAssets(ctx, graphQLClient, taskPayload, taskPayload.TDOIDs, taskPayload.EngineIDs, nil)
+	if err != nil {
+		return nil, err
+	}
+	return processAssets(ctx, graphQLClient, enginePayload, benchmarkSchemaID, cp, assetIDs, baselineAssetIDs)
+}
+
+// validateBaselineSource the modes discovering the outputs on TDOs need the baseline assets or the baseline engine
+func validateBaselineSource(taskPayload *TaskPayload, mode string, problems *payloadError) {
+	if len(taskPayload.BaselineAssetIDs) == 0 && taskPayload.BaselineEngineID == "" {
+		problems.add("payload.taskPayload.baselineEngineId or payload.taskPayload.baselineAssetIds is required in the %s mode", mode)
+	}
+}
+
+// discoverTDOAssets find on each TDO the latest output of each engine to benchmark and, unless the payload has
+// baseline assets, the latest output of the baseline engine. The engines to benchmark are all but the baseline engine
+// when engineIDs is empty. With taskIDs, only the outputs of these tasks are benchmarked.
+func discoverTDOAssets(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, taskPayload *TaskPayload, tdoIDs, engineIDs []string, taskIDs map[string]bool) (assetIDs, baselineAssetIDs []string, err error) {
+	logger := logFrom(ctx)
+	baselineAssetIDs = taskPayload.BaselineAssetIDs
+	for _, tdoID := range tdoIDs {
+		tdo, err := graphQLClient.FetchTDOOutputs(ctx, tdoID, "")
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to fetch the outputs of TDO %s", tdoID)
+		}
+		if tdo == nil {
+			return nil, nil, fmt.Errorf("TDO %s was not found", tdoID)
+		}
+
+		var baselineAssetID string
+		var found []string
+		latest := make(map[string]bool)
+		// the assets are sorted newest first, so the first asset of each engine is its latest output
+		for _, asset := range tdo.Assets.Records {
+			if asset.SourceData.Engine == nil {
+				continue
+			}
+			engineID := asset.SourceData.Engine.ID
+			if engineID == taskPayload.BaselineEngineID {
+				if baselineAssetID == "" {
+					baselineAssetID = asset.ID
+				}
+				continue
+			}
+			if latest[engineID] || engineID == myAppContext.Config.EngineID {
+				continue
+			}
+			if len(engineIDs) > 0 && !stringInSlice(engineID, engineIDs) {
+				continue
+			}
+			if taskIDs != nil && !taskIDs[asset.SourceData.TaskID] {
+				continue
+			}
+			latest[engineID] = true
+			found = append(found, asset.ID)
+		}
+
+		if len(taskPayload.BaselineAssetIDs) == 0 {
+			if baselineAssetID == "" {
+				logger.Warnf("TDO %s has no output of the baseline engine %s, skipping its %d outputs", tdoID, taskPayload.BaselineEngineID, len(found))
+				continue
+			}
+			baselineAssetIDs = append(baselineAssetIDs, baselineAssetID)
+		}
+		logger.Infof("Found %d outputs to benchmark on TDO %s", len(found), tdoID)
+		assetIDs = append(assetIDs, found...)
+	}
+	if len(assetIDs) == 0 {
+		return nil, nil, fmt.Errorf("no output to benchmark was found on the %d TDOs", len(tdoIDs))
+	}
+	return assetIDs, baselineAssetIDs, nil
+}
+
+// jobMode run the engines of the payload on its TDOs and benchmark their outputs once the jobs are done
+type jobMode struct{}
+
+func (jobMode) validate(taskPayload *TaskPayload, problems *payloadError) {
+	if len(taskPayload.TDOIDs) == 0 {
+		problems.add("payload.taskPayload.tdoIds needs at least one TDO in the %s mode", modeJob)
+	}
+	if len(taskPayload.Engines) == 0 {
+		problems.add("payload.taskPayload.engines needs at least one engine in the %s mode", modeJob)
+	}
+	validateBaselineSource(taskPayload, modeJob, problems)
+}
+
+func (jobMode) run(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, enginePayload *BenchmarkEnginePayload, benchmarkSchemaID string, cp *checkpoint) (*benchmarkSummary, error) {
+	logger := logFrom(ctx)
+	taskPayload := &enginePayload.TaskPayload
+	tasks := make([]api.CreateJobTask, 0, len(taskPayload.Engines))
+	engineIDs := make([]string, 0, len(taskPayload.Engines))
+	for _, engine := range taskPayload.Engines {
+		task := api.CreateJobTask{EngineID: engine.EngineID}
+		if engine.ModelID != "" {
+			task.Payload = map[string]interface{}{"modelId": engine.ModelID}
+		}
+		tasks = append(tasks, task)
+		engineIDs = append(engineIDs, engine.EngineID)
+	}
+
+	jobs := make(map[string]*api.Job, len(taskPayload.TDOIDs))
+	for _, tdoID := range taskPayload.TDOIDs {
+		job, err := tdoJob(ctx, graphQLClient, cp, tdoID, tasks)
+		if err != nil {
+			return nil, err
+		}
+		jobs[tdoID] = job
+	}
+
+	if err := waitForJobs(ctx, graphQLClient, jobs); err != nil {
+		return nil, err
+	}
+
+	// only benchmark the outputs of the tasks that completed
+	var tdoIDs []string
+	taskIDs := make(map[string]bool)
+	for _, tdoID := range taskPayload.TDOIDs {
+		job := jobs[tdoID]
+		var completed int
+		for _, task := range job.Tasks.Records {
+			if task.Status == "complete" {
+				taskIDs[task.TaskID] = true
+				completed++
+			} else {
+				logger.Warnf("Task %s of engine %s in job %s ended %s, its output is not benchmarked", task.TaskID, task.Engine.ID, job.JobID, task.Status)
+			}
+		}
+		if completed > 0 {
+			tdoIDs = append(tdoIDs, tdoID)
+		}
+	}
+	if len(tdoIDs) == 0 {
+		return nil, fmt.Errorf("none of the %d jobs completed a task", len(jobs))
+	}
+
+	assetIDs, baselineAssetIDs, err := discoverTDOAssets(ctx, graphQLClient, taskPayload, tdoIDs, engineIDs, taskIDs)
+	if err != nil {
+		return nil, err
+	}
+	return processAssets(ctx, graphQLClient, enginePayload, benchmarkSchemaID, cp, assetIDs, baselineAssetIDs)
+}
+
+// tdoJob the job running the engines on the TDO, the one a previous attempt of the task created if the checkpoint
+// recorded it, else a new job
+func tdoJob(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, cp *checkpoint, tdoID string, tasks []api.CreateJobTask) (*api.Job, error) {
+	logger := logFrom(ctx)
+	if jobID := cp.jobID(tdoID); jobID != "" {
+		job, err := graphQLClient.FetchJob(ctx, jobID)
+		if err == nil && job != nil {
+			logger.Infof("Resuming job %s created on TDO %s by a previous attempt", jobID, tdoID)
+			return job, nil
+		}
+		logger.Warnf("Failed to fetch job %s created on TDO %s by a previous attempt, creating another one: %v", jobID, tdoID, err)
+	}
+
+	job, err := graphQLClient.CreateJob(ctx, tdoID, true, tasks...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create the job on TDO %s", tdoID)
+	}
+	logger.Infof("Created job %s running %d engines on TDO %s", job.JobID, len(tasks), tdoID)
+	if err := cp.markJob(tdoID, job.JobID); err != nil {
+		logger.Warnf("Failed to checkpoint job %s due to: %s", job.JobID, err)
+	}
+	return job, nil
+}
+
+// isJobDone whether the job status is final
+func isJobDone(status string) bool {
+	switch status {
+	case "complete", "failed", "cancelled", "aborted":
+		return true
+	}
+	return false
+}
+
+// jobPollInterval how long waitForJobs waits between two polls of the jobs
+var jobPollInterval = time.Duration(pollTimeoutInSec/int64(pollCount)) * time.Second
+
+// waitForJobs poll the jobs, every jobPollInterval up to pollCount times, until they are all done.
+// The jobs are updated in place.
+func waitForJobs(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, jobs map[string]*api.Job) error {
+	for poll := 0; poll < pollCount; poll++ {
+		pending := 0
+		for tdoID, job := range jobs {
+			if isJobDone(job.Status) {
+				continue
+			}
+			updated, err := graphQLClient.FetchJob(ctx, job.JobID)
+			if err == nil && updated == nil {
+				err = errors.New("the job was not found")
+			}
+			if err != nil {
+				logFrom(ctx).Warnf("Failed to poll job %s due to: %s", job.JobID, err)
+				pending++
+				continue
+			}
+			jobs[tdoID] = updated
+			if !isJobDone(updated.Status) {
+				pending++
+			}
+		}
+		if pending == 0 {
+			return nil
+		}
+		logFrom(ctx).Infof("Waiting for %d of %d jobs", pending, len(jobs))
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(errInterrupted, "%d jobs were still running", pending)
+		case <-time.After(jobPollInterval):
+		}
+	}
+	return fmt.Errorf("the jobs did not finish within %d seconds", pollTimeoutInSec)
+}
+
+// trainingMode benchmark the outputs of the payload, which must include outputs of the candidate model of the
+// training SDO. The benchmark SDOs reference the training SDO.
+type trainingMode struct{}
+
+func (trainingMode) validate(taskPayload *TaskPayload, problems *payloadError) {
+	if taskPayload.TrainingWorkflowSDOID == "" || taskPayload.TrainingWorkflowSDOSchemaID == "" {
+		problems.add("payload.taskPayload.sdoId and payload.taskPayload.schemaId are required in the %s mode", modeTraining)
+	}
+	if len(taskPayload.TDOIDs) > 0 {
+		validateBaselineSource(taskPayload, modeTraining, problems)
+	} else if len(taskPayload.AssetIDs) == 0 || len(taskPayload.BaselineAssetIDs) == 0 {
+		problems.add("payload.taskPayload.tdoIds, or payload.taskPayload.assetIds and baselineAssetIds, are required in the %s mode", modeTraining)
+	}
+}
+
+func (trainingMode) run(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, enginePayload *BenchmarkEnginePayload, benchmarkSchemaID string, cp *checkpoint) (*benchmarkSummary, error) {
+	taskPayload := &enginePayload.TaskPayload
+	candidateModelID := taskPayload.CandidateModelID
+	if candidateModelID == "" {
+		sdo, err := graphQLClient.FetchSDO(ctx, taskPayload.TrainingWorkflowSDOID, taskPayload.TrainingWorkflowSDOSchemaID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to fetch the training SDO %s", taskPayload.TrainingWorkflowSDOID)
+		}
+		if sdo != nil {
+			candidateModelID, _ = sdo.Data["modelId"].(string)
+		}
+		if candidateModelID == "" {
+			return nil, fmt.Errorf("the training SDO %s has no modelId and the payload has no candidateModelId", taskPayload.TrainingWorkflowSDOID)
+		}
+	}
+	logFrom(ctx).Infof("Benchmarking the candidate model %s of the training SDO %s", candidateModelID, taskPayload.TrainingWorkflowSDOID)
+	// the candidate challenges the champion of its engine
+	taskPayload.CandidateModelID = candidateModelID
+
+	assetIDs, baselineAssetIDs := taskPayload.AssetIDs, taskPayload.BaselineAssetIDs
+	if len(taskPayload.TDOIDs) > 0 {
+		var err error
+		assetIDs, baselineAssetIDs, err = discoverTDOAssets(ctx, graphQLClient, taskPayload, taskPayload.TDOIDs, taskPayload.EngineIDs, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	summary, err := processAssets(ctx, graphQLClient, enginePayload, benchmarkSchemaID, cp, assetIDs, baselineAssetIDs)
+	if err != nil {
+		return nil, err
+	}
+	summary.CandidateModelID = candidateModelID
+	if summary.modelAssets(candidateModelID) == 0 && summary.SkippedAssets == 0 {
+		return nil, fmt.Errorf("no output of the candidate model %s was benchmarked", candidateModelID)
+	}
+	return summary, nil
+}
+
+// compareTasksMode compare the benchmark SDOs of two previous tasks, paired by TDO, engine and model
+type compareTasksMode struct{}
+
+func (compareTasksMode) validate(taskPayload *TaskPayload, problems *payloadError) {
+	if len(taskPayload.TaskIDs) != 2 {
+		problems.add("payload.taskPayload.taskIds needs exactly two tasks in the %s mode, got %d", modeCompareTasks, len(taskPayload.TaskIDs))
+	}
+}
+
+func (compareTasksMode) run(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, enginePayload *BenchmarkEnginePayload, benchmarkSchemaID string, cp *checkpoint) (*benchmarkSummary, error) {
+	taskIDs := enginePayload.TaskPayload.TaskIDs
+	var runs [2]map[string]benchmarkRecord
+	for i, taskID := range taskIDs {
+		records, err := fetchTaskRecords(ctx, graphQLClient, benchmarkSchemaID, taskID)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, fmt.Errorf("task %s has no benchmark SDO", taskID)
+		}
+		runs[i] = records
+	}
+	comparison := compareRuns(taskIDs[0], taskIDs[1], runs[0], runs[1])
+	for _, change := range comparison.changes {
+		logFrom(ctx).Infof("%s: word error rate %.4f -> %.4f", change.key, change.reference, change.compared)
+	}
+	return &benchmarkSummary{Comparison: comparison}, nil
+}
+
+// benchmarkRecord the metrics of a benchmark SDO that are compared
+type benchmarkRecord struct {
+	tdoID, engineID, modelID, assetID string
+	WordErrorRate                     float64
+}
+
+// fetchTaskRecords the benchmark SDOs of the task, keyed by recordKeys
+func fetchTaskRecords(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, benchmarkSchemaID, taskID string) (map[string]benchmarkRecord, error) {
+	var records []benchmarkRecord
+	filter := map[string]interface{}{"benchmarkTaskId": taskID}
+	err := fetchBenchmarkSDOs(ctx, graphQLClient, benchmarkSchemaID, filter, func(sdo api.SDO) {
+		record := benchmarkRecord{}
+		record.tdoID, _ = sdo.Data["tdoId"].(string)
+		record.engineID, _ = sdo.Data["engineId"].(string)
+		record.modelID, _ = sdo.Data["modelId"].(string)
+		record.assetID, _ = sdo.Data["assetId"].(string)
+		wordErrorRate, ok := sdo.Data["wordErrorRate"].(float64)
+		if record.tdoID == "" || !ok {
+			return
+		}
+		record.WordErrorRate = wordErrorRate
+		records = append(records, record)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch the benchmark SDOs of task %s", taskID)
+	}
+	return recordKeys(records), nil
+}
+
+// recordKeys key the records by TDO, engine and model, which two runs share while the output assets of each run are
+// new. Several outputs of a model on a TDO are told apart by their rank in asset ID order.
+func recordKeys(records []benchmarkRecord) map[string]benchmarkRecord {
+	sort.Slice(records, func(i, j int) bool { return records[i].assetID < records[j].assetID })
+	keyed := make(map[string]benchmarkRecord, len(records))
+	outputs := make(map[string]int)
+	for _, record := range records {
+		key := record.tdoID + "/" + record.engineID + "/" + record.modelID
+		outputs[key]++
+		if n := outputs[key]; n > 1 {
+			key = fmt.Sprintf("%s#%d", key, n)
+		}
+		keyed[key] = record
+	}
+	return keyed
+}
+
+// recordChange the word error rate of a TDO, engine and model in both tasks
+type recordChange struct {
+	key                 string
+	reference, compared float64
+}
+
+// taskComparison the word error rates of the outputs benchmarked by both tasks
+type taskComparison struct {
+	ReferenceTaskID string
+	ComparedTaskID  string
+	Paired          int
+	// OnlyInReference and OnlyInCompared the outputs benchmarked by one task only
+	OnlyInReference int
+	OnlyInCompared  int
+	Improved        int
+	Regressed       int
+	Unchanged       int
+	// MeanReferenceWER and MeanComparedWER the mean word error rates of the paired outputs
+	MeanReferenceWER float64
+	MeanComparedWER  float64
+	changes          []recordChange
+}
+
+// compareRuns pair the records of the two tasks
+func compareRuns(referenceTaskID, comparedTaskID string, reference, compared map[string]benchmarkRecord) *taskComparison {
+	comparison := &taskComparison{ReferenceTaskID: referenceTaskID, ComparedTaskID: comparedTaskID}
+	keys := make([]string, 0, len(reference))
+	for key := range reference {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		other, ok := compared[key]
+		if !ok {
+			comparison.OnlyInReference++
+			continue
+		}
+		before, after := reference[key].WordErrorRate, other.WordErrorRate
+		comparison.Paired++
+		comparison.MeanReferenceWER += before
+		comparison.MeanComparedWER += after
+		switch {
+		case after < before:
+			comparison.Improved++
+		case after > before:
+			comparison.Regressed++
+		default:
+			comparison.Unchanged++
+		}
+		comparison.changes = append(comparison.changes, recordChange{key: key, reference: before, compared: after})
+	}
+	comparison.OnlyInCompared = len(compared) - comparison.Paired
+	if comparison.Paired > 0 {
+		comparison.MeanReferenceWER /= float64(comparison.Paired)
+		comparison.MeanComparedWER /= float64(comparison.Paired)
+	}
+	return comparison
+}
+
+// message the comparison for the info message of the task
+func (c *taskComparison) message() string {
+	return fmt.Sprintf("Compared task %s with task %s: %d outputs paired (%d only in %s, %d only in %s), mean word error rate %.4f -> %.4f, %d improved, %d regressed, %d unchanged",
+		c.ReferenceTaskID, c.ComparedTaskID, c.Paired, c.OnlyInReference, c.ReferenceTaskID, c.OnlyInCompared, c.ComparedTaskID,
+		c.MeanReferenceWER, c.MeanComparedWER, c.Improved, c.Regressed, c.Unchanged)
+}
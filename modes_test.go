@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/veritone/translation-benchmark/api"
+)
+
+func TestPayloadMode(t *testing.T) {
+	tests := []struct {
+		name              string
+		mode, taskMode    string
+		want, wantProblem string
+	}{
+		{"assets by default", "", "", modeAssets, ""},
+		{"top level", modeJob, "", modeJob, ""},
+		{"task payload", "", modeTDOs, modeTDOs, ""},
+		{"both agree", modeTraining, modeTraining, modeTraining, ""},
+		{"both disagree", modeJob, modeTDOs, "", `payload.mode "job" and payload.taskPayload.mode "tdos" disagree`},
+		{"unknown", "", "files", "", `mode "files" is not one of assets, compare-tasks, job, tdos, training`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := &BenchmarkEnginePayload{Mode: test.mode, TaskPayload: TaskPayload{Mode: test.taskMode}}
+			mode, err := payloadMode(payload)
+			if test.wantProblem != "" {
+				if err == nil || err.Error() != test.wantProblem {
+					t.Errorf("payloadMode() error = %v, want %q", err, test.wantProblem)
+				}
+				return
+			}
+			if err != nil || mode != test.want {
+				t.Errorf("payloadMode() = %q, %v, want %q", mode, err, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateMode(t *testing.T) {
+	engines := PayloadEngines{{EngineID: "engine1", ModelID: "model1"}}
+	tests := []struct {
+		name         string
+		taskPayload  TaskPayload
+		wantProblems []string
+	}{
+		{"assets", TaskPayload{AssetIDs: []string{"a1"}, BaselineAssetIDs: []string{"b1"}}, nil},
+		{"assets without assets", TaskPayload{}, []string{"assetIds needs at least one asset", "baselineAssetIds needs at least one asset"}},
+		{"tdos with a baseline engine", TaskPayload{Mode: modeTDOs, TDOIDs: []string{"tdo1"}, BaselineEngineID: "engine0"}, nil},
+		{"tdos with baseline assets", TaskPayload{Mode: modeTDOs, TDOIDs: []string{"tdo1"}, BaselineAssetIDs: []string{"b1"}}, nil},
+		{"tdos without a baseline", TaskPayload{Mode: modeTDOs, TDOIDs: []string{"tdo1"}}, []string{"baselineEngineId or payload.taskPayload.baselineAssetIds is required in the tdos mode"}},
+		{"tdos without TDOs", TaskPayload{Mode: modeTDOs, BaselineEngineID: "engine0"}, []string{"tdoIds needs at least one TDO in the tdos mode"}},
+		{"job", TaskPayload{Mode: modeJob, TDOIDs: []string{"tdo1"}, Engines: engines, BaselineEngineID: "engine0"}, nil},
+		{"job without engines", TaskPayload{Mode: modeJob, TDOIDs: []string{"tdo1"}, BaselineEngineID: "engine0"}, []string{"engines needs at least one engine in the job mode"}},
+		{"training on assets", TaskPayload{Mode: modeTraining, TrainingWorkflowSDOID: "sdo1", TrainingWorkflowSDOSchemaID: "schema1", AssetIDs: []string{"a1"}, BaselineAssetIDs: []string{"b1"}}, nil},
+		{"training on TDOs", TaskPayload{Mode: modeTraining, TrainingWorkflowSDOID: "sdo1", TrainingWorkflowSDOSchemaID: "schema1", TDOIDs: []string{"tdo1"}, BaselineEngineID: "engine0"}, nil},
+		{"training without SDO or outputs", TaskPayload{Mode: modeTraining}, []string{"sdoId and payload.taskPayload.schemaId are required", "tdoIds, or payload.taskPayload.assetIds and baselineAssetIds, are required"}},
+		{"compare-tasks", TaskPayload{Mode: modeCompareTasks, TaskIDs: []string{"t1", "t2"}}, nil},
+		{"compare-tasks with one task", TaskPayload{Mode: modeCompareTasks, TaskIDs: []string{"t1"}}, []string{"taskIds needs exactly two tasks in the compare-tasks mode, got 1"}},
+		{"unknown mode", TaskPayload{Mode: "files"}, []string{`mode "files" is not one of`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems := &payloadError{}
+			validateMode(&BenchmarkEnginePayload{TaskPayload: test.taskPayload}, problems)
+			if len(problems.problems) != len(test.wantProblems) {
+				t.Fatalf("problems = %q, want %d problems", problems.problems, len(test.wantProblems))
+			}
+			for i, want := range test.wantProblems {
+				if !strings.Contains(problems.problems[i], want) {
+					t.Errorf("problem %d = %q, want it to contain %q", i, problems.problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+// testTDOOutputs a temporalDataObject response with an output per engine and task, newest first
+func testTDOOutputs(outputs ...[3]string) interface{} {
+	records := make([]map[string]interface{}, 0, len(outputs))
+	for _, output := range outputs {
+		assetID, engineID, taskID := output[0], output[1], output[2]
+		records = append(records, map[string]interface{}{
+			"id":         assetID,
+			"sourceData": map[string]interface{}{"taskId": taskID, "engine": map[string]interface{}{"id": engineID, "name": engineID}},
+		})
+	}
+	return map[string]interface{}{"temporalDataObject": map[string]interface{}{"assets": map[string]interface{}{"records": records}}}
+}
+
+func TestDiscoverTDOAssets(t *testing.T) {
+	myAppContext.Config.EngineID = "benchmark"
+	defer func() { myAppContext.Config.EngineID = "" }()
+	outputs := map[string]interface{}{
+		"tdo1": testTDOOutputs(
+			[3]string{"a3", "engine1", "task3"},
+			[3]string{"a2", "engine1", "task2"},
+			[3]string{"b2", "baseline", "task0"},
+			[3]string{"a1", "engine2", "task1"},
+			[3]string{"b1", "baseline", "task0"},
+			// the outputs of the benchmark engine itself are never benchmarked
+			[3]string{"x1", "benchmark", "task0"},
+		),
+		// no baseline output
+		"tdo2": testTDOOutputs([3]string{"a4", "engine1", "task4"}),
+	}
+	client, closeServer := testGraphQLServer(t, func(query string, variables map[string]interface{}) interface{} {
+		return outputs[variables["tdoId"].(string)]
+	})
+	defer closeServer()
+
+	tests := []struct {
+		name                      string
+		taskPayload               TaskPayload
+		engineIDs                 []string
+		taskIDs                   map[string]bool
+		wantAssets, wantBaselines []string
+		wantErr                   bool
+	}{
+		{"latest output of each engine but the baseline", TaskPayload{BaselineEngineID: "baseline"}, nil, nil, []string{"a3", "a1"}, []string{"b2"}, false},
+		{"selected engines", TaskPayload{BaselineEngineID: "baseline"}, []string{"engine2"}, nil, []string{"a1"}, []string{"b2"}, false},
+		{"outputs of the tasks", TaskPayload{BaselineEngineID: "baseline"}, nil, map[string]bool{"task2": true}, []string{"a2"}, []string{"b2"}, false},
+		{"baseline assets of the payload", TaskPayload{BaselineAssetIDs: []string{"b0"}}, []string{"engine1"}, nil, []string{"a3", "a4"}, []string{"b0"}, false},
+		{"no output", TaskPayload{BaselineEngineID: "baseline"}, []string{"engine3"}, nil, nil, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assetIDs, baselineAssetIDs, err := discoverTDOAssets(context.Background(), client, &test.taskPayload, []string{"tdo1", "tdo2"}, test.engineIDs, test.taskIDs)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("discoverTDOAssets() = %v, %v, want an error", assetIDs, baselineAssetIDs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(assetIDs, test.wantAssets) || !reflect.DeepEqual(baselineAssetIDs, test.wantBaselines) {
+				t.Errorf("discoverTDOAssets() = %v, %v, want %v, %v", assetIDs, baselineAssetIDs, test.wantAssets, test.wantBaselines)
+			}
+		})
+	}
+}
+
+func TestWaitForJobs(t *testing.T) {
+	interval := jobPollInterval
+	jobPollInterval = time.Millisecond
+	defer func() { jobPollInterval = interval }()
+
+	polls := make(map[string]int)
+	client, closeServer := testGraphQLServer(t, func(query string, variables map[string]interface{}) interface{} {
+		jobID := variables["jobId"].(string)
+		polls[jobID]++
+		status := "running"
+		switch {
+		case jobID == "missing":
+			return map[string]interface{}{"job": nil}
+		case jobID == "job1" && polls[jobID] >= 2, jobID == "job2" && polls[jobID] >= 3:
+			status = "complete"
+		}
+		return map[string]interface{}{"job": map[string]interface{}{"id": jobID, "targetId": "tdo-" + jobID, "status": status}}
+	})
+	defer closeServer()
+
+	jobs := map[string]*api.Job{"tdo1": {JobID: "job1", Status: "pending"}, "tdo2": {JobID: "job2", Status: "running"}, "tdo3": {JobID: "job3", Status: "failed"}}
+	if err := waitForJobs(context.Background(), client, jobs); err != nil {
+		t.Fatal(err)
+	}
+	if jobs["tdo1"].Status != "complete" || jobs["tdo2"].Status != "complete" {
+		t.Errorf("jobs = %+v, %+v, want both complete", jobs["tdo1"], jobs["tdo2"])
+	}
+	// a done job is not polled again
+	if polls["job1"] != 2 || polls["job2"] != 3 || polls["job3"] != 0 {
+		t.Errorf("polls = %v, want job1 2, job2 3 and job3 0", polls)
+	}
+
+	// a job that can't be found stays pending until the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	jobs = map[string]*api.Job{"tdo4": {JobID: "missing", Status: "running"}}
+	if err := waitForJobs(ctx, client, jobs); errors.Cause(err) != errInterrupted {
+		t.Errorf("waitForJobs() = %v, want %v", err, errInterrupted)
+	}
+	if jobs["tdo4"].JobID != "missing" || jobs["tdo4"].Status != "running" {
+		t.Errorf("job = %+v, want it unchanged", jobs["tdo4"])
+	}
+}
+
+func TestRecordKeys(t *testing.T) {
+	records := []benchmarkRecord{
+		{tdoID: "tdo1", engineID: "engine1", modelID: "model1", assetID: "a9", WordErrorRate: 0.2},
+		{tdoID: "tdo1", engineID: "engine1", modelID: "model1", assetID: "a8", WordErrorRate: 0.1},
+		{tdoID: "tdo1", engineID: "engine1", modelID: "model2", assetID: "a7", WordErrorRate: 0.3},
+		{tdoID: "tdo2", engineID: "engine1", modelID: "model1", assetID: "a6", WordErrorRate: 0.4},
+	}
+	keyed := recordKeys(records)
+	want := map[string]string{
+		"tdo1/engine1/model1":   "a8",
+		"tdo1/engine1/model1#2": "a9",
+		"tdo1/engine1/model2":   "a7",
+		"tdo2/engine1/model1":   "a6",
+	}
+	if len(keyed) != len(want) {
+		t.Fatalf("keys = %v, want %v", keyed, want)
+	}
+	for key, assetID := range want {
+		if keyed[key].assetID != assetID {
+			t.Errorf("record %s = %+v, want asset %s", key, keyed[key], assetID)
+		}
+	}
+}
+
+func TestCompareRunsPairsByTDOEngineAndModel(t *testing.T) {
+	// a rerun writes new output assets on the same TDOs
+	reference := recordKeys([]benchmarkRecord{
+		{tdoID: "tdo1", engineID: "engine1", modelID: "model1", assetID: "a1", WordErrorRate: 0.2},
+		{tdoID: "tdo1", engineID: "engine1", modelID: "model1", assetID: "a2", WordErrorRate: 0.4},
+		{tdoID: "tdo2", engineID: "engine1", modelID: "model1", assetID: "a3", WordErrorRate: 0.3},
+	})
+	compared := recordKeys([]benchmarkRecord{
+		{tdoID: "tdo1", engineID: "engine1", modelID: "model1", assetID: "c1", WordErrorRate: 0.1},
+		{tdoID: "tdo1", engineID: "engine1", modelID: "model1", assetID: "c2", WordErrorRate: 0.5},
+		{tdoID: "tdo3", engineID: "engine1", modelID: "model1", assetID: "c3", WordErrorRate: 0.3},
+	})
+	comparison := compareRuns("t1", "t2", reference, compared)
+	if comparison.Paired != 2 || comparison.OnlyInReference != 1 || comparison.OnlyInCompared != 1 {
+		t.Errorf("paired %d, only in reference %d, only in compared %d, want 2, 1, 1", comparison.Paired, comparison.OnlyInReference, comparison.OnlyInCompared)
+	}
+	if comparison.Improved != 1 || comparison.Regressed != 1 || comparison.Unchanged != 0 {
+		t.Errorf("improved %d, regressed %d, unchanged %d, want 1, 1, 0", comparison.Improved, comparison.Regressed, comparison.Unchanged)
+	}
+	if diff := comparison.MeanReferenceWER - 0.3; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("mean reference WER = %f, want 0.3", comparison.MeanReferenceWER)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"math"
+	"strings"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// oracleBandWidth how far from the best alignment so far the oracle search looks, in reference words.
+// It bounds the search to O(words * band) so multi-hour lattices can be scored.
+const oracleBandWidth = 250
+
+// oracleMetrics how the best path reachable through the alternatives of an output scores against the reference
+type oracleMetrics struct {
+	// WordErrorRate the lowest word error rate of any path through the lattice
+	WordErrorRate float64 `json:"wordErrorRate"`
+	// Gain how much lower it is than the word error rate of the best path
+	Gain           float64 `json:"gain"`
+	Errors         int     `json:"errors"`
+	ReferenceWords int     `json:"referenceWords"`
+}
+
+// newOracleMetrics score the lattice of the asset against the sanitized reference. An asset without alternatives
+// has a single path, its oracle is the best path.
+func newOracleMetrics(reference string, asset *api.Asset, result *results) *oracleMetrics {
+	referenceWords := strings.Fields(reference)
+	metrics := &oracleMetrics{
+		WordErrorRate:  result.WordErrorRate,
+		ReferenceWords: len(referenceWords),
+	}
+	if asset == nil || len(asset.Lattice) == 0 || len(referenceWords) == 0 {
+		metrics.Errors = int(math.Round(result.WordErrorRate * float64(len(referenceWords))))
+		return metrics
+	}
+	metrics.Errors = oracleErrors(referenceWords, asset.Lattice)
+	metrics.WordErrorRate = float64(metrics.Errors) / float64(len(referenceWords))
+	metrics.Gain = result.WordErrorRate - metrics.WordErrorRate
+	return metrics
+}
+
+// latticeEdge an alternative going from one series to the series following its utterance
+type latticeEdge struct {
+	to     int
+	tokens []string
+}
+
+// bandRow the edit distances between a lattice node and the reference prefixes lo to lo+len(costs)-1
+type bandRow struct {
+	lo    int
+	costs []int
+}
+
+func (r *bandRow) hi() int { return r.lo + len(r.costs) - 1 }
+
+// oracleErrors the minimum number of word errors of any path through the lattice against the reference, regardless of case.
+// Nodes are the series boundaries, an alternative is an edge spanning its utterance, and an edit distance row
+// is carried along the edges in series order, banded around its best alignment.
+func oracleErrors(reference []string, lattice []api.LatticeWord) int {
+	reference = lowerTokens(reference)
+	nodes := 0
+	for _, word := range lattice {
+		if end := word.Slot + word.UtteranceLength; end > nodes {
+			nodes = end
+		}
+	}
+	outgoing := make([][]latticeEdge, nodes)
+	for _, word := range lattice {
+		outgoing[word.Slot] = append(outgoing[word.Slot], latticeEdge{
+			to:     word.Slot + word.UtteranceLength,
+			tokens: lowerTokens(strings.Fields(sanitize(word.Word))),
+		})
+	}
+
+	rows := map[int]*bandRow{0: {lo: 0, costs: []int{0}}}
+	for node := 0; node < nodes; node++ {
+		row, ok := rows[node]
+		if !ok {
+			// no path reaches this series
+			continue
+		}
+		delete(rows, node)
+		row = row.rebanded(len(reference), oracleBandWidth)
+
+		edges := outgoing[node]
+		if len(edges) == 0 {
+			// a series without words
+			edges = []latticeEdge{{to: node + 1}}
+		}
+		for _, edge := range edges {
+			next := row
+			for _, token := range edge.tokens {
+				next = next.step(token, reference)
+			}
+			rows[edge.to] = mergeRows(rows[edge.to], next)
+		}
+	}
+
+	final := rows[nodes]
+	if final == nil {
+		return len(reference)
+	}
+	return final.finalCost(len(reference))
+}
+
+// bandedEditDistance the word edit distance between the reference and the hypothesis regardless of case, searched
+// within oracleBandWidth reference words of the best alignment so far
+func bandedEditDistance(reference, hypothesis []string) int {
+	reference = lowerTokens(reference)
+	row := &bandRow{lo: 0, costs: []int{0}}
+	for _, token := range lowerTokens(hypothesis) {
+		row = row.rebanded(len(reference), oracleBandWidth).step(token, reference)
+	}
+	return row.finalCost(len(reference))
+}
+
+// lowerTokens the tokens in lower case, since sclite scores words regardless of their case
+func lowerTokens(tokens []string) []string {
+	lowered := make([]string, len(tokens))
+	for i, token := range tokens {
+		lowered[i] = strings.ToLower(token)
+	}
+	return lowered
+}
+
+// finalCost the cost of the row once the hypothesis is over: the reference words left are deleted
+func (r *bandRow) finalCost(referenceLength int) int {
+	best := math.MaxInt32
+	for i, cost := range r.costs {
+		if total := cost + referenceLength - (r.lo + i); total < best {
+			best = total
+		}
+	}
+	return best
+}
+
+// step the row after the hypothesis token: it is a match, a substitution of the next reference word,
+// or an insertion, and any reference word may be deleted in between
+func (r *bandRow) step(token string, reference []string) *bandRow {
+	hi := r.hi()
+	if hi < len(reference) {
+		hi++
+	}
+	next := &bandRow{lo: r.lo, costs: make([]int, hi-r.lo+1)}
+	for j := r.lo; j <= hi; j++ {
+		cost := math.MaxInt32
+		if j <= r.hi() {
+			cost = r.costs[j-r.lo] + 1
+		}
+		if j > r.lo {
+			substitution := 1
+			if reference[j-1] == token {
+				substitution = 0
+			}
+			cost = minInt(cost, r.costs[j-1-r.lo]+substitution)
+			cost = minInt(cost, next.costs[j-1-r.lo]+1)
+		}
+		next.costs[j-r.lo] = cost
+	}
+	return next
+}
+
+// rebanded the row restricted to width reference words around its best alignment, extended with
+// deletions so the band can follow a hypothesis missing part of the reference
+func (r *bandRow) rebanded(referenceLength, width int) *bandRow {
+	best := r.lo
+	for i, cost := range r.costs {
+		if cost < r.costs[best-r.lo] {
+			best = r.lo + i
+		}
+	}
+	lo := maxInt(r.lo, best-width)
+	hi := minInt(referenceLength, best+width)
+	banded := &bandRow{lo: lo, costs: make([]int, hi-lo+1)}
+	for j := lo; j <= hi; j++ {
+		if j <= r.hi() {
+			banded.costs[j-lo] = r.costs[j-r.lo]
+		} else {
+			banded.costs[j-lo] = math.MaxInt32
+		}
+		if j > lo {
+			banded.costs[j-lo] = minInt(banded.costs[j-lo], banded.costs[j-1-lo]+1)
+		}
+	}
+	return banded
+}
+
+// mergeRows the best cost of both rows for every reference prefix
+func mergeRows(a, b *bandRow) *bandRow {
+	if a == nil {
+		return b
+	}
+	lo, hi := minInt(a.lo, b.lo), maxInt(a.hi(), b.hi())
+	merged := &bandRow{lo: lo, costs: make([]int, hi-lo+1)}
+	for j := lo; j <= hi; j++ {
+		cost := math.MaxInt32
+		if j >= a.lo && j <= a.hi() {
+			cost = a.costs[j-a.lo]
+		}
+		if j >= b.lo && j <= b.hi() {
+			cost = minInt(cost, b.costs[j-b.lo])
+		}
+		merged.costs[j-lo] = cost
+	}
+	return merged
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
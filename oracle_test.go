@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// editDistance the unbanded word edit distance, to check the banded one against
+func editDistance(reference, hypothesis []string) int {
+	row := make([]int, len(reference)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(hypothesis); i++ {
+		previous := row[0]
+		row[0] = i
+		for j := 1; j <= len(reference); j++ {
+			substitution := previous
+			if reference[j-1] != hypothesis[i-1] {
+				substitution++
+			}
+			previous = row[j]
+			row[j] = minInt(minInt(row[j]+1, row[j-1]+1), substitution)
+		}
+	}
+	return row[len(reference)]
+}
+
+func TestBandedEditDistance(t *testing.T) {
+	tests := []struct {
+		name                  string
+		reference, hypothesis string
+		want                  int
+	}{
+		{"identical", "a b c d", "a b c d", 0},
+		{"substitution", "a b c d", "a x c d", 1},
+		{"insertion", "a b c d", "a b x c d", 1},
+		{"deletion", "a b c d", "a c d", 1},
+		{"empty hypothesis", "a b c", "", 3},
+		{"empty reference", "", "a b", 2},
+		{"case is ignored", "The cat", "the CAT", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := bandedEditDistance(strings.Fields(test.reference), strings.Fields(test.hypothesis)); got != test.want {
+				t.Errorf("bandedEditDistance() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBandedEditDistanceMatchesUnbanded(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	vocabulary := []string{"a", "b", "c", "d", "e"}
+	words := func(n int) []string {
+		out := make([]string, n)
+		for i := range out {
+			out[i] = vocabulary[random.Intn(len(vocabulary))]
+		}
+		return out
+	}
+	// within the band, the banded search is exact
+	for i := 0; i < 200; i++ {
+		reference, hypothesis := words(random.Intn(60)), words(random.Intn(60))
+		if got, want := bandedEditDistance(reference, hypothesis), editDistance(reference, hypothesis); got != want {
+			t.Fatalf("bandedEditDistance(%v, %v) = %d, want %d", reference, hypothesis, got, want)
+		}
+	}
+}
+
+// testLattice a lattice with a series per slot, each alternative a word of the slot spanning utteranceLength series
+func testLattice(slots ...[]api.LatticeWord) []api.LatticeWord {
+	var lattice []api.LatticeWord
+	for slot, words := range slots {
+		for _, word := range words {
+			word.Slot = slot
+			if word.UtteranceLength == 0 {
+				word.UtteranceLength = 1
+			}
+			lattice = append(lattice, word)
+		}
+	}
+	return lattice
+}
+
+func TestOracleErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		reference string
+		lattice   []api.LatticeWord
+		want      int
+	}{
+		{
+			name:      "single path",
+			reference: "the cat sat",
+			lattice:   testLattice([]api.LatticeWord{{Word: "the"}}, []api.LatticeWord{{Word: "hat"}}, []api.LatticeWord{{Word: "sat"}}),
+			want:      1,
+		},
+		{
+			name:      "an alternative fixes the best path",
+			reference: "the cat sat",
+			lattice:   testLattice([]api.LatticeWord{{Word: "the"}}, []api.LatticeWord{{Word: "hat", BestPath: true}, {Word: "cat"}}, []api.LatticeWord{{Word: "sat"}}),
+			want:      0,
+		},
+		{
+			name:      "a multi-word alternative spans its utterance",
+			reference: "in new york today",
+			lattice: testLattice(
+				[]api.LatticeWord{{Word: "in"}},
+				[]api.LatticeWord{{Word: "new york", UtteranceLength: 2}, {Word: "knew"}},
+				[]api.LatticeWord{{Word: "yolk"}},
+				[]api.LatticeWord{{Word: "today"}},
+			),
+			want: 0,
+		},
+		{
+			name:      "case is ignored",
+			reference: "the cat",
+			lattice:   testLattice([]api.LatticeWord{{Word: "The"}}, []api.LatticeWord{{Word: "cat"}}),
+			want:      0,
+		},
+		{
+			name:      "a series without words",
+			reference: "a b",
+			lattice:   []api.LatticeWord{{Word: "a", Slot: 0, UtteranceLength: 1}, {Word: "b", Slot: 2, UtteranceLength: 1}},
+			want:      0,
+		},
+		{
+			name:      "a series only reached inside an utterance",
+			reference: "a b c",
+			lattice:   []api.LatticeWord{{Word: "a b", Slot: 0, UtteranceLength: 2}, {Word: "x", Slot: 1, UtteranceLength: 1}, {Word: "c", Slot: 2, UtteranceLength: 1}},
+			want:      0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := oracleErrors(strings.Fields(test.reference), test.lattice); got != test.want {
+				t.Errorf("oracleErrors() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestOracleErrorsOfLongLattice(t *testing.T) {
+	// far longer than the band, with an alternative fixing every tenth word
+	var reference []string
+	var slots [][]api.LatticeWord
+	for i := 0; i < 5000; i++ {
+		token := fmt.Sprintf("w%d", i)
+		reference = append(reference, token)
+		if i%10 == 0 {
+			slots = append(slots, []api.LatticeWord{{Word: "wrong", BestPath: true}, {Word: token}})
+		} else {
+			slots = append(slots, []api.LatticeWord{{Word: token}})
+		}
+	}
+	if got := oracleErrors(reference, testLattice(slots...)); got != 0 {
+		t.Errorf("oracleErrors() = %d, want 0", got)
+	}
+}
+
+func TestNewOracleMetrics(t *testing.T) {
+	result := &results{WordErrorRate: 1.0 / 3}
+	asset := &api.Asset{Lattice: testLattice([]api.LatticeWord{{Word: "the"}}, []api.LatticeWord{{Word: "hat", BestPath: true}, {Word: "cat"}}, []api.LatticeWord{{Word: "sat"}})}
+	tests := []struct {
+		name          string
+		asset         *api.Asset
+		errors        int
+		wordErrorRate float64
+		gain          float64
+	}{
+		{"with alternatives", asset, 0, 0, 1.0 / 3},
+		// without alternatives, the oracle is the best path
+		{"without a lattice", &api.Asset{}, 1, 1.0 / 3, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metrics := newOracleMetrics("the cat sat", test.asset, result)
+			if metrics.Errors != test.errors || metrics.WordErrorRate != test.wordErrorRate || metrics.Gain != test.gain || metrics.ReferenceWords != 3 {
+				t.Errorf("newOracleMetrics() = %+v, want %d errors, word error rate %f and gain %f", metrics, test.errors, test.wordErrorRate, test.gain)
+			}
+		})
+	}
+}
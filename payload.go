@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+const (
+	// payloadSchemaVersion the version of the payload schema, bump it with any change to the schema
+	payloadSchemaVersion = 4
+	// defaultMaxTTL the processing time estimate answered when the task has no maxTTL, in seconds
+	defaultMaxTTL = 3600
+)
+
+// payloadSchema the JSON Schema of the task payload. The platform adds its own keys to the payload, so only
+// `taskPayload` rejects the keys it does not know.
+const payloadSchema = `{
+    "$schema": "http://json-schema.org/draft-07/schema#",
+    "$id": "translation-benchmark/payload/v4",
+    "title": "translation-benchmark task payload",
+    "type": "object",
+    "required": ["taskPayload"],
+    "properties": {
+        "mode": {"type": "string", "enum": ["", "assets", "tdos", "job", "training", "compare-tasks"]},
+        "jobId": {"type": "string"},
+        "taskId": {"type": "string"},
+        "recordingId": {"type": "string"},
+        "organizationId": {"type": "string"},
+        "token": {"type": "string"},
+        "veritoneApiBaseUrl": {"type": "string"},
+        "debug": {"type": "boolean"},
+        "test": {"type": "boolean"},
+        "taskPayload": {
+            "type": "object",
+            "additionalProperties": false,
+            "properties": {
+                "organizationId": {"type": "integer"},
+                "mode": {"type": "string", "enum": ["", "assets", "tdos", "job", "training", "compare-tasks"]},
+                "sdoId": {"type": "string"},
+                "schemaId": {"type": "string"},
+                "baselineAssetIds": {"type": "array", "items": {"type": "string", "minLength": 1}, "uniqueItems": true},
+                "assetIds": {"type": "array", "items": {"type": "string", "minLength": 1}, "uniqueItems": true},
+                "dataRegistryId": {"type": "string"},
+                "categoryId": {"type": "string", "enum": [
+                    "",
+                    "3b2b2ff8-44aa-4db4-9b71-ff96c3bf5923",
+                    "67cd4dd0-2f75-445d-a6f0-2f297d6cd182",
+                    "6faad6b7-0837-45f9-b161-2f6bf31b7a07"
+                ]},
+                "minPrecision": {"type": "number", "minimum": 0, "maximum": 100},
+                "oracle": {"type": "boolean"},
+                "targetLanguage": {"type": "string"},
+                "glossary": {"type": "array", "items": {
+                    "type": "object",
+                    "additionalProperties": false,
+                    "required": ["target"],
+                    "properties": {
+                        "source": {"type": "string"},
+                        "target": {"type": "string", "minLength": 1},
+                        "caseSensitive": {"type": "boolean"},
+                        "inflections": {"type": "array", "items": {"type": "string", "minLength": 1}},
+                        "matchStem": {"type": "boolean"}
+                    }
+                }},
+                "glossaryAssetId": {"type": "string"},
+                "subtitles": {
+                    "type": ["object", "null"],
+                    "additionalProperties": false,
+                    "properties": {
+                        "maxCharsPerSecond": {"type": "number", "minimum": 0},
+                        "maxLineLength": {"type": "integer", "minimum": 0},
+                        "maxLines": {"type": "integer", "minimum": 0},
+                        "minDurationMs": {"type": "integer", "minimum": 0},
+                        "maxDurationMs": {"type": "integer", "minimum": 0}
+                    }
+                },
+                "timingTolerancesMs": {"type": "array", "items": {"type": "integer", "minimum": 1}, "uniqueItems": true},
+                "tdoIds": {"type": "array", "items": {"type": "string", "minLength": 1}, "uniqueItems": true},
+                "engineIds": {"type": "array", "items": {"type": "string", "minLength": 1}, "uniqueItems": true},
+                "baselineEngineId": {"type": "string"},
+                "engines": {"type": "array", "items": {
+                    "type": "object",
+                    "additionalProperties": false,
+                    "required": ["engineId"],
+                    "properties": {
+                        "engineId": {"type": "string", "minLength": 1},
+                        "modelId": {"type": "string"}
+                    }
+                }},
+                "candidateModelId": {"type": "string"},
+                "taskIds": {"type": "array", "items": {"type": "string", "minLength": 1}, "uniqueItems": true},
+                "duplicateAssets": {
+                    "type": ["object", "null"],
+                    "additionalProperties": false,
+                    "properties": {
+                        "policy": {"type": "string", "enum": ["", "all", "latest", "highestVersion", "model"]},
+                        "modelId": {"type": "string"}
+                    }
+                },
+                "promotion": {
+                    "type": ["object", "null"],
+                    "additionalProperties": false,
+                    "properties": {
+                        "championModelId": {"type": "string"},
+                        "minBleuGain": {"type": "number", "minimum": 0, "maximum": 100},
+                        "maxPValue": {"type": "number", "minimum": 0, "maximum": 1},
+                        "maxWerRegression": {"type": "number", "minimum": 0},
+                        "bootstrapSamples": {"type": "integer", "minimum": 1, "maximum": 100000}
+                    }
+                }
+            }
+        }
+    }
+}`
+
+// jsonSchema the subset of JSON Schema the payload schema uses
+type jsonSchema struct {
+	Type                 jsonTypes              `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	Items                *jsonSchema            `json:"items"`
+	UniqueItems          bool                   `json:"uniqueItems"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+}
+
+// jsonTypes the types a value may have, a schema type is a single type or a list of them
+type jsonTypes []string
+
+func (t *jsonTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = jsonTypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// compiledPayloadSchema the payload schema, parsed once
+var compiledPayloadSchema = func() *jsonSchema {
+	schema := &jsonSchema{}
+	if err := json.Unmarshal([]byte(payloadSchema), schema); err != nil {
+		panic("invalid payload schema: " + err.Error())
+	}
+	return schema
+}()
+
+// payloadError lists every problem found in the task payload
+type payloadError struct {
+	problems []string
+}
+
+func (e *payloadError) Error() string {
+	return fmt.Sprintf("Invalid payload (schema v%d): %s", payloadSchemaVersion, strings.Join(e.problems, "; "))
+}
+
+func (e *payloadError) add(format string, args ...interface{}) {
+	e.problems = append(e.problems, fmt.Sprintf(format, args...))
+}
+
+// orNil returns the error when at least one problem was found
+func (e *payloadError) orNil() error {
+	if len(e.problems) == 0 {
+		return nil
+	}
+	return e
+}
+
+// validatePayload check the payload against the payload schema, the rules across its fields and the fields its mode needs,
+// and report every problem found
+func validatePayload(payload []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return errors.Wrap(err, "the payload is not valid JSON")
+	}
+	problems := &payloadError{}
+	compiledPayloadSchema.validate("payload", value, problems)
+	if object, ok := value.(map[string]interface{}); ok {
+		if taskPayload, ok := object["taskPayload"].(map[string]interface{}); ok {
+			checkAssetLists(taskPayload, problems)
+		}
+	}
+	// the fields each mode needs, once the payload fits its types
+	var enginePayload BenchmarkEnginePayload
+	if err := json.Unmarshal(payload, &enginePayload); err == nil {
+		validateMode(&enginePayload, problems)
+		if rules := enginePayload.TaskPayload.DuplicateAssets; rules != nil && rules.Policy == duplicatePolicyModel && rules.ModelID == "" {
+			problems.add("payload.taskPayload.duplicateAssets.modelId is required by the %s policy", duplicatePolicyModel)
+		}
+	}
+	return problems.orNil()
+}
+
+// checkAssetLists an asset cannot be benchmarked against itself, so no ID can be both an asset and a baseline
+func checkAssetLists(taskPayload map[string]interface{}, problems *payloadError) {
+	baselines := make(map[string]int)
+	if list, ok := taskPayload["baselineAssetIds"].([]interface{}); ok {
+		for i, item := range list {
+			if id, ok := item.(string); ok {
+				baselines[id] = i
+			}
+		}
+	}
+	if list, ok := taskPayload["assetIds"].([]interface{}); ok {
+		for i, item := range list {
+			id, ok := item.(string)
+			if !ok {
+				continue
+			}
+			if j, found := baselines[id]; found {
+				problems.add("payload.taskPayload.assetIds[%d] %q is also payload.taskPayload.baselineAssetIds[%d]", i, id, j)
+			}
+		}
+	}
+}
+
+// validate check the value at the path against the schema
+func (s *jsonSchema) validate(path string, value interface{}, problems *payloadError) {
+	if len(s.Type) > 0 && !s.Type.matches(value) {
+		problems.add("%s must be %s, got %s", path, strings.Join(s.Type, " or "), jsonTypeOf(value))
+		return
+	}
+	if len(s.Enum) > 0 && !s.inEnum(value) {
+		allowed := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			allowed[i] = fmt.Sprintf("%q", fmt.Sprint(e))
+		}
+		problems.add("%s must be one of %s, got %q", path, strings.Join(allowed, ", "), value)
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		number, _ := v.Float64()
+		if s.Minimum != nil && number < *s.Minimum {
+			problems.add("%s must be at least %v, got %s", path, *s.Minimum, v)
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			problems.add("%s must be at most %v, got %s", path, *s.Maximum, v)
+		}
+	case string:
+		if s.MinLength != nil && utf8.RuneCountInString(v) < *s.MinLength {
+			problems.add("%s must have at least %d characters", path, *s.MinLength)
+		}
+	case []interface{}:
+		seen := make(map[string]int)
+		for i, item := range v {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			if s.Items != nil {
+				s.Items.validate(itemPath, item, problems)
+			}
+			if !s.UniqueItems {
+				continue
+			}
+			key := fmt.Sprintf("%T:%v", item, item)
+			if j, found := seen[key]; found {
+				problems.add("%s duplicates %s[%d] (%v)", itemPath, path, j, item)
+				continue
+			}
+			seen[key] = i
+		}
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, found := v[key]; !found {
+				problems.add("%s.%s is required", path, key)
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if property, found := s.Properties[key]; found {
+				property.validate(path+"."+key, v[key], problems)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				problems.add("%s.%s is not a known field", path, key)
+			}
+		}
+	}
+}
+
+func (s *jsonSchema) inEnum(value interface{}) bool {
+	for _, e := range s.Enum {
+		if fmt.Sprint(e) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches whether the decoded JSON value has one of the types
+func (t jsonTypes) matches(value interface{}) bool {
+	actual := jsonTypeOf(value)
+	for _, want := range t {
+		if want == actual || (want == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonTypeOf the JSON Schema type of a value decoded with UseNumber, "integer" for the numbers without a fraction
+func jsonTypeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// validateCommand the `validate` CLI command
+func validateCommand() cli.Command {
+	return cli.Command{
+		Name:      "validate",
+		Usage:     "Check a task payload against the payload schema, reading the file argument or stdin",
+		ArgsUsage: "[payload.json]",
+		Flags: []cli.Flag{
+			cli.BoolFlag{Name: "schema", Usage: "Print the payload schema instead"},
+		},
+		Action: func(c *cli.Context) error {
+			if c.Bool("schema") {
+				fmt.Println(payloadSchema)
+				return nil
+			}
+			var payload []byte
+			var err error
+			if file := c.Args().First(); file != "" && file != "-" {
+				payload, err = ioutil.ReadFile(file)
+			} else {
+				payload, err = ioutil.ReadAll(os.Stdin)
+			}
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+
+			err = validatePayload(payload)
+			if problems, ok := err.(*payloadError); ok {
+				for _, problem := range problems.problems {
+					fmt.Println(problem)
+				}
+				return cli.NewExitError(fmt.Sprintf("%d problems found", len(problems.problems)), 1)
+			} else if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			fmt.Printf("The payload is valid (schema v%d)\n", payloadSchemaVersion)
+			return nil
+		},
+	}
+}
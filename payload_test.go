@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// decodeJSON decode the JSON the way validatePayload does, keeping the numbers as json.Number
+func decodeJSON(text string, v interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func TestValidatePayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		// problems the problems the error must list, none for a valid payload
+		problems []string
+	}{
+		{"assets", `{"taskPayload":{"assetIds":["a1"],"baselineAssetIds":["b1"]}}`, nil},
+		{"platform keys", `{"applicationId":"x","taskPayload":{"assetIds":["a1"],"baselineAssetIds":["b1"]}}`, nil},
+		{"null objects", `{"taskPayload":{"assetIds":["a1"],"baselineAssetIds":["b1"],"subtitles":null,"promotion":null}}`, nil},
+		{"numbers with a fraction", `{"taskPayload":{"assetIds":["a1"],"baselineAssetIds":["b1"],"minPrecision":12.5,"promotion":{"maxPValue":0.05}}}`, nil},
+		{"missing task payload", `{}`, []string{"payload.taskPayload is required"}},
+		{"unknown field", `{"taskPayload":{"assetIds":["a1"],"baselineAssetIds":["b1"],"assetId":"a1"}}`, []string{"payload.taskPayload.assetId is not a known field"}},
+		{"wrong type", `{"taskPayload":{"assetIds":"a1","baselineAssetIds":["b1"]}}`, []string{"payload.taskPayload.assetIds must be array, got string"}},
+		{"integer", `{"taskPayload":{"assetIds":["a1"],"baselineAssetIds":["b1"],"subtitles":{"maxLines":1.5}}}`, []string{"payload.taskPayload.subtitles.maxLines must be integer, got number"}},
+		{"enum", `{"mode":"everything","taskPayload":{}}`, []string{`payload.mode must be one of`, `got "everything"`}},
+		{"empty item", `{"taskPayload":{"assetIds":[""],"baselineAssetIds":["b1"]}}`, []string{"payload.taskPayload.assetIds[0] must have at least 1 characters"}},
+		{"duplicate items", `{"taskPayload":{"assetIds":["a1","a1"],"baselineAssetIds":["b1"]}}`, []string{"payload.taskPayload.assetIds[1] duplicates payload.taskPayload.assetIds[0] (a1)"}},
+		{"asset and baseline", `{"taskPayload":{"assetIds":["a1","b1"],"baselineAssetIds":["b1"]}}`, []string{`payload.taskPayload.assetIds[1] "b1" is also payload.taskPayload.baselineAssetIds[0]`}},
+		{"above the maximum", `{"taskPayload":{"assetIds":["a1"],"baselineAssetIds":["b1"],"minPrecision":101}}`, []string{"payload.taskPayload.minPrecision must be at most 100, got 101"}},
+		{"no bootstrap sample", `{"taskPayload":{"assetIds":["a1"],"baselineAssetIds":["b1"],"promotion":{"bootstrapSamples":0}}}`, []string{"payload.taskPayload.promotion.bootstrapSamples must be at least 1, got 0"}},
+		{"model policy without a model", `{"taskPayload":{"assetIds":["a1"],"baselineAssetIds":["b1"],"duplicateAssets":{"policy":"model"}}}`, []string{"payload.taskPayload.duplicateAssets.modelId is required by the model policy"}},
+		{"fields of the mode", `{"mode":"job","taskPayload":{"tdoIds":["t1"]}}`, []string{"payload.taskPayload.engines needs at least one engine in the job mode", "payload.taskPayload.baselineEngineId or payload.taskPayload.baselineAssetIds is required in the job mode"}},
+		{"modes disagree", `{"mode":"job","taskPayload":{"mode":"tdos"}}`, []string{`payload.mode "job" and payload.taskPayload.mode "tdos" disagree`}},
+		{"every problem", `{"taskPayload":{"assetIds":["a1","a1"],"baselineAssetIds":"b1","oracle":"yes"}}`, []string{"assetIds[1] duplicates", "baselineAssetIds must be array", "oracle must be boolean"}},
+		{"not JSON", `{"taskPayload":`, []string{"the payload is not valid JSON"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validatePayload([]byte(test.payload))
+			if len(test.problems) == 0 {
+				if err != nil {
+					t.Errorf("validatePayload() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("validatePayload() = nil, want %v", test.problems)
+			}
+			for _, problem := range test.problems {
+				if !strings.Contains(err.Error(), problem) {
+					t.Errorf("validatePayload() = %v, want %q", err, problem)
+				}
+			}
+		})
+	}
+}
+
+func TestJSONTypesMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		want   bool
+	}{
+		{"single type", `{"type":"string"}`, `"a"`, true},
+		{"list of types", `{"type":["object","null"]}`, `null`, true},
+		{"an integer is a number", `{"type":"number"}`, `3`, true},
+		{"a number is not an integer", `{"type":"integer"}`, `3.5`, false},
+		{"other type", `{"type":"boolean"}`, `"true"`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var schema jsonSchema
+			if err := decodeJSON(test.schema, &schema); err != nil {
+				t.Fatal(err)
+			}
+			var value interface{}
+			if err := decodeJSON(test.value, &value); err != nil {
+				t.Fatal(err)
+			}
+			if got := schema.Type.matches(value); got != test.want {
+				t.Errorf("matches(%s) = %v, want %v", test.value, got, test.want)
+			}
+		})
+	}
+}
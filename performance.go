@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// performanceMetrics how long the task that produced the output waited and ran, against the duration of the media
+type performanceMetrics struct {
+	TaskID string `json:"taskId"`
+	// QueueWaitMs from the task being queued, or created when it has no queued time, to its start
+	QueueWaitMs int64 `json:"queueWaitMs"`
+	// ProcessingTimeMs from the task start to its completion
+	ProcessingTimeMs int64 `json:"processingTimeMs"`
+	// MediaDurationMs the duration of the TDO, or the end of the last baseline segment without one
+	MediaDurationMs int64 `json:"mediaDurationMs,omitempty"`
+	// RealTimeFactor the processing time over the media duration, 0 when the duration is unknown
+	RealTimeFactor float64 `json:"realTimeFactor,omitempty"`
+}
+
+// enginePerformance the speed and word error rate of the outputs of an engine version in the task
+type enginePerformance struct {
+	engineName       string
+	deployedVersion  int64
+	processingTimeMs []float64
+	queueWaitMs      []float64
+	realTimeFactors  []float64
+	wordErrorRates   []float64
+}
+
+// fetchPerformance time the tasks that produced the assets of the TDO, keyed by asset ID. The assets without a task,
+// or whose task has not started and completed, are left out.
+func fetchPerformance(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, TDOID string, tdoAssets *TDOAssets) map[string]*performanceMetrics {
+	var taskIDs []string
+	seen := make(map[string]bool)
+	for _, asset := range tdoAssets.assets {
+		if taskID := asset.SourceData.TaskID; taskID != "" && !seen[taskID] {
+			seen[taskID] = true
+			taskIDs = append(taskIDs, taskID)
+		}
+	}
+	if len(taskIDs) == 0 {
+		return nil
+	}
+	tdo, tasks, err := graphQLClient.FetchTaskTimes(ctx, TDOID, taskIDs)
+	if err != nil {
+		logFrom(ctx).Warnf("Failed to fetch the times of %d tasks, got %d of them: %s", len(taskIDs), len(tasks), err)
+	}
+
+	mediaDurationMs := int64(0)
+	if tdo != nil {
+		mediaDurationMs = durationMs(tdo.StartDateTime, tdo.StopDateTime)
+	}
+	if baseline := tdoAssets.baselineAsset; mediaDurationMs <= 0 && baseline != nil && len(baseline.Segments) > 0 {
+		mediaDurationMs = int64(baseline.Segments[len(baseline.Segments)-1].StopTimeMs)
+	}
+
+	performance := make(map[string]*performanceMetrics)
+	for _, asset := range tdoAssets.assets {
+		task, ok := tasks[asset.SourceData.TaskID]
+		if !ok {
+			continue
+		}
+		processingTimeMs := durationMs(task.StartedDateTime, task.CompletedDateTime)
+		if processingTimeMs < 0 {
+			logFrom(ctx).with("assetId", asset.ID).Debugf("The task %s of asset(%s) has no start or completion time", task.TaskID, asset.ID)
+			continue
+		}
+		queuedDateTime := task.QueuedDateTime
+		if queuedDateTime == "" {
+			queuedDateTime = task.CreatedDateTime
+		}
+		metrics := &performanceMetrics{
+			TaskID:           task.TaskID,
+			QueueWaitMs:      maxInt64(durationMs(queuedDateTime, task.StartedDateTime), 0),
+			ProcessingTimeMs: processingTimeMs,
+		}
+		if mediaDurationMs > 0 {
+			metrics.MediaDurationMs = mediaDurationMs
+			metrics.RealTimeFactor = float64(processingTimeMs) / float64(mediaDurationMs)
+		}
+		performance[asset.ID] = metrics
+	}
+	return performance
+}
+
+// durationMs the milliseconds from start to stop, -1 when either is missing or unreadable
+func durationMs(start, stop string) int64 {
+	startTime, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return -1
+	}
+	stopTime, err := time.Parse(time.RFC3339, stop)
+	if err != nil || stopTime.Before(startTime) {
+		return -1
+	}
+	return int64(stopTime.Sub(startTime) / time.Millisecond)
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// addPerformance add the timing and word error rate of an output to the performance of its engine version
+func (s *benchmarkSummary) addPerformance(engineID, engineName string, deployedVersion int64, metrics *performanceMetrics, wordErrorRate float64) {
+	key := fmt.Sprintf("%s/%d", engineID, deployedVersion)
+	performance, ok := s.Performance[key]
+	if !ok {
+		performance = &enginePerformance{engineName: engineName, deployedVersion: deployedVersion}
+		s.Performance[key] = performance
+	}
+	performance.processingTimeMs = append(performance.processingTimeMs, float64(metrics.ProcessingTimeMs))
+	performance.queueWaitMs = append(performance.queueWaitMs, float64(metrics.QueueWaitMs))
+	if metrics.RealTimeFactor > 0 {
+		performance.realTimeFactors = append(performance.realTimeFactors, metrics.RealTimeFactor)
+	}
+	performance.wordErrorRates = append(performance.wordErrorRates, wordErrorRate)
+}
+
+// performanceSummary the median speed and mean word error rate of each engine version across the task, for the info message
+func performanceSummary(byVersion map[string]*enginePerformance) string {
+	keys := make([]string, 0, len(byVersion))
+	for key := range byVersion {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		performance := byVersion[key]
+		name := performance.engineName
+		if name == "" {
+			name = strings.SplitN(key, "/", 2)[0]
+		}
+		part := fmt.Sprintf("%s v%d median processing %.1f s, queue wait %.1f s", name, performance.deployedVersion,
+			median(performance.processingTimeMs)/1000, median(performance.queueWaitMs)/1000)
+		if len(performance.realTimeFactors) > 0 {
+			part += fmt.Sprintf(", real-time factor %.2f", median(performance.realTimeFactors))
+		}
+		var wordErrorRate float64
+		for _, rate := range performance.wordErrorRates {
+			wordErrorRate += rate
+		}
+		part += fmt.Sprintf(", mean WER %.1f%%", wordErrorRate/float64(len(performance.wordErrorRates))*100)
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// median the median of the values, 0 without values
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return percentile(sorted, 50)
+}
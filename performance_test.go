@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+func TestDurationMs(t *testing.T) {
+	tests := []struct {
+		name, start, stop string
+		want              int64
+	}{
+		{"one minute", "2020-01-01T00:00:00Z", "2020-01-01T00:01:00Z", 60000},
+		{"missing start", "", "2020-01-01T00:01:00Z", -1},
+		{"stop before start", "2020-01-01T00:01:00Z", "2020-01-01T00:00:00Z", -1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := durationMs(test.start, test.stop); got != test.want {
+				t.Errorf("durationMs() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFetchPerformanceWithoutBaseline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// the TDO has no times, so the media duration would come from the baseline segments
+		w.Write([]byte(`{"data":{"temporalDataObject":{"id":"tdo1"},"t0":{"id":"task1","status":"complete","createdDateTime":"2020-01-01T00:00:00Z","startedDateTime":"2020-01-01T00:00:10Z","completedDateTime":"2020-01-01T00:01:10Z"}}}`))
+	}))
+	defer server.Close()
+	client, err := api.NewCoreAPI(api.Options{VeritoneAPIBaseURL: server.URL, GraphQLEndpoint: "/", Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tdoAssets := &TDOAssets{assets: []*api.Asset{{ID: "a1", SourceData: api.SourceData{TaskID: "task1"}}}}
+	performance := fetchPerformance(context.Background(), client, "tdo1", tdoAssets)
+	metrics := performance["a1"]
+	if metrics == nil {
+		t.Fatal("the asset was not timed")
+	}
+	if metrics.ProcessingTimeMs != 60000 || metrics.QueueWaitMs != 10000 {
+		t.Errorf("processing %d ms, queue wait %d ms, want 60000 and 10000", metrics.ProcessingTimeMs, metrics.QueueWaitMs)
+	}
+	if metrics.MediaDurationMs != 0 || metrics.RealTimeFactor != 0 {
+		t.Errorf("media duration %d ms, real-time factor %f, want neither without a TDO duration or a baseline", metrics.MediaDurationMs, metrics.RealTimeFactor)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// newAssetBenchmarkSDO build the benchmark SDO of an engine output scored against its baseline
+func newAssetBenchmarkSDO(enginePayload *BenchmarkEnginePayload, TDOID, baselineAssetID, engineID string, engineOutput EngineOutput, result *results) AssetBenchmarkSDODataForTranscription {
+	newSDO := AssetBenchmarkSDODataForTranscription{
+		BenchmarkJobID:  enginePayload.JobID,
+		BenchmarkTaskID: enginePayload.TaskID,
+		TDOID:           TDOID,
+		AssetID:         engineOutput.AssetID,
+		ModelID:         engineOutput.ModelID,
+		EngineID:        engineID,
+		OrganizationID:  enginePayload.OrganizationID,
+		BaselineAssetID: baselineAssetID,
+		EngineName:      engineOutput.EngineName,
+		DeployedVersion: engineOutput.DeployedVersion,
+		// Metrics
+		Accuracy:      result.Accuracy,
+		Precision:     result.Precision,
+		Recall:        result.Recall,
+		WordErrorRate: result.WordErrorRate,
+	}
+
+	// If a training SDO was passed, include the reference
+	if enginePayload.TaskPayload.TrainingWorkflowSDOID != "" && enginePayload.TaskPayload.TrainingWorkflowSDOSchemaID != "" {
+		newSDO.TrainingSDO = &SDOReference{
+			ID:       enginePayload.TaskPayload.TrainingWorkflowSDOID,
+			SchemaID: enginePayload.TaskPayload.TrainingWorkflowSDOSchemaID,
+		}
+	}
+	return newSDO
+}
+
+// persistBenchmarkSDOs create the benchmark SDOs, record them in the checkpoint and return the asset IDs that could not be written.
+// It does not use the shutdown context so that results computed before a shutdown are still flushed.
+func persistBenchmarkSDOs(parentCtx context.Context, graphQLClient *api.PlatformGraphQLClient, enginePayload *BenchmarkEnginePayload, benchmarkSchemaID string, sdos []AssetBenchmarkSDODataForTranscription, cp *checkpoint) (failedAssets []string) {
+	ctx, cancel := context.WithTimeout(detachedContext(parentCtx), persistTimeout)
+	defer cancel()
+
+	for _, newSDO := range sdos {
+		logger := logFrom(ctx).with("assetId", newSDO.AssetID)
+		if enginePayload.Test {
+			logger.Infof("This is a test, but the SDO would have been created...SDO: %+v", newSDO)
+			continue
+		}
+		sdo, err := graphQLClient.CreateSDO(ctx, benchmarkSchemaID, newSDO)
+		if err != nil {
+			failedAssets = append(failedAssets, newSDO.AssetID)
+			assetFailuresTotal.WithLabelValues(categoryLabel(enginePayload.TaskPayload.CategoryID), "persist_failed").Inc()
+			logger.Errorf("Error creating the benchmark SDO for asset(%s) due to: %s", newSDO.AssetID, err)
+			continue
+		}
+		logger.Infof("Benchmark SDO for asset(%s) successfully created with ID: %s", newSDO.AssetID, sdo.ID)
+
+		scores := scoresOf(newSDO)
+		err = cp.markDone(checkpointEntry{TDOID: newSDO.TDOID, AssetID: newSDO.AssetID, BaselineAssetID: newSDO.BaselineAssetID, SDOID: sdo.ID, Scores: &scores})
+		if err != nil {
+			logger.Warnf("Failed to checkpoint asset(%s) due to: %s", newSDO.AssetID, err)
+		}
+	}
+	return failedAssets
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// bootstrapSeed the seed of the paired bootstrap, fixed so that a task always reaches the same decision
+const bootstrapSeed = 1
+
+// the decisions on a challenger model
+const (
+	decisionPromote = "promote"
+	decisionHold    = "hold"
+	decisionReject  = "reject"
+)
+
+// promotionRules when a challenger model replaces the champion model of its engine. The thresholds left out take
+// the defaults, an explicit 0 is kept.
+type promotionRules struct {
+	// ChampionModelID the model in production. Without it, the champion of the candidate of the training mode is the
+	// best other model of its engine, and the other tasks only rank the models.
+	ChampionModelID string `json:"championModelId"`
+	// MinBleuGain how many BLEU points the challenger must gain over the champion, 0.5 by default
+	MinBleuGain *float64 `json:"minBleuGain"`
+	// MaxPValue the significance level of the paired bootstrap, 0.05 by default
+	MaxPValue *float64 `json:"maxPValue"`
+	// MaxWerRegression how much the mean word error rate of the challenger may exceed the champion's, 0.01 (1 point) by default
+	MaxWerRegression *float64 `json:"maxWerRegression"`
+	// BootstrapSamples the resamplings of the paired bootstrap, 1000 by default
+	BootstrapSamples *int `json:"bootstrapSamples"`
+}
+
+// withDefaults the rules with the defaults for the thresholds that are not set, all of them are then set
+func (r promotionRules) withDefaults() promotionRules {
+	if r.MinBleuGain == nil {
+		r.MinBleuGain = float64Value(0.5)
+	}
+	if r.MaxPValue == nil {
+		r.MaxPValue = float64Value(0.05)
+	}
+	if r.MaxWerRegression == nil {
+		r.MaxWerRegression = float64Value(0.01)
+	}
+	if r.BootstrapSamples == nil {
+		samples := 1000
+		r.BootstrapSamples = &samples
+	}
+	return r
+}
+
+func float64Value(v float64) *float64 {
+	return &v
+}
+
+// modelOutput the scores of an output of a model
+type modelOutput struct {
+	tdoID         string
+	bleu          bleuStats
+	wordErrorRate float64
+}
+
+// modelKey the key of a model in the summary, a model ID is only unique within its engine
+func modelKey(engineID, modelID string) string {
+	return engineID + "/" + modelID
+}
+
+// rankedModel a model of an engine and its scores over all its TDOs
+type rankedModel struct {
+	ModelID string `json:"modelId"`
+	Assets  int    `json:"assets"`
+	// BLEU the corpus BLEU of its outputs
+	BLEU float64 `json:"bleu"`
+	// WordErrorRate the mean word error rate of its outputs
+	WordErrorRate float64 `json:"wordErrorRate"`
+}
+
+// modelRanking the models of an engine, by decreasing corpus BLEU
+type modelRanking struct {
+	EngineID   string        `json:"engineId"`
+	EngineName string        `json:"engineName"`
+	Models     []rankedModel `json:"models"`
+}
+
+// promotionDecision whether a challenger replaces the champion of its engine, on the TDOs both benchmarked
+type promotionDecision struct {
+	EngineID          string   `json:"engineId"`
+	ChampionModelID   string   `json:"championModelId"`
+	ChallengerModelID string   `json:"challengerModelId"`
+	Decision          string   `json:"decision"`
+	Reasons           []string `json:"reasons"`
+	PairedTDOs        int      `json:"pairedTdos"`
+	ChampionBLEU      float64  `json:"championBleu"`
+	ChallengerBLEU    float64  `json:"challengerBleu"`
+	BleuGain          float64  `json:"bleuGain"`
+	// PValue the share of the bootstrap samples where the challenger does not beat the champion
+	PValue float64 `json:"pValue"`
+	// WordErrorRateChange the mean word error rate of the challenger minus the champion's
+	WordErrorRateChange float64 `json:"wordErrorRateChange"`
+}
+
+// selectModels rank the models of each engine benchmarked with several models, and decide on the challengers
+// when the rules name a champion or the training mode a candidate
+func selectModels(summary *benchmarkSummary, rules promotionRules, candidateModelID string) (rankings []modelRanking, decisions []promotionDecision) {
+	byEngine := make(map[string][]*modelMetrics)
+	for _, model := range summary.Models {
+		if model.ModelID != "" {
+			byEngine[model.EngineID] = append(byEngine[model.EngineID], model)
+		}
+	}
+	engineIDs := make([]string, 0, len(byEngine))
+	for engineID, models := range byEngine {
+		if len(models) > 1 {
+			engineIDs = append(engineIDs, engineID)
+		}
+	}
+	sort.Strings(engineIDs)
+
+	for _, engineID := range engineIDs {
+		models := byEngine[engineID]
+		ranking := modelRanking{EngineID: engineID, EngineName: models[0].EngineName}
+		for _, model := range models {
+			ranking.Models = append(ranking.Models, rankModel(model))
+		}
+		sort.Slice(ranking.Models, func(i, j int) bool {
+			if ranking.Models[i].BLEU != ranking.Models[j].BLEU {
+				return ranking.Models[i].BLEU > ranking.Models[j].BLEU
+			}
+			return ranking.Models[i].ModelID < ranking.Models[j].ModelID
+		})
+		rankings = append(rankings, ranking)
+
+		champion, challengers := contenders(ranking, rules.ChampionModelID, candidateModelID)
+		if champion == "" {
+			continue
+		}
+		for _, challenger := range challengers {
+			decisions = append(decisions, decide(engineID, summary.Models[modelKey(engineID, champion)], summary.Models[modelKey(engineID, challenger)], rules))
+		}
+	}
+	return rankings, decisions
+}
+
+// rankModel the corpus BLEU and mean word error rate of all the outputs of the model
+func rankModel(model *modelMetrics) rankedModel {
+	ranked := rankedModel{ModelID: model.ModelID, Assets: len(model.outputs)}
+	var stats bleuStats
+	for _, output := range model.outputs {
+		stats.add(output.bleu)
+		ranked.WordErrorRate += output.wordErrorRate
+	}
+	ranked.BLEU = stats.score()
+	if ranked.Assets > 0 {
+		ranked.WordErrorRate /= float64(ranked.Assets)
+	}
+	return ranked
+}
+
+// contenders the champion and the challengers of the ranked engine: the champion of the rules, or the best model
+// other than the candidate, challenged by the candidate or else by every other model. No champion without either.
+func contenders(ranking modelRanking, championModelID, candidateModelID string) (champion string, challengers []string) {
+	has := func(modelID string) bool {
+		for _, model := range ranking.Models {
+			if model.ModelID == modelID {
+				return true
+			}
+		}
+		return false
+	}
+	hasCandidate := candidateModelID != "" && has(candidateModelID)
+	switch {
+	case championModelID != "" && has(championModelID):
+		champion = championModelID
+	case hasCandidate:
+		for _, model := range ranking.Models {
+			if model.ModelID != candidateModelID {
+				champion = model.ModelID
+				break
+			}
+		}
+	default:
+		return "", nil
+	}
+
+	if hasCandidate && candidateModelID != champion {
+		return champion, []string{candidateModelID}
+	}
+	for _, model := range ranking.Models {
+		if model.ModelID != champion {
+			challengers = append(challengers, model.ModelID)
+		}
+	}
+	return champion, challengers
+}
+
+// outputsByTDO the outputs of the model summed per TDO, their BLEU statistics added and their word error rates averaged
+func outputsByTDO(model *modelMetrics) map[string]modelOutput {
+	byTDO := make(map[string]modelOutput)
+	counts := make(map[string]int)
+	for _, output := range model.outputs {
+		sum := byTDO[output.tdoID]
+		sum.tdoID = output.tdoID
+		sum.bleu.add(output.bleu)
+		sum.wordErrorRate += output.wordErrorRate
+		byTDO[output.tdoID] = sum
+		counts[output.tdoID]++
+	}
+	for tdoID, sum := range byTDO {
+		sum.wordErrorRate /= float64(counts[tdoID])
+		byTDO[tdoID] = sum
+	}
+	return byTDO
+}
+
+// decide compare the challenger with the champion on the TDOs both benchmarked, with a paired bootstrap over these TDOs.
+// The rules have their defaults.
+func decide(engineID string, champion, challenger *modelMetrics, rules promotionRules) promotionDecision {
+	minBleuGain, maxPValue, maxWerRegression, bootstrapSamples := *rules.MinBleuGain, *rules.MaxPValue, *rules.MaxWerRegression, *rules.BootstrapSamples
+	decision := promotionDecision{EngineID: engineID, ChampionModelID: champion.ModelID, ChallengerModelID: challenger.ModelID}
+	championOutputs, challengerOutputs := outputsByTDO(champion), outputsByTDO(challenger)
+	var tdoIDs []string
+	for tdoID := range challengerOutputs {
+		if _, ok := championOutputs[tdoID]; ok {
+			tdoIDs = append(tdoIDs, tdoID)
+		}
+	}
+	sort.Strings(tdoIDs)
+	decision.PairedTDOs = len(tdoIDs)
+	if len(tdoIDs) == 0 {
+		decision.Decision = decisionHold
+		decision.Reasons = []string{"no TDO was benchmarked with both models"}
+		return decision
+	}
+
+	var championStats, challengerStats bleuStats
+	for _, tdoID := range tdoIDs {
+		championStats.add(championOutputs[tdoID].bleu)
+		challengerStats.add(challengerOutputs[tdoID].bleu)
+		decision.WordErrorRateChange += challengerOutputs[tdoID].wordErrorRate - championOutputs[tdoID].wordErrorRate
+	}
+	decision.WordErrorRateChange /= float64(len(tdoIDs))
+	decision.ChampionBLEU, decision.ChallengerBLEU = championStats.score(), challengerStats.score()
+	decision.BleuGain = decision.ChallengerBLEU - decision.ChampionBLEU
+
+	// the share of the resamplings of the TDOs where the challenger does not gain, or does not lose
+	notBetter, notWorse := 0, 0
+	random := rand.New(rand.NewSource(bootstrapSeed))
+	for sample := 0; sample < bootstrapSamples; sample++ {
+		var championSample, challengerSample bleuStats
+		for range tdoIDs {
+			tdoID := tdoIDs[random.Intn(len(tdoIDs))]
+			championSample.add(championOutputs[tdoID].bleu)
+			challengerSample.add(challengerOutputs[tdoID].bleu)
+		}
+		gain := challengerSample.score() - championSample.score()
+		if gain <= 0 {
+			notBetter++
+		}
+		if gain >= 0 {
+			notWorse++
+		}
+	}
+	decision.PValue = float64(notBetter) / float64(bootstrapSamples)
+	worsePValue := float64(notWorse) / float64(bootstrapSamples)
+
+	werRegression := decision.WordErrorRateChange > maxWerRegression
+	switch {
+	case werRegression:
+		decision.Decision = decisionReject
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("word error rate regresses by %.2f points, more than %.2f", decision.WordErrorRateChange*100, maxWerRegression*100))
+	case decision.BleuGain < 0 && worsePValue < maxPValue:
+		decision.Decision = decisionReject
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("BLEU drops by %.2f (p=%.3f)", -decision.BleuGain, worsePValue))
+	case decision.BleuGain >= minBleuGain && decision.PValue < maxPValue:
+		decision.Decision = decisionPromote
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("BLEU gains %.2f, at least %.2f (p=%.3f < %.2f)", decision.BleuGain, minBleuGain, decision.PValue, maxPValue))
+	default:
+		decision.Decision = decisionHold
+		if decision.BleuGain < minBleuGain {
+			decision.Reasons = append(decision.Reasons, fmt.Sprintf("BLEU gains %.2f, less than %.2f", decision.BleuGain, minBleuGain))
+		}
+		if decision.PValue >= maxPValue {
+			decision.Reasons = append(decision.Reasons, fmt.Sprintf("the gain is not significant (p=%.3f >= %.2f)", decision.PValue, maxPValue))
+		}
+	}
+	if !werRegression {
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("word error rate changes by %+.2f points, within %.2f", decision.WordErrorRateChange*100, maxWerRegression*100))
+	}
+	return decision
+}
+
+// selectionSummary the decisions, or the rankings without decisions, for the info message
+func selectionSummary(rankings []modelRanking, decisions []promotionDecision) string {
+	parts := make([]string, 0, len(decisions))
+	for _, decision := range decisions {
+		parts = append(parts, fmt.Sprintf("%s %s over champion %s (BLEU %+.2f, p=%.3f, WER %+.2f points)", decision.Decision, decision.ChallengerModelID,
+			decision.ChampionModelID, decision.BleuGain, decision.PValue, decision.WordErrorRateChange*100))
+	}
+	if len(parts) > 0 {
+		return strings.Join(parts, "; ")
+	}
+	for _, ranking := range rankings {
+		models := make([]string, len(ranking.Models))
+		for i, model := range ranking.Models {
+			models[i] = fmt.Sprintf("%s %.2f", model.ModelID, model.BLEU)
+		}
+		name := ranking.EngineName
+		if name == "" {
+			name = ranking.EngineID
+		}
+		parts = append(parts, fmt.Sprintf("%s BLEU %s", name, strings.Join(models, ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// persistSelectionSDO write the rankings and decisions of the task as a summary benchmark SDO
+func persistSelectionSDO(parentCtx context.Context, graphQLClient *api.PlatformGraphQLClient, enginePayload *BenchmarkEnginePayload, benchmarkSchemaID string, rankings []modelRanking, decisions []promotionDecision) error {
+	ctx, cancel := context.WithTimeout(detachedContext(parentCtx), persistTimeout)
+	defer cancel()
+
+	engineIDs := make([]string, len(rankings))
+	for i, ranking := range rankings {
+		engineIDs[i] = ranking.EngineID
+	}
+	summarySDO := BenchmarkSDOData{
+		Name:           "Model selection",
+		TaskID:         enginePayload.TaskID,
+		Engines:        strings.Join(engineIDs, ","),
+		Timestamp:      time.Now().Unix(),
+		OrganizationID: enginePayload.OrganizationID,
+		Rankings:       rankings,
+		Decisions:      decisions,
+	}
+	if enginePayload.TaskPayload.TrainingWorkflowSDOID != "" && enginePayload.TaskPayload.TrainingWorkflowSDOSchemaID != "" {
+		summarySDO.TrainingJob = SDOReference{
+			ID:       enginePayload.TaskPayload.TrainingWorkflowSDOID,
+			SchemaID: enginePayload.TaskPayload.TrainingWorkflowSDOSchemaID,
+		}
+	}
+	if enginePayload.Test {
+		logFrom(ctx).Infof("This is a test, but the model selection SDO would have been created...SDO: %s", toJSONString(summarySDO))
+		return nil
+	}
+	// the schemas published before the model selection don't declare its properties
+	schema, err := graphQLClient.FetchSchema(ctx, benchmarkSchemaID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch the schema %s", benchmarkSchemaID)
+	}
+	if schema != nil {
+		rejected, err := rejectedProperties(schema.Definition, summarySDO)
+		if err != nil {
+			return err
+		}
+		if len(rejected) > 0 {
+			return fmt.Errorf("the schema %s doesn't accept the properties %s, run provision to publish a schema with them", benchmarkSchemaID, strings.Join(rejected, ", "))
+		}
+	}
+	sdo, err := graphQLClient.CreateSDO(ctx, benchmarkSchemaID, summarySDO)
+	if err != nil {
+		return err
+	}
+	logFrom(ctx).Infof("Model selection SDO successfully created with ID: %s", sdo.ID)
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testOutput an output of a model on a TDO, scored against the reference of the TDO
+type testOutput struct {
+	assetID, tdoID string
+	hypothesis     string
+	wordErrorRate  float64
+}
+
+func testReference(tdoID string) []string {
+	return strings.Fields(fmt.Sprintf("the report %s lists every word of the meeting in order", tdoID))
+}
+
+func testModel(engineID, modelID string, outputs ...testOutput) *modelMetrics {
+	model := &modelMetrics{ModelID: modelID, EngineID: engineID, outputs: make(map[string]modelOutput)}
+	for _, output := range outputs {
+		model.Assets++
+		model.outputs[output.assetID] = modelOutput{
+			tdoID:         output.tdoID,
+			bleu:          newBleuStats(testReference(output.tdoID), strings.Fields(output.hypothesis)),
+			wordErrorRate: output.wordErrorRate,
+		}
+	}
+	return model
+}
+
+// testOutputs an output per TDO, exact or missing words, with the given word error rate
+func testOutputs(prefix string, tdos int, exact bool, wordErrorRate float64) []testOutput {
+	outputs := make([]testOutput, tdos)
+	for i := range outputs {
+		tdoID := fmt.Sprintf("tdo%d", i)
+		hypothesis := strings.Join(testReference(tdoID), " ")
+		if !exact {
+			hypothesis = fmt.Sprintf("the report %s lists word the meeting order", tdoID)
+		}
+		outputs[i] = testOutput{assetID: prefix + tdoID, tdoID: tdoID, hypothesis: hypothesis, wordErrorRate: wordErrorRate}
+	}
+	return outputs
+}
+
+func TestPromotionRulesWithDefaults(t *testing.T) {
+	zero, samples := 0.0, 10
+	tests := []struct {
+		name                                     string
+		rules                                    promotionRules
+		minBleuGain, maxPValue, maxWerRegression float64
+		bootstrapSamples                         int
+	}{
+		{"defaults", promotionRules{}, 0.5, 0.05, 0.01, 1000},
+		{"explicit zeros are kept", promotionRules{MinBleuGain: &zero, MaxWerRegression: &zero, MaxPValue: &zero}, 0, 0, 0, 1000},
+		{"explicit samples", promotionRules{BootstrapSamples: &samples}, 0.5, 0.05, 0.01, 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules := test.rules.withDefaults()
+			if *rules.MinBleuGain != test.minBleuGain || *rules.MaxPValue != test.maxPValue || *rules.MaxWerRegression != test.maxWerRegression || *rules.BootstrapSamples != test.bootstrapSamples {
+				t.Errorf("withDefaults() = %v %v %v %v", *rules.MinBleuGain, *rules.MaxPValue, *rules.MaxWerRegression, *rules.BootstrapSamples)
+			}
+		})
+	}
+}
+
+func TestDecide(t *testing.T) {
+	rules := promotionRules{}.withDefaults()
+	tests := []struct {
+		name                 string
+		champion, challenger *modelMetrics
+		decision             string
+		pairedTDOs           int
+	}{
+		{
+			name:       "significant BLEU gain",
+			champion:   testModel("e", "champion", testOutputs("c", 20, false, 0.2)...),
+			challenger: testModel("e", "challenger", testOutputs("n", 20, true, 0.2)...),
+			decision:   decisionPromote,
+			pairedTDOs: 20,
+		},
+		{
+			name:       "word error rate regression",
+			champion:   testModel("e", "champion", testOutputs("c", 20, false, 0.1)...),
+			challenger: testModel("e", "challenger", testOutputs("n", 20, true, 0.2)...),
+			decision:   decisionReject,
+			pairedTDOs: 20,
+		},
+		{
+			name:       "significant BLEU drop",
+			champion:   testModel("e", "champion", testOutputs("c", 20, true, 0.2)...),
+			challenger: testModel("e", "challenger", testOutputs("n", 20, false, 0.2)...),
+			decision:   decisionReject,
+			pairedTDOs: 20,
+		},
+		{
+			name:       "no gain",
+			champion:   testModel("e", "champion", testOutputs("c", 20, true, 0.2)...),
+			challenger: testModel("e", "challenger", testOutputs("n", 20, true, 0.2)...),
+			decision:   decisionHold,
+			pairedTDOs: 20,
+		},
+		{
+			name:       "no TDO in common",
+			champion:   testModel("e", "champion", testOutput{"c1", "tdo1", "the report", 0.2}),
+			challenger: testModel("e", "challenger", testOutput{"n2", "tdo2", "the report", 0.2}),
+			decision:   decisionHold,
+		},
+		{
+			name:     "several outputs on a TDO are paired once",
+			champion: testModel("e", "champion", testOutputs("c", 20, false, 0.2)...),
+			challenger: testModel("e", "challenger", append(testOutputs("n", 20, true, 0.2),
+				testOutputs("m", 20, true, 0.2)...)...),
+			decision:   decisionPromote,
+			pairedTDOs: 20,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decision := decide("e", test.champion, test.challenger, rules)
+			if decision.Decision != test.decision {
+				t.Errorf("decide() = %s, want %s: %s", decision.Decision, test.decision, strings.Join(decision.Reasons, ", "))
+			}
+			if decision.PairedTDOs != test.pairedTDOs {
+				t.Errorf("paired %d TDOs, want %d", decision.PairedTDOs, test.pairedTDOs)
+			}
+		})
+	}
+}
+
+func TestSelectModels(t *testing.T) {
+	summary := &benchmarkSummary{Models: make(map[string]*modelMetrics)}
+	for _, model := range []*modelMetrics{
+		testModel("e1", "shared", testOutputs("a", 10, false, 0.2)...),
+		testModel("e1", "better", testOutputs("b", 10, true, 0.2)...),
+		// the same model ID on another engine is another model
+		testModel("e2", "shared", testOutputs("c", 10, true, 0.2)...),
+	} {
+		summary.Models[modelKey(model.EngineID, model.ModelID)] = model
+	}
+	// two outputs of the model on each TDO
+	more := testModel("e1", "better", testOutputs("d", 10, true, 0.2)...)
+	for assetID, output := range more.outputs {
+		summary.Models[modelKey("e1", "better")].outputs[assetID] = output
+		summary.Models[modelKey("e1", "better")].Assets++
+	}
+
+	rankings, decisions := selectModels(summary, promotionRules{ChampionModelID: "shared"}.withDefaults(), "")
+	if len(rankings) != 1 || rankings[0].EngineID != "e1" {
+		t.Fatalf("rankings = %+v, want the engine e1 only", rankings)
+	}
+	tests := []struct {
+		modelID string
+		assets  int
+	}{
+		{"better", 20},
+		{"shared", 10},
+	}
+	for i, test := range tests {
+		if model := rankings[0].Models[i]; model.ModelID != test.modelID || model.Assets != test.assets {
+			t.Errorf("rank %d = %s with %d assets, want %s with %d", i, model.ModelID, model.Assets, test.modelID, test.assets)
+		}
+	}
+	if len(decisions) != 1 || decisions[0].ChallengerModelID != "better" || decisions[0].Decision != decisionPromote {
+		t.Errorf("decisions = %+v, want better promoted", decisions)
+	}
+	if assets := summary.modelAssets("shared"); assets != 20 {
+		t.Errorf("modelAssets(shared) = %d, want the 20 assets of both engines", assets)
+	}
+}
+
+func TestContenders(t *testing.T) {
+	ranking := modelRanking{Models: []rankedModel{{ModelID: "m1"}, {ModelID: "m2"}, {ModelID: "m3"}}}
+	tests := []struct {
+		name                       string
+		championModelID, candidate string
+		champion                   string
+		challengers                []string
+	}{
+		{"champion challenged by all", "m2", "", "m2", []string{"m1", "m3"}},
+		{"champion challenged by the candidate", "m2", "m3", "m2", []string{"m3"}},
+		{"candidate against the best other model", "", "m1", "m2", []string{"m1"}},
+		{"unknown champion ranks only", "m9", "", "", nil},
+		{"nothing to decide", "", "", "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			champion, challengers := contenders(ranking, test.championModelID, test.candidate)
+			if champion != test.champion || strings.Join(challengers, ",") != strings.Join(test.challengers, ",") {
+				t.Errorf("contenders() = %s, %v, want %s, %v", champion, challengers, test.champion, test.challengers)
+			}
+		})
+	}
+}
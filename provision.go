@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// benchmarkSchemaMajorVersion the major version of the generated benchmark SDO schema
+const benchmarkSchemaMajorVersion = 1
+
+// benchmarkSDOSchema the JSON Schema of the benchmark SDOs of the category, generated from the asset benchmark SDO
+// type and the summary SDO type, which the task writes to the same schema
+func benchmarkSDOSchema(categoryID string) map[string]interface{} {
+	var assetSDO interface{} = AssetBenchmarkSDODataForTranscription{}
+	if categoryID == categoryFacialDetectionID {
+		assetSDO = AssetBenchmarkSDODataForFaceDetection{}
+	}
+	schema := jsonSchemaOf(reflect.TypeOf(assetSDO), map[reflect.Type]bool{})
+	properties := schema["properties"].(map[string]interface{})
+	summary := jsonSchemaOf(reflect.TypeOf(BenchmarkSDOData{}), map[reflect.Type]bool{})
+	for name, property := range summary["properties"].(map[string]interface{}) {
+		if _, found := properties[name]; !found {
+			properties[name] = property
+		}
+	}
+
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = fmt.Sprintf("%s %s benchmark", serviceName, categoryLabel(categoryID))
+	return schema
+}
+
+// jsonSchemaOf the JSON Schema of the values encoding/json marshals from the type. A type nested in itself is left open.
+func jsonSchemaOf(t reflect.Type, visiting map[reflect.Type]bool) map[string]interface{} {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t, nullable = t.Elem(), true
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return withNull(map[string]interface{}{"type": "string", "format": "date-time"}, nullable)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return withNull(map[string]interface{}{"type": "boolean"}, nullable)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return withNull(map[string]interface{}{"type": "integer"}, nullable)
+	case reflect.Float32, reflect.Float64:
+		return withNull(map[string]interface{}{"type": "number"}, nullable)
+	case reflect.String:
+		return withNull(map[string]interface{}{"type": "string"}, nullable)
+	case reflect.Slice, reflect.Array:
+		// a nil slice is marshalled as null
+		return withNull(map[string]interface{}{"type": "array", "items": jsonSchemaOf(t.Elem(), visiting)}, nullable || t.Kind() == reflect.Slice)
+	case reflect.Map:
+		return withNull(map[string]interface{}{"type": "object", "additionalProperties": jsonSchemaOf(t.Elem(), visiting)}, true)
+	case reflect.Struct:
+		if visiting[t] {
+			return map[string]interface{}{}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		properties := make(map[string]interface{})
+		addStructProperties(t, properties, visiting)
+		return withNull(map[string]interface{}{"type": "object", "properties": properties}, nullable)
+	}
+	return map[string]interface{}{}
+}
+
+// addStructProperties add the marshalled fields of the struct to the properties, those of its embedded structs included
+func addStructProperties(t reflect.Type, properties map[string]interface{}, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				addStructProperties(embedded, properties, visiting)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, found := properties[name]; !found {
+			properties[name] = jsonSchemaOf(field.Type, visiting)
+		}
+	}
+}
+
+func withNull(schema map[string]interface{}, nullable bool) map[string]interface{} {
+	if nullable {
+		schema["type"] = []string{schema["type"].(string), "null"}
+	}
+	return schema
+}
+
+// provisionBenchmarkSchema make sure the category has a data registry with a published schema accepting the benchmark
+// SDOs. Without dataRegistryID, the data registry named after the category is used, and created when there is none. The
+// generated schema is published when the registry has no published schema, or when the published one lacks some of the
+// generated properties, as a new version of its major version. It returns the IDs of the data registry and of its
+// published schema.
+func provisionBenchmarkSchema(ctx context.Context, graphQLClient *api.PlatformGraphQLClient, categoryID, dataRegistryID string) (string, string, error) {
+	logger := logFrom(ctx)
+	name := fmt.Sprintf("%s %s", serviceName, categoryLabel(categoryID))
+	if dataRegistryID == "" {
+		registry, err := graphQLClient.FindDataRegistry(ctx, name)
+		if err != nil {
+			return "", "", errors.Wrapf(err, "failed to look up the data registry %s", name)
+		}
+		if registry != nil {
+			dataRegistryID = registry.ID
+			logger.Infof("Found the data registry %s (%s)", dataRegistryID, name)
+		}
+	}
+
+	schema := benchmarkSDOSchema(categoryID)
+	majorVersion := benchmarkSchemaMajorVersion
+	if dataRegistryID == "" {
+		registry, err := graphQLClient.CreateDataRegistry(ctx, name, fmt.Sprintf("The %s benchmark SDOs written by the %s engine", categoryLabel(categoryID), serviceName))
+		if err != nil {
+			return "", "", errors.Wrap(err, "failed to create the data registry")
+		} else if registry == nil || registry.ID == "" {
+			return "", "", errors.New("the created data registry has no ID")
+		}
+		dataRegistryID = registry.ID
+		logger.Infof("Created the data registry %s (%s)", dataRegistryID, name)
+	} else {
+		published, err := graphQLClient.FetchPublishedSchema(ctx, dataRegistryID)
+		if err != nil {
+			return "", "", errors.Wrapf(err, "failed to fetch the published schema of the data registry %s", dataRegistryID)
+		}
+		if published != nil && published.Schema != nil && published.Schema.ID != "" {
+			missing := missingProperties(published.Schema.Definition, schema)
+			if len(missing) == 0 {
+				return dataRegistryID, published.Schema.ID, nil
+			}
+			logger.Infof("The published schema %s of the data registry %s lacks the properties %s", published.Schema.ID, dataRegistryID, strings.Join(missing, ", "))
+			if published.Schema.MajorVersion > 0 {
+				majorVersion = published.Schema.MajorVersion
+			}
+		}
+	}
+
+	draft, err := graphQLClient.UpsertSchemaDraft(ctx, dataRegistryID, majorVersion, schema)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to create the schema of the data registry %s", dataRegistryID)
+	} else if draft == nil || draft.ID == "" {
+		return "", "", fmt.Errorf("the schema draft of the data registry %s has no ID", dataRegistryID)
+	}
+	if _, err := graphQLClient.PublishSchema(ctx, draft.ID); err != nil {
+		return "", "", errors.Wrapf(err, "failed to publish the schema %s", draft.ID)
+	}
+	logger.Infof("Published the schema %s of the data registry %s", draft.ID, dataRegistryID)
+	return dataRegistryID, draft.ID, nil
+}
+
+// missingProperties the top-level properties of the generated schema the schema definition doesn't declare, sorted
+func missingProperties(definition, generated map[string]interface{}) []string {
+	declared, _ := definition["properties"].(map[string]interface{})
+	var missing []string
+	for name := range generated["properties"].(map[string]interface{}) {
+		if _, found := declared[name]; !found {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// rejectedProperties the keys of the SDO data the schema definition rejects: those it doesn't declare when it has
+// additionalProperties false, sorted
+func rejectedProperties(definition map[string]interface{}, data interface{}) ([]string, error) {
+	if additional, ok := definition["additionalProperties"].(bool); !ok || additional {
+		return nil, nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	declared, _ := definition["properties"].(map[string]interface{})
+	var rejected []string
+	for name := range fields {
+		if _, found := declared[name]; !found {
+			rejected = append(rejected, name)
+		}
+	}
+	sort.Strings(rejected)
+	return rejected, nil
+}
+
+// saveDataRegistryID set the data registry of the category in the config file, keeping the rest of the file. Only the
+// provision command saves it, the tasks never write the config file.
+func saveDataRegistryID(categoryID, dataRegistryID string) error {
+	configFile, _ := configFilePath()
+	config := make(map[string]interface{})
+	if content, err := ioutil.ReadFile(configFile); err == nil {
+		if err := json.Unmarshal(content, &config); err != nil {
+			return errors.Wrapf(err, "failed to parse the config file %s", configFile)
+		}
+	}
+	registries, ok := config["dataRegistryIds"].(map[string]interface{})
+	if !ok {
+		registries = make(map[string]interface{})
+	}
+	registries[DataRegistryIDs{}.fieldForCategory(categoryID)] = dataRegistryID
+	config["dataRegistryIds"] = registries
+
+	content, err := json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(configFile, append(content, '\n'), 0644); err != nil {
+		return errors.Wrapf(err, "failed to write the config file %s", configFile)
+	}
+	return nil
+}
+
+// categoryIDOf the category ID of a category label or config field name
+func categoryIDOf(category string) (string, error) {
+	switch category {
+	case "translation":
+		return categoryTranslationID, nil
+	case "transcription":
+		return categoryTranscriptionID, nil
+	case "faceDetection", "face_detection":
+		return categoryFacialDetectionID, nil
+	}
+	return "", fmt.Errorf("unknown category %q, expected translation, transcription or faceDetection", category)
+}
+
+// provisionCommand the `provision` CLI command
+func provisionCommand() cli.Command {
+	return cli.Command{
+		Name:  "provision",
+		Usage: "Create the benchmark data registry of a category, publish its schema and store its ID in the config file",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "category", Value: "translation", Usage: "translation, transcription or faceDetection"},
+			cli.StringFlag{Name: "token", EnvVar: "VERITONE_TOKEN", Usage: "The Veritone API token"},
+			cli.StringFlag{Name: "api-url", Value: "https://api.veritone.com", EnvVar: "VERITONE_API_BASE_URL", Usage: "The Veritone API base URL"},
+			cli.BoolFlag{Name: "schema", Usage: "Print the generated schema instead"},
+		},
+		Action: func(c *cli.Context) error {
+			categoryID, err := categoryIDOf(c.String("category"))
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			if c.Bool("schema") {
+				b, err := json.MarshalIndent(benchmarkSDOSchema(categoryID), "", "    ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(b))
+				return nil
+			}
+
+			config, err := loadConfig()
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			options := config.LocalAPIOptions
+			options.Token, options.VeritoneAPIBaseURL = c.String("token"), c.String("api-url")
+			options.Logger = graphQLLogger{logger: engineLogger}
+			logRedactor.register(options.Token)
+			graphQLClient, err := api.NewCoreAPI(options)
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+
+			ctx := withLogger(context.Background(), engineLogger)
+			dataRegistryID, schemaID, err := provisionBenchmarkSchema(ctx, graphQLClient, categoryID, config.DataRegistryIDs.forCategory(categoryID))
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			if err := saveDataRegistryID(categoryID, dataRegistryID); err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			fmt.Printf("Data registry %s, published schema %s, stored as dataRegistryIds.%s\n", dataRegistryID, schemaID, config.DataRegistryIDs.fieldForCategory(categoryID))
+			return nil
+		},
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+func TestMissingProperties(t *testing.T) {
+	generated := map[string]interface{}{"properties": map[string]interface{}{"tdoId": nil, "rankings": nil, "decisions": nil}}
+	tests := []struct {
+		name       string
+		definition map[string]interface{}
+		want       string
+	}{
+		{"up to date", map[string]interface{}{"properties": map[string]interface{}{"tdoId": nil, "rankings": nil, "decisions": nil, "other": nil}}, ""},
+		{"published before the model selection", map[string]interface{}{"properties": map[string]interface{}{"tdoId": nil}}, "decisions,rankings"},
+		{"without properties", nil, "decisions,rankings,tdoId"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := strings.Join(missingProperties(test.definition, generated), ","); got != test.want {
+				t.Errorf("missingProperties() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRejectedProperties(t *testing.T) {
+	data := BenchmarkSDOData{Name: "Model selection", Rankings: []modelRanking{{EngineID: "e"}}}
+	tests := []struct {
+		name       string
+		definition map[string]interface{}
+		want       string
+	}{
+		{"additional properties allowed", map[string]interface{}{"properties": map[string]interface{}{}}, ""},
+		{"declared", map[string]interface{}{"additionalProperties": false, "properties": map[string]interface{}{
+			"name": nil, "tdoId": nil, "engines": nil, "timestamp": nil, "trainingJob": nil, "rankings": nil}}, ""},
+		{"undeclared", map[string]interface{}{"additionalProperties": false, "properties": map[string]interface{}{
+			"name": nil, "tdoId": nil, "engines": nil, "timestamp": nil, "trainingJob": nil}}, "rankings"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rejected, err := rejectedProperties(test.definition, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(rejected, ","); got != test.want {
+				t.Errorf("rejectedProperties() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// testRegistryServer answers the provisioning queries for a data registry whose published schema has the properties
+func testRegistryServer(t *testing.T, registries string, properties []string, upserted *map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.FormValue("query")
+		var variables map[string]interface{}
+		json.Unmarshal([]byte(r.FormValue("variables")), &variables)
+		declared := make(map[string]interface{})
+		for _, name := range properties {
+			declared[name] = map[string]interface{}{}
+		}
+		var data interface{}
+		switch {
+		case strings.Contains(query, "dataRegistries("):
+			data = map[string]interface{}{"dataRegistries": json.RawMessage(registries)}
+		case strings.Contains(query, "dataRegistry("):
+			data = map[string]interface{}{"dataRegistry": map[string]interface{}{"id": variables["dataRegistryId"],
+				"publishedSchema": map[string]interface{}{"id": "published", "majorVersion": 3, "definition": map[string]interface{}{"properties": declared}}}}
+		case strings.Contains(query, "upsertSchemaDraft"):
+			*upserted = variables
+			data = map[string]interface{}{"upsertSchemaDraft": map[string]interface{}{"id": "draft"}}
+		case strings.Contains(query, "updateSchemaState"):
+			data = map[string]interface{}{"updateSchemaState": map[string]interface{}{"id": "draft", "status": "published"}}
+		default:
+			t.Errorf("unexpected query %s", query)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+}
+
+func TestProvisionBenchmarkSchema(t *testing.T) {
+	generated := benchmarkSDOSchema(categoryTranslationID)["properties"].(map[string]interface{})
+	current := make([]string, 0, len(generated))
+	for name := range generated {
+		current = append(current, name)
+	}
+	tests := []struct {
+		name             string
+		dataRegistryID   string
+		registries       string
+		properties       []string
+		wantRegistryID   string
+		wantSchemaID     string
+		wantMajorVersion float64
+	}{
+		{"configured and up to date", "configured", `{"records":[]}`, current, "configured", "published", 0},
+		{"found by name", "", `{"records":[{"id":"named"}]}`, current, "named", "published", 0},
+		{"published before the model selection", "configured", `{"records":[]}`, []string{"tdoId", "assetId"}, "configured", "draft", 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var upserted map[string]interface{}
+			server := testRegistryServer(t, test.registries, test.properties, &upserted)
+			defer server.Close()
+			client, err := api.NewCoreAPI(api.Options{VeritoneAPIBaseURL: server.URL, GraphQLEndpoint: "/", Token: "token"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			registryID, schemaID, err := provisionBenchmarkSchema(context.Background(), client, categoryTranslationID, test.dataRegistryID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if registryID != test.wantRegistryID || schemaID != test.wantSchemaID {
+				t.Errorf("provisionBenchmarkSchema() = %s, %s, want %s, %s", registryID, schemaID, test.wantRegistryID, test.wantSchemaID)
+			}
+			if majorVersion, _ := upserted["majorVersion"].(float64); majorVersion != test.wantMajorVersion {
+				t.Errorf("upserted major version %v, want %v", majorVersion, test.wantMajorVersion)
+			}
+		})
+	}
+}
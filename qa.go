@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+const (
+	// the hypothesis/reference length ratios outside of which an output is flagged
+	minLengthRatio = 0.5
+	maxLengthRatio = 2.0
+
+	// maxLoopNgram the longest n-gram checked for repetition loops
+	maxLoopNgram = 4
+	// minLoopRepetitions and minLoopWords how many times in a row, and over how many words, an n-gram must repeat to be a loop
+	minLoopRepetitions = 4
+	minLoopWords       = 8
+
+	// minEmptySpanMs how much baseline speech a span without output must cover to be flagged
+	minEmptySpanMs = 10000
+
+	// maxQAFindings how many findings are listed in a benchmark SDO, the others are only counted
+	maxQAFindings = 100
+)
+
+// the checks of the QA pass, also the reasons of the task warnings
+const (
+	qaEmptyOutput      = "qa_empty_output"
+	qaLengthRatio      = "qa_length_ratio"
+	qaScriptMismatch   = "qa_script_mismatch"
+	qaLanguageMismatch = "qa_language_mismatch"
+	qaRepetitionLoop   = "qa_repetition_loop"
+	qaEmptySpan        = "qa_empty_span"
+)
+
+// qaFinding an obvious failure of the output
+type qaFinding struct {
+	Check   string `json:"check"`
+	Message string `json:"message"`
+	// WordIndex the position of a repetition loop in the output transcript, in words
+	WordIndex int `json:"wordIndex,omitempty"`
+	// StartTimeMs and StopTimeMs the span of an empty span
+	StartTimeMs int32 `json:"startTimeMs,omitempty"`
+	StopTimeMs  int32 `json:"stopTimeMs,omitempty"`
+}
+
+// qaMetrics the sanity checks of an output that do not depend on its alignment with the baseline: its length,
+// its script and language, its repetition loops and the spans of baseline speech it has no words for
+type qaMetrics struct {
+	// LengthRatio the number of output words over the number of baseline words
+	LengthRatio float64 `json:"lengthRatio"`
+	// ExpectedLanguage the target language of the payload, or else the language of the baseline
+	ExpectedLanguage string `json:"expectedLanguage,omitempty"`
+	DetectedLanguage string `json:"detectedLanguage,omitempty"`
+	ExpectedScript   string `json:"expectedScript,omitempty"`
+	DetectedScript   string `json:"detectedScript,omitempty"`
+	RepetitionLoops  int    `json:"repetitionLoops"`
+	EmptySpans       int    `json:"emptySpans"`
+	EmptySpanMs      int64  `json:"emptySpanMs"`
+	// Findings the first findings, in the order of the checks
+	Findings []qaFinding `json:"findings,omitempty"`
+	// FindingCount all the findings, listed or not
+	FindingCount int `json:"findingCount"`
+
+	// checkCounts and firstMessages the findings of each check and the message of its first one, listed or not
+	checkCounts   map[string]int
+	firstMessages map[string]string
+}
+
+func (m *qaMetrics) add(finding qaFinding) {
+	m.FindingCount++
+	if m.checkCounts == nil {
+		m.checkCounts = make(map[string]int)
+		m.firstMessages = make(map[string]string)
+	}
+	if m.checkCounts[finding.Check] == 0 {
+		m.firstMessages[finding.Check] = finding.Message
+	}
+	m.checkCounts[finding.Check]++
+	if len(m.Findings) < maxQAFindings {
+		m.Findings = append(m.Findings, finding)
+	}
+}
+
+// warnings one message per check that found something, keyed by check, counting the findings past maxQAFindings
+func (m *qaMetrics) warnings() map[string]string {
+	warnings := make(map[string]string, len(m.checkCounts))
+	for check, count := range m.checkCounts {
+		warnings[check] = m.firstMessages[check]
+		if count > 1 {
+			warnings[check] += fmt.Sprintf(" (and %d more)", count-1)
+		}
+	}
+	return warnings
+}
+
+// newQAMetrics run the QA pass over the output. The reference and hypothesis are the sanitized transcripts,
+// the output is the transcript as the engine wrote it. The asset, when known, gives the timing of the output.
+func newQAMetrics(baseline, asset *api.Asset, reference, hypothesis, output, targetLanguage string) *qaMetrics {
+	metrics := &qaMetrics{}
+	refTokens, hypTokens := strings.Fields(reference), strings.Fields(hypothesis)
+	if len(refTokens) > 0 {
+		metrics.LengthRatio = float64(len(hypTokens)) / float64(len(refTokens))
+		switch {
+		case len(hypTokens) == 0:
+			metrics.add(qaFinding{Check: qaEmptyOutput, Message: fmt.Sprintf("The output is empty while the baseline has %d words.", len(refTokens))})
+		case metrics.LengthRatio < minLengthRatio || metrics.LengthRatio > maxLengthRatio:
+			metrics.add(qaFinding{Check: qaLengthRatio, Message: fmt.Sprintf("The output has %d words for %d in the baseline, a length ratio of %.2f.", len(hypTokens), len(refTokens), metrics.LengthRatio)})
+		}
+	}
+
+	checkLanguage(metrics, baseline, output, targetLanguage)
+
+	for _, loop := range repetitionLoops(hypTokens) {
+		metrics.RepetitionLoops++
+		metrics.add(loop)
+	}
+
+	if baseline != nil && asset != nil && isTimed(baseline) && isTimed(asset) {
+		for _, span := range emptySpans(baseline.Segments, asset.Segments) {
+			metrics.EmptySpans++
+			metrics.EmptySpanMs += int64(span.StopTimeMs - span.StartTimeMs)
+			metrics.add(span)
+		}
+	}
+	return metrics
+}
+
+// checkLanguage compare the script and language of the output with the expected ones. Without a target language
+// they are expected to be those of the baseline transcript.
+func checkLanguage(metrics *qaMetrics, baseline *api.Asset, output, targetLanguage string) {
+	if targetLanguage == "" && baseline != nil && baseline.Data != nil {
+		targetLanguage = baseline.Data.Language
+	}
+	metrics.ExpectedLanguage = baseLanguage(targetLanguage)
+	metrics.ExpectedScript = languageScripts[metrics.ExpectedLanguage]
+	if baseline != nil {
+		if metrics.ExpectedLanguage == "" {
+			metrics.ExpectedLanguage = identifyLanguage(baseline.Transcript)
+		}
+		if metrics.ExpectedScript == "" {
+			metrics.ExpectedScript = dominantScript(baseline.Transcript)
+		}
+	}
+
+	metrics.DetectedScript = dominantScript(output)
+	if metrics.DetectedScript == "Latin" {
+		metrics.DetectedLanguage = identifyLanguage(output)
+	}
+
+	switch {
+	case metrics.ExpectedScript != "" && metrics.DetectedScript != "" && metrics.DetectedScript != metrics.ExpectedScript:
+		metrics.add(qaFinding{Check: qaScriptMismatch, Message: fmt.Sprintf("The output is written in the %s script, expected the %s script.", metrics.DetectedScript, metrics.ExpectedScript)})
+	case metrics.DetectedLanguage != "" && trigramProfiles[metrics.ExpectedLanguage] != nil && metrics.DetectedLanguage != metrics.ExpectedLanguage:
+		metrics.add(qaFinding{Check: qaLanguageMismatch, Message: fmt.Sprintf("The output looks like %s, expected %s. It may be untranslated.", metrics.DetectedLanguage, metrics.ExpectedLanguage)})
+	}
+}
+
+// repetitionLoops the n-grams repeated in a row at least minLoopRepetitions times over at least minLoopWords words,
+// the longest loop winning at each position
+func repetitionLoops(tokens []string) []qaFinding {
+	lowered := make([]string, len(tokens))
+	for i, token := range tokens {
+		lowered[i] = strings.ToLower(token)
+	}
+
+	var loops []qaFinding
+	for i := 0; i < len(lowered); {
+		bestN, bestRepetitions := 0, 0
+		for n := 1; n <= maxLoopNgram && i+n <= len(lowered); n++ {
+			repetitions := 1
+			for i+(repetitions+1)*n <= len(lowered) && sameTokens(lowered[i:i+n], lowered[i+repetitions*n:i+(repetitions+1)*n]) {
+				repetitions++
+			}
+			if repetitions >= minLoopRepetitions && repetitions*n >= minLoopWords && repetitions*n > bestRepetitions*bestN {
+				bestN, bestRepetitions = n, repetitions
+			}
+		}
+		if bestN == 0 {
+			i++
+			continue
+		}
+		loops = append(loops, qaFinding{
+			Check:     qaRepetitionLoop,
+			Message:   fmt.Sprintf("%q is repeated %d times in a row at word %d.", strings.Join(tokens[i:i+bestN], " "), bestRepetitions, i),
+			WordIndex: i,
+		})
+		i += bestN * bestRepetitions
+	}
+	return loops
+}
+
+func sameTokens(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// emptySpans the gaps between the output segments with words that cover at least minEmptySpanMs of baseline
+// speech, including before the first and after the last output segment. A span is trimmed to the speech it covers.
+func emptySpans(reference, hypothesis []api.TranscriptSegment) []qaFinding {
+	speech, covered := speechSpans(reference), speechSpans(hypothesis)
+	if len(speech) == 0 {
+		return nil
+	}
+
+	var spans []qaFinding
+	var gapStart int32
+	start := 0
+	for k := 0; k <= len(covered); k++ {
+		gapStop := speech[len(speech)-1].StopTimeMs
+		if k < len(covered) {
+			gapStop = covered[k].StartTimeMs
+		}
+		// skip the speech ending before the gap, the spans are sorted and merged
+		for start < len(speech) && speech[start].StopTimeMs <= gapStart {
+			start++
+		}
+		var speechMs int64
+		first, last := int32(-1), int32(-1)
+		for _, span := range speech[start:] {
+			if span.StartTimeMs >= gapStop {
+				break
+			}
+			from, to := maxInt32(span.StartTimeMs, gapStart), minInt32(span.StopTimeMs, gapStop)
+			if to <= from {
+				continue
+			}
+			speechMs += int64(to - from)
+			if first < 0 {
+				first = from
+			}
+			last = to
+		}
+		if speechMs >= minEmptySpanMs {
+			spans = append(spans, qaFinding{
+				Check:       qaEmptySpan,
+				Message:     fmt.Sprintf("The output has no words from %.1fs to %.1fs, where the baseline has %.1fs of speech.", float64(first)/1000, float64(last)/1000, float64(speechMs)/1000),
+				StartTimeMs: first,
+				StopTimeMs:  last,
+			})
+		}
+		if k < len(covered) {
+			gapStart = covered[k].StopTimeMs
+		}
+	}
+	return spans
+}
+
+// speechSpans the timed segments with words, sorted by start time and merged where they overlap
+func speechSpans(segments []api.TranscriptSegment) []api.TranscriptSegment {
+	spans := make([]api.TranscriptSegment, 0, len(segments))
+	for _, segment := range segments {
+		if segment.WordCount > 0 && segment.StopTimeMs > segment.StartTimeMs {
+			spans = append(spans, api.TranscriptSegment{StartTimeMs: segment.StartTimeMs, StopTimeMs: segment.StopTimeMs})
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].StartTimeMs < spans[j].StartTimeMs })
+
+	merged := spans[:0]
+	for _, span := range spans {
+		if n := len(merged); n > 0 && span.StartTimeMs <= merged[n-1].StopTimeMs {
+			merged[n-1].StopTimeMs = maxInt32(merged[n-1].StopTimeMs, span.StopTimeMs)
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+const (
+	testEnglish = "the weather was cold and the children played in the snow for hours before they went home to eat their dinner with the family"
+	testSpanish = "el tiempo era frío y los niños jugaron en la nieve durante horas antes de que se fueran a casa para cenar con la familia"
+	testFrench  = "le temps était froid et les enfants ont joué dans la neige pendant des heures avant de rentrer dîner avec la famille"
+	testRussian = "погода была холодной и дети играли в снегу несколько часов"
+)
+
+func TestDominantScript(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"latin", testEnglish, "Latin"},
+		{"cyrillic", testRussian, "Cyrillic"},
+		{"kana over a few kanji", "わたしはきのうともだちとこうえんにいきましたとてもたのしかった", "Japanese"},
+		{"mostly latin with a cyrillic word", testEnglish + " снег", "Latin"},
+		{"too few letters", "hello 123 !!!", ""},
+		{"only digits", strings.Repeat("1234567890 ", 5), ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := dominantScript(test.text); got != test.want {
+				t.Errorf("dominantScript() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIdentifyLanguage(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"english", testEnglish, "en"},
+		{"spanish", testSpanish, "es"},
+		{"french", testFrench, "fr"},
+		{"case and punctuation are ignored", strings.ToUpper(testEnglish) + "!", "en"},
+		{"too short", "the cat sat", ""},
+		{"no known trigram", strings.Repeat("xyzzy qwwq ", 20), ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := identifyLanguage(test.text); got != test.want {
+				t.Errorf("identifyLanguage() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckLanguage(t *testing.T) {
+	englishBaseline := &api.Asset{Transcript: testEnglish, Data: &api.EngineOutput{Language: "en-US"}}
+	tests := []struct {
+		name                      string
+		baseline                  *api.Asset
+		output, targetLanguage    string
+		wantExpected, wantScript  string
+		wantDetected, wantFinding string
+	}{
+		{"same language as the baseline", englishBaseline, testEnglish, "", "en", "Latin", "en", ""},
+		{"untranslated", englishBaseline, testEnglish, "es", "es", "Latin", "en", qaLanguageMismatch},
+		{"translated", englishBaseline, testSpanish, "es-MX", "es", "Latin", "es", ""},
+		{"other script", englishBaseline, testRussian, "", "en", "Latin", "", qaScriptMismatch},
+		{"expected script of the target", englishBaseline, testEnglish, "ru", "ru", "Cyrillic", "en", qaScriptMismatch},
+		// a language without a profile is only checked by its script
+		{"language without a profile", englishBaseline, testEnglish, "sv", "sv", "Latin", "en", ""},
+		{"language of the baseline transcript", &api.Asset{Transcript: testFrench}, testEnglish, "", "fr", "Latin", "en", qaLanguageMismatch},
+		{"no baseline", nil, testEnglish, "", "", "", "en", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metrics := &qaMetrics{}
+			checkLanguage(metrics, test.baseline, test.output, test.targetLanguage)
+			if metrics.ExpectedLanguage != test.wantExpected || metrics.ExpectedScript != test.wantScript || metrics.DetectedLanguage != test.wantDetected {
+				t.Errorf("expected %q in %q, detected %q, want %q in %q, detected %q", metrics.ExpectedLanguage, metrics.ExpectedScript, metrics.DetectedLanguage, test.wantExpected, test.wantScript, test.wantDetected)
+			}
+			var checks []string
+			for _, finding := range metrics.Findings {
+				checks = append(checks, finding.Check)
+			}
+			if test.wantFinding == "" && len(checks) > 0 || test.wantFinding != "" && !reflect.DeepEqual(checks, []string{test.wantFinding}) {
+				t.Errorf("findings = %v, want %q", checks, test.wantFinding)
+			}
+		})
+	}
+}
+
+func TestRepetitionLoops(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"no loop", "the cat sat on the mat", nil},
+		{"word repeated", "and then " + strings.Repeat("no ", 8) + "he left", []string{`"no" is repeated 8 times in a row at word 2.`}},
+		{"too few words", "yes " + strings.Repeat("no ", 7), nil},
+		{"too few repetitions", strings.Repeat("thank you very much ", 3), nil},
+		{"longest loop wins", strings.Repeat("thank you ", 5), []string{`"thank you" is repeated 5 times in a row at word 0.`}},
+		{"case is ignored", "Go go GO go go go go go", []string{`"Go" is repeated 8 times in a row at word 0.`}},
+		{"two loops", strings.Repeat("la ", 8) + "and " + strings.Repeat("oh yeah ", 4), []string{`"la" is repeated 8 times in a row at word 0.`, `"oh yeah" is repeated 4 times in a row at word 9.`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, loop := range repetitionLoops(strings.Fields(test.text)) {
+				if loop.Check != qaRepetitionLoop || !strings.HasSuffix(loop.Message, fmt.Sprintf(" at word %d.", loop.WordIndex)) {
+					t.Errorf("loop = %+v", loop)
+				}
+				got = append(got, loop.Message)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("repetitionLoops() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// testSegments timed segments with words, from start and stop times in seconds
+func testSegments(spans ...[2]int32) []api.TranscriptSegment {
+	segments := make([]api.TranscriptSegment, len(spans))
+	for i, span := range spans {
+		segments[i] = api.TranscriptSegment{StartTimeMs: span[0] * 1000, StopTimeMs: span[1] * 1000, WordCount: 1}
+	}
+	return segments
+}
+
+func TestEmptySpans(t *testing.T) {
+	tests := []struct {
+		name       string
+		reference  []api.TranscriptSegment
+		hypothesis []api.TranscriptSegment
+		// the start and stop times of each span, in seconds
+		want [][2]int32
+	}{
+		{"covered", testSegments([2]int32{0, 30}), testSegments([2]int32{0, 10}, [2]int32{10, 30}), nil},
+		{"gap in the middle", testSegments([2]int32{0, 30}), testSegments([2]int32{0, 5}, [2]int32{20, 30}), [][2]int32{{5, 20}}},
+		{"gap too short", testSegments([2]int32{0, 30}), testSegments([2]int32{0, 10}, [2]int32{19, 30}), nil},
+		{"before the first and after the last segment", testSegments([2]int32{0, 60}), testSegments([2]int32{15, 45}), [][2]int32{{0, 15}, {45, 60}}},
+		// the silence of the baseline in the gap is not counted, the span is trimmed to its speech
+		{"silence in the gap", testSegments([2]int32{0, 5}, [2]int32{8, 14}, [2]int32{40, 46}, [2]int32{50, 52}), testSegments([2]int32{0, 5}, [2]int32{50, 52}), [][2]int32{{8, 46}}},
+		{"overlapping baseline segments", testSegments([2]int32{0, 8}, [2]int32{4, 12}), testSegments([2]int32{0, 1}), [][2]int32{{1, 12}}},
+		{"no output", testSegments([2]int32{0, 12}), nil, [][2]int32{{0, 12}}},
+		{"segments without words are not speech", []api.TranscriptSegment{{StartTimeMs: 0, StopTimeMs: 30000}}, nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got [][2]int32
+			for _, span := range emptySpans(test.reference, test.hypothesis) {
+				got = append(got, [2]int32{span.StartTimeMs / 1000, span.StopTimeMs / 1000})
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("emptySpans() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQAWarningsCountPastTheListedFindings(t *testing.T) {
+	metrics := &qaMetrics{}
+	for i := 0; i < maxQAFindings+5; i++ {
+		metrics.add(qaFinding{Check: qaRepetitionLoop, Message: fmt.Sprintf("loop %d", i)})
+	}
+	// only counted, the list is full
+	metrics.add(qaFinding{Check: qaEmptySpan, Message: "span 0"})
+	metrics.add(qaFinding{Check: qaEmptySpan, Message: "span 1"})
+
+	if len(metrics.Findings) != maxQAFindings || metrics.FindingCount != maxQAFindings+7 {
+		t.Errorf("%d findings listed of %d, want %d of %d", len(metrics.Findings), metrics.FindingCount, maxQAFindings, maxQAFindings+7)
+	}
+	want := map[string]string{
+		qaRepetitionLoop: fmt.Sprintf("loop 0 (and %d more)", maxQAFindings+4),
+		qaEmptySpan:      "span 0 (and 1 more)",
+	}
+	if warnings := metrics.warnings(); !reflect.DeepEqual(warnings, want) {
+		t.Errorf("warnings() = %v, want %v", warnings, want)
+	}
+}
+
+func TestAppendQAWarning(t *testing.T) {
+	defer func(payload BenchmarkEnginePayload) { myEnginePayload = payload }(myEnginePayload)
+	myEnginePayload = BenchmarkEnginePayload{TaskPayload: TaskPayload{CategoryID: categoryTranscriptionID}}
+	logRedactor.register(testToken)
+	defer logRedactor.unregister(testToken)
+	client, bodies, closeServer := testWarningServer(t)
+	defer closeServer()
+
+	counted := `translation_benchmark_qa_findings_total{category="transcription",check="` + qaEmptySpan + `"}`
+	before := scrapeMetrics(t)[counted]
+	if err := appendQAWarning(context.Background(), client, "task", "a1", qaEmptySpan, "Nothing was output for "+testToken); err != nil {
+		t.Fatal(err)
+	}
+	if after := scrapeMetrics(t)[counted]; after-before != 1 {
+		t.Errorf("%s went up by %v, want 1", counted, after-before)
+	}
+	if len(bodies()) != 1 || strings.Contains(bodies()[0], testToken) || !strings.Contains(bodies()[0], "Nothing was output for "+redactedValue) {
+		t.Errorf("warnings sent = %q, want one without the token", bodies())
+	}
+}
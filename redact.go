@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// redactedValue replaces secrets in anything displayed or logged
+const redactedValue = "[REDACTED]"
+
+var (
+	// bearerPattern matches an Authorization header value
+	bearerPattern = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=:\-]+`)
+	// tokenFieldPattern matches a JSON token field, e.g. in a raw payload
+	tokenFieldPattern = regexp.MustCompile(`(?i)("(?:token|apiToken|accessToken|password|secret)"\s*:\s*")[^"]*(")`)
+
+	logRedactor = &redactor{}
+)
+
+// secret a string that is never displayed: formatting it with any fmt verb or marshalling it to JSON masks it.
+// Use string(s) where the actual value is needed.
+type secret string
+
+func (s secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+// GoString masks the secret for %#v
+func (s secret) GoString() string {
+	return `"` + s.String() + `"`
+}
+
+// MarshalJSON masks the secret when the value holding it is marshalled, e.g. to be logged
+func (s secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// redactor scrubs the registered secrets and anything shaped like a credential out of text
+type redactor struct {
+	sync.RWMutex
+	secrets []string
+}
+
+// register a secret value to scrub, e.g. the token of the current payload
+func (r *redactor) register(value string) {
+	if value == "" {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	for _, s := range r.secrets {
+		if s == value {
+			return
+		}
+	}
+	r.secrets = append(r.secrets, value)
+}
+
+// unregister stop scrubbing a secret value, e.g. the token of a finished task
+func (r *redactor) unregister(value string) {
+	r.Lock()
+	defer r.Unlock()
+	for i, s := range r.secrets {
+		if s == value {
+			r.secrets = append(r.secrets[:i], r.secrets[i+1:]...)
+			return
+		}
+	}
+}
+
+// scrub returns the text with every secret masked
+func (r *redactor) scrub(text string) string {
+	r.RLock()
+	for _, s := range r.secrets {
+		text = strings.Replace(text, s, redactedValue, -1)
+	}
+	r.RUnlock()
+	text = bearerPattern.ReplaceAllString(text, "${1}"+redactedValue)
+	return tokenFieldPattern.ReplaceAllString(text, "${1}"+redactedValue+"${2}")
+}
+
+// scrub mask the secrets in text with the engine redactor
+func scrub(text string) string {
+	return logRedactor.scrub(text)
+}
+
+// scrubWriter a writer masking secrets before they reach the underlying log output
+type scrubWriter struct {
+	out      io.Writer
+	redactor *redactor
+}
+
+func newScrubWriter(out io.Writer) *scrubWriter {
+	return &scrubWriter{out: out, redactor: logRedactor}
+}
+
+func (w *scrubWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.out, w.redactor.scrub(string(p))); err != nil {
+		return 0, err
+	}
+	// report the original length, the caller doesn't know the line was rewritten
+	return len(p), nil
+}
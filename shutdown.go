@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// shutdownGracePeriod how long in-flight benchmarks get to flush their results after a signal
+	shutdownGracePeriod = 25 * time.Second
+	// persistTimeout the timeout used to write benchmark SDOs, independent from the shutdown context
+	persistTimeout = 20 * time.Second
+)
+
+// errInterrupted is returned when a shutdown signal stops a benchmark before every TDO was processed
+var errInterrupted = errors.New("benchmark interrupted by shutdown")
+
+var (
+	// gracefulShutdownCtx is cancelled as soon as the engine receives SIGTERM or SIGINT
+	gracefulShutdownCtx, gracefulShutdownCancel = context.WithCancel(context.Background())
+
+	jobProcessingWaitGroup sync.WaitGroup
+	shutdownMutex          sync.Mutex
+	draining               bool
+
+	// notifySignals relays the signals to the channel, replaced by the tests to send them
+	notifySignals = signal.Notify
+)
+
+// beginProcessing registers an in-flight /process request. It returns false once the engine is draining.
+func beginProcessing() bool {
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+	if draining {
+		return false
+	}
+	jobProcessingWaitGroup.Add(1)
+	return true
+}
+
+// endProcessing marks an in-flight /process request as done
+func endProcessing() {
+	jobProcessingWaitGroup.Done()
+}
+
+// listenForSignals waits for SIGTERM/SIGINT, stops accepting new work, cancels the in-flight benchmarks
+// and waits for them to flush their results before shutting the server down.
+// The exit code matching the signal is sent on exitCode.
+func listenForSignals(cancelFn context.CancelFunc, wg *sync.WaitGroup, server *http.Server, exitCode chan<- int) {
+	signals := make(chan os.Signal, 1)
+	notifySignals(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+
+	code := SigTermExitCode
+	if sig == syscall.SIGINT {
+		code = SigIntExitCode
+	}
+	engineLogger.Infof("Received %s, shutting down...", sig)
+
+	shutdownMutex.Lock()
+	draining = true
+	shutdownMutex.Unlock()
+	cancelFn()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		engineLogger.Infof("All in-flight benchmarks flushed their results")
+	case <-time.After(shutdownGracePeriod):
+		engineLogger.Warnf("In-flight benchmarks did not finish within %s", shutdownGracePeriod)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := server.Shutdown(ctx); err != nil {
+		engineLogger.Warnf("Failed to shut down the server cleanly: %s", err)
+	}
+	cancel()
+	exitCode <- code
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testSignals replace the signal notifications with a channel the test sends the signals on
+func testSignals() (<-chan chan<- os.Signal, func()) {
+	notify := notifySignals
+	registered := make(chan chan<- os.Signal, 1)
+	notifySignals = func(c chan<- os.Signal, sigs ...os.Signal) { registered <- c }
+	return registered, func() {
+		notifySignals = notify
+		shutdownMutex.Lock()
+		draining = false
+		shutdownMutex.Unlock()
+	}
+}
+
+func TestListenForSignalsDrainsCancelsAndFlushes(t *testing.T) {
+	registered, restore := testSignals()
+	defer restore()
+
+	// a benchmark in flight
+	if !beginProcessing() {
+		t.Fatal("beginProcessing() = false before any signal")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	exitCode := make(chan int, 1)
+	go listenForSignals(cancel, &jobProcessingWaitGroup, &http.Server{}, exitCode)
+	(<-registered) <- syscall.SIGTERM
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the in-flight benchmarks were not cancelled")
+	}
+	if beginProcessing() {
+		endProcessing()
+		t.Error("beginProcessing() = true while draining")
+	}
+	recorder := httptest.NewRecorder()
+	handleProcess(recorder, httptest.NewRequest(http.MethodPost, "/process", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("/process while draining = %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+
+	// the server is only shut down once the benchmark flushed its results
+	select {
+	case code := <-exitCode:
+		t.Fatalf("exited with %d before the benchmark ended", code)
+	case <-time.After(50 * time.Millisecond):
+	}
+	endProcessing()
+	select {
+	case code := <-exitCode:
+		if code != SigTermExitCode {
+			t.Errorf("exit code = %d, want %d", code, SigTermExitCode)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no exit code once the benchmark ended")
+	}
+}
+
+func TestListenForSignalsExitCodes(t *testing.T) {
+	tests := []struct {
+		signal os.Signal
+		want   int
+	}{
+		{syscall.SIGTERM, 143},
+		{syscall.SIGINT, 130},
+	}
+	for _, test := range tests {
+		t.Run(test.signal.String(), func(t *testing.T) {
+			registered, restore := testSignals()
+			defer restore()
+
+			exitCode := make(chan int, 1)
+			go listenForSignals(func() {}, &sync.WaitGroup{}, &http.Server{}, exitCode)
+			(<-registered) <- test.signal
+			select {
+			case code := <-exitCode:
+				if code != test.want {
+					t.Errorf("exit code = %d, want %d", code, test.want)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("no exit code")
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// speakerBreakdown the metrics of the words of one reference speaker
+type speakerBreakdown struct {
+	// Speaker the reference speaker, HypothesisSpeaker the hypothesis speaker mapped to it, if any
+	Speaker           string `json:"speaker"`
+	HypothesisSpeaker string `json:"hypothesisSpeaker,omitempty"`
+
+	ReferenceWords int `json:"referenceWords"`
+	Correct        int `json:"correct"`
+	Substituted    int `json:"substituted"`
+	Deleted        int `json:"deleted"`
+	Inserted       int `json:"inserted"`
+	// Misattributed the correct words the hypothesis gave to another speaker
+	Misattributed int `json:"misattributed"`
+
+	WordErrorRate                  float64 `json:"wordErrorRate"`
+	SpeakerAttributedWordErrorRate float64 `json:"speakerAttributedWordErrorRate"`
+}
+
+// speakerMetrics the per-speaker breakdown of an output and its speaker-attributed word error rate,
+// which also counts the words assigned to the wrong speaker as errors
+type speakerMetrics struct {
+	SpeakerAttributedWordErrorRate float64            `json:"speakerAttributedWordErrorRate"`
+	Misattributed                  int                `json:"misattributed"`
+	Speakers                       []speakerBreakdown `json:"speakers"`
+}
+
+// newSpeakerMetrics attribute the sclite alignment to the speakers of the baseline and of the output. The output
+// speakers are mapped one to one to the baseline speakers so that the most aligned words share a speaker.
+// It returns nil when either side has no speakers or the alignment does not match their words.
+func newSpeakerMetrics(baseline, asset *api.Asset, alignment []word) *speakerMetrics {
+	if baseline == nil || asset == nil {
+		return nil
+	}
+	speakerOf := func(segment api.TranscriptSegment) string { return segment.SpeakerID }
+	reference, refLabelled := labelledTokens(baseline, speakerOf)
+	hypothesis, hypLabelled := labelledTokens(asset, speakerOf)
+	if !refLabelled || !hypLabelled {
+		return nil
+	}
+	pairs := pairAlignment(reference, hypothesis, alignment)
+	if pairs == nil {
+		return nil
+	}
+
+	// count how many words each pair of speakers share, then map them
+	refSpeakers, hypSpeakers := indexLabels(reference), indexLabels(hypothesis)
+	cooccurrences := make([][]int, len(refSpeakers))
+	for i := range cooccurrences {
+		cooccurrences[i] = make([]int, len(hypSpeakers))
+	}
+	for _, pair := range pairs {
+		if pair.ref >= 0 && pair.hyp >= 0 {
+			cooccurrences[refSpeakers[reference[pair.ref].label]][hypSpeakers[hypothesis[pair.hyp].label]]++
+		}
+	}
+	assignment := maxAssignment(cooccurrences)
+
+	breakdowns := make([]speakerBreakdown, len(refSpeakers))
+	for speaker, i := range refSpeakers {
+		breakdowns[i].Speaker = speaker
+	}
+	// the reference speaker of each hypothesis speaker, -1 when unmapped
+	hypToRef := make([]int, len(hypSpeakers))
+	for j := range hypToRef {
+		hypToRef[j] = -1
+	}
+	for i, j := range assignment {
+		if j >= 0 {
+			hypToRef[j] = i
+		}
+	}
+	for speaker, j := range hypSpeakers {
+		if i := hypToRef[j]; i >= 0 {
+			breakdowns[i].HypothesisSpeaker = speaker
+		}
+	}
+
+	metrics := &speakerMetrics{}
+	var insertedUnmapped int
+	for _, pair := range pairs {
+		if pair.ref < 0 {
+			// an insertion counts against the speaker its hypothesis speaker is mapped to
+			if i := hypToRef[hypSpeakers[hypothesis[pair.hyp].label]]; i >= 0 {
+				breakdowns[i].Inserted++
+			} else {
+				insertedUnmapped++
+			}
+			continue
+		}
+		breakdown := &breakdowns[refSpeakers[reference[pair.ref].label]]
+		breakdown.ReferenceWords++
+		switch pair.action {
+		case "C":
+			breakdown.Correct++
+			if hypToRef[hypSpeakers[hypothesis[pair.hyp].label]] != refSpeakers[reference[pair.ref].label] {
+				breakdown.Misattributed++
+			}
+		case "S":
+			breakdown.Substituted++
+		case "D":
+			breakdown.Deleted++
+		}
+	}
+
+	var errors, referenceWords int
+	for i := range breakdowns {
+		breakdown := &breakdowns[i]
+		wordErrors := breakdown.Substituted + breakdown.Deleted + breakdown.Inserted
+		if breakdown.ReferenceWords > 0 {
+			breakdown.WordErrorRate = float64(wordErrors) / float64(breakdown.ReferenceWords)
+			breakdown.SpeakerAttributedWordErrorRate = float64(wordErrors+breakdown.Misattributed) / float64(breakdown.ReferenceWords)
+		}
+		metrics.Misattributed += breakdown.Misattributed
+		errors += wordErrors + breakdown.Misattributed
+		referenceWords += breakdown.ReferenceWords
+	}
+	if referenceWords > 0 {
+		metrics.SpeakerAttributedWordErrorRate = float64(errors+insertedUnmapped) / float64(referenceWords)
+	}
+	sort.Slice(breakdowns, func(i, j int) bool { return breakdowns[i].Speaker < breakdowns[j].Speaker })
+	metrics.Speakers = breakdowns
+	return metrics
+}
+
+// maxAssignment the one to one assignment of rows to columns maximizing the sum of the weights (Hungarian algorithm).
+// It returns the column of each row, -1 for the rows left unassigned when there are more rows than columns.
+func maxAssignment(weights [][]int) []int {
+	rows := len(weights)
+	if rows == 0 {
+		return nil
+	}
+	cols := len(weights[0])
+	n := maxInt(rows, cols)
+
+	// minimize the cost of a square matrix, the padding costs the same for every assignment
+	var maxWeight int
+	for _, row := range weights {
+		for _, w := range row {
+			maxWeight = maxInt(maxWeight, w)
+		}
+	}
+	cost := func(i, j int) float64 {
+		if i < rows && j < cols {
+			return float64(maxWeight - weights[i][j])
+		}
+		return float64(maxWeight)
+	}
+
+	// potentials and matching, 1-indexed with 0 as the virtual row of the augmenting paths
+	u, v := make([]float64, n+1), make([]float64, n+1)
+	matchedRow, way := make([]int, n+1), make([]int, n+1)
+	for i := 1; i <= n; i++ {
+		matchedRow[0] = i
+		j0 := 0
+		minv := make([]float64, n+1)
+		used := make([]bool, n+1)
+		for j := range minv {
+			minv[j] = math.Inf(1)
+		}
+		for matchedRow[j0] != 0 {
+			used[j0] = true
+			i0, delta, j1 := matchedRow[j0], math.Inf(1), 0
+			for j := 1; j <= n; j++ {
+				if used[j] {
+					continue
+				}
+				if cur := cost(i0-1, j-1) - u[i0] - v[j]; cur < minv[j] {
+					minv[j], way[j] = cur, j0
+				}
+				if minv[j] < delta {
+					delta, j1 = minv[j], j
+				}
+			}
+			for j := 0; j <= n; j++ {
+				if used[j] {
+					u[matchedRow[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+		}
+		for j0 != 0 {
+			j1 := way[j0]
+			matchedRow[j0] = matchedRow[j1]
+			j0 = j1
+		}
+	}
+
+	assignment := make([]int, rows)
+	for i := range assignment {
+		assignment[i] = -1
+	}
+	for j := 1; j <= n; j++ {
+		if i := matchedRow[j] - 1; i < rows && j-1 < cols {
+			assignment[i] = j - 1
+		}
+	}
+	return assignment
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// testSegment a segment of a transcript, its words separated by spaces
+type testSegment struct {
+	speaker, language       string
+	startTimeMs, stopTimeMs int32
+	text                    string
+}
+
+// testTranscript an asset with a segment per test segment, its words sharing the times of their segment
+func testTranscript(segments ...testSegment) *api.Asset {
+	asset := &api.Asset{}
+	var texts []string
+	for _, s := range segments {
+		segment := api.TranscriptSegment{StartTimeMs: s.startTimeMs, StopTimeMs: s.stopTimeMs, SpeakerID: s.speaker, Language: s.language, FirstWord: len(asset.Words)}
+		for _, w := range strings.Fields(s.text) {
+			asset.Words = append(asset.Words, api.TranscriptWord{Word: w, StartTimeMs: s.startTimeMs, StopTimeMs: s.stopTimeMs})
+			segment.WordCount++
+		}
+		asset.Segments = append(asset.Segments, segment)
+		texts = append(texts, s.text)
+	}
+	asset.Transcript = strings.Join(texts, " ")
+	return asset
+}
+
+// testAlignment an sclite alignment from its steps: "C word", "S reference hypothesis", "D reference" or "I hypothesis"
+func testAlignment(steps ...string) []word {
+	alignment := make([]word, len(steps))
+	for i, step := range steps {
+		fields := strings.Fields(step)
+		switch fields[0] {
+		case "C":
+			alignment[i] = word{Action: "C", Reference: fields[1], Hypothesis: fields[1]}
+		case "S":
+			alignment[i] = word{Action: "S", Reference: fields[1], Hypothesis: fields[2]}
+		case "D":
+			alignment[i] = word{Action: "D", Reference: fields[1]}
+		case "I":
+			alignment[i] = word{Action: "I", Hypothesis: fields[1]}
+		}
+	}
+	return alignment
+}
+
+func TestMaxAssignment(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights [][]int
+		want    []int
+	}{
+		{"none", nil, nil},
+		// greedily taking the 10 would leave the 1
+		{"square", [][]int{{10, 9}, {9, 1}}, []int{1, 0}},
+		{"more rows than columns", [][]int{{5, 1}, {4, 6}, {3, 2}}, []int{0, 1, -1}},
+		{"more columns than rows", [][]int{{1, 5, 2}, {1, 6, 9}}, []int{1, 2}},
+		{"single column", [][]int{{1}, {3}, {2}}, []int{-1, 0, -1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := maxAssignment(test.weights); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("maxAssignment() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewSpeakerMetrics(t *testing.T) {
+	baseline := testTranscript(
+		testSegment{speaker: "A", text: "hello there"},
+		testSegment{speaker: "B", text: "good morning everyone"},
+	)
+	// X says the first word of B, and Z is mapped to no baseline speaker
+	asset := testTranscript(
+		testSegment{speaker: "X", text: "hello there so good"},
+		testSegment{speaker: "Y", text: "morning everybody"},
+		testSegment{speaker: "Z", text: "um"},
+	)
+	alignment := testAlignment("C hello", "C there", "I so", "C good", "C morning", "S everyone everybody", "I um")
+
+	metrics := newSpeakerMetrics(baseline, asset, alignment)
+	if metrics == nil {
+		t.Fatal("newSpeakerMetrics() = nil")
+	}
+	want := []speakerBreakdown{
+		{Speaker: "A", HypothesisSpeaker: "X", ReferenceWords: 2, Correct: 2, Inserted: 1, WordErrorRate: 0.5, SpeakerAttributedWordErrorRate: 0.5},
+		{Speaker: "B", HypothesisSpeaker: "Y", ReferenceWords: 3, Correct: 2, Substituted: 1, Misattributed: 1, WordErrorRate: 1.0 / 3, SpeakerAttributedWordErrorRate: 2.0 / 3},
+	}
+	if !reflect.DeepEqual(metrics.Speakers, want) {
+		t.Errorf("speakers = %+v, want %+v", metrics.Speakers, want)
+	}
+	if metrics.Misattributed != 1 {
+		t.Errorf("misattributed = %d, want 1", metrics.Misattributed)
+	}
+	// the insertion of Z counts against the whole output only
+	if math.Abs(metrics.SpeakerAttributedWordErrorRate-0.8) > 1e-9 {
+		t.Errorf("speaker-attributed WER = %f, want 0.8", metrics.SpeakerAttributedWordErrorRate)
+	}
+
+	unlabelled := testTranscript(testSegment{text: "hello there good morning everybody"})
+	if newSpeakerMetrics(baseline, unlabelled, testAlignment("C hello", "C there", "C good", "C morning", "S everyone everybody")) != nil {
+		t.Error("metrics of an output without speakers")
+	}
+	if newSpeakerMetrics(baseline, asset, testAlignment("C hello", "C there")) != nil {
+		t.Error("metrics of an alignment not matching the words")
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+const (
+	// the boundary tokens of the subtitle edit rate: end of line and end of block (subtitle)
+	endOfLineToken  = "<eol>"
+	endOfBlockToken = "<eob>"
+
+	// maxSubtitleViolations how many violating subtitles are listed in a benchmark SDO, the others are only counted
+	maxSubtitleViolations = 100
+)
+
+// subtitleRules the constraints a subtitle must meet, the zero values take the common broadcast defaults
+type subtitleRules struct {
+	MaxCharsPerSecond float64 `json:"maxCharsPerSecond"`
+	MaxLineLength     int     `json:"maxLineLength"`
+	MaxLines          int     `json:"maxLines"`
+	MinDurationMs     int32   `json:"minDurationMs"`
+	MaxDurationMs     int32   `json:"maxDurationMs"`
+}
+
+// withDefaults the rules with the defaults for the values that are not set
+func (r subtitleRules) withDefaults() subtitleRules {
+	if r.MaxCharsPerSecond <= 0 {
+		r.MaxCharsPerSecond = 17
+	}
+	if r.MaxLineLength <= 0 {
+		r.MaxLineLength = 42
+	}
+	if r.MaxLines <= 0 {
+		r.MaxLines = 2
+	}
+	if r.MinDurationMs <= 0 {
+		r.MinDurationMs = 833
+	}
+	if r.MaxDurationMs <= 0 {
+		r.MaxDurationMs = 7000
+	}
+	return r
+}
+
+// subtitleViolation a subtitle of the output breaking at least one rule
+type subtitleViolation struct {
+	StartTimeMs    int32    `json:"startTimeMs"`
+	StopTimeMs     int32    `json:"stopTimeMs"`
+	CharsPerSecond float64  `json:"charsPerSecond"`
+	Lines          int      `json:"lines"`
+	MaxLineLength  int      `json:"maxLineLength"`
+	Rules          []string `json:"rules"`
+}
+
+// subtitleMetrics the subtitle quality of an output: an edit rate counting the line and subtitle boundaries
+// as words, and its subtitles breaking the reading speed, line and duration rules
+type subtitleMetrics struct {
+	Rules subtitleRules `json:"rules"`
+	// SubtitleEditRate the word edit distance including the boundary tokens, over the reference words and boundaries
+	SubtitleEditRate   float64 `json:"subtitleEditRate"`
+	Subtitles          int     `json:"subtitles"`
+	MeanCharsPerSecond float64 `json:"meanCharsPerSecond"`
+
+	ReadingSpeedViolations int `json:"readingSpeedViolations"`
+	LineLengthViolations   int `json:"lineLengthViolations"`
+	LineCountViolations    int `json:"lineCountViolations"`
+	MinDurationViolations  int `json:"minDurationViolations"`
+	MaxDurationViolations  int `json:"maxDurationViolations"`
+	// Violations the first subtitles breaking a rule
+	Violations []subtitleViolation `json:"violations,omitempty"`
+}
+
+// segmentText the text of the segment, its lines separated by the line breaks of its words
+func segmentText(asset *api.Asset, segment api.TranscriptSegment) string {
+	var text strings.Builder
+	for _, w := range asset.Words[segment.FirstWord : segment.FirstWord+segment.WordCount] {
+		// punctuation sticks to the previous word, like in the transcript
+		if text.Len() > 0 && strings.Trim(w.Word, punctuation) != "" {
+			text.WriteByte(' ')
+		}
+		text.WriteString(w.Word)
+	}
+	return text.String()
+}
+
+// subtitleLines the lines of the subtitle text. Without explicit line breaks the text is wrapped at the maximum line length.
+func subtitleLines(text string, maxLineLength int) []string {
+	if strings.Contains(text, "\n") {
+		var lines []string
+		for _, line := range strings.Split(text, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	}
+
+	var lines []string
+	var line string
+	for _, field := range strings.Fields(text) {
+		if line != "" && utf8.RuneCountInString(line)+1+utf8.RuneCountInString(field) > maxLineLength {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += field
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// subtitleTokens the sanitized words of the asset with a token at the end of each line and of each subtitle
+func subtitleTokens(asset *api.Asset, maxLineLength int) []string {
+	var tokens []string
+	for _, segment := range asset.Segments {
+		if segment.WordCount == 0 {
+			continue
+		}
+		lines := subtitleLines(segmentText(asset, segment), maxLineLength)
+		for i, line := range lines {
+			tokens = append(tokens, strings.Fields(sanitize(line))...)
+			if i < len(lines)-1 {
+				tokens = append(tokens, endOfLineToken)
+			}
+		}
+		tokens = append(tokens, endOfBlockToken)
+	}
+	return tokens
+}
+
+// newSubtitleMetrics check the subtitles of the output against the rules and compute their edit rate against the baseline
+func newSubtitleMetrics(baseline, asset *api.Asset, rules subtitleRules) *subtitleMetrics {
+	if baseline == nil || asset == nil {
+		return nil
+	}
+	rules = rules.withDefaults()
+	metrics := &subtitleMetrics{Rules: rules}
+
+	reference := subtitleTokens(baseline, rules.MaxLineLength)
+	if len(reference) > 0 {
+		hypothesis := subtitleTokens(asset, rules.MaxLineLength)
+		metrics.SubtitleEditRate = float64(bandedEditDistance(reference, hypothesis)) / float64(len(reference))
+	}
+
+	var totalCharsPerSecond float64
+	for _, segment := range asset.Segments {
+		if segment.WordCount == 0 {
+			continue
+		}
+		metrics.Subtitles++
+		text := segmentText(asset, segment)
+		lines := subtitleLines(text, rules.MaxLineLength)
+		durationMs := segment.StopTimeMs - segment.StartTimeMs
+
+		violation := subtitleViolation{StartTimeMs: segment.StartTimeMs, StopTimeMs: segment.StopTimeMs, Lines: len(lines)}
+		var chars int
+		for _, line := range lines {
+			length := utf8.RuneCountInString(line)
+			chars += length
+			if length > violation.MaxLineLength {
+				violation.MaxLineLength = length
+			}
+		}
+		if durationMs > 0 {
+			violation.CharsPerSecond = float64(chars) / (float64(durationMs) / 1000)
+			totalCharsPerSecond += violation.CharsPerSecond
+		}
+
+		if durationMs <= 0 || violation.CharsPerSecond > rules.MaxCharsPerSecond {
+			metrics.ReadingSpeedViolations++
+			violation.Rules = append(violation.Rules, "maxCharsPerSecond")
+		}
+		if violation.MaxLineLength > rules.MaxLineLength {
+			metrics.LineLengthViolations++
+			violation.Rules = append(violation.Rules, "maxLineLength")
+		}
+		if len(lines) > rules.MaxLines {
+			metrics.LineCountViolations++
+			violation.Rules = append(violation.Rules, "maxLines")
+		}
+		if durationMs < rules.MinDurationMs {
+			metrics.MinDurationViolations++
+			violation.Rules = append(violation.Rules, "minDurationMs")
+		}
+		if durationMs > rules.MaxDurationMs {
+			metrics.MaxDurationViolations++
+			violation.Rules = append(violation.Rules, "maxDurationMs")
+		}
+		if len(violation.Rules) > 0 && len(metrics.Violations) < maxSubtitleViolations {
+			metrics.Violations = append(metrics.Violations, violation)
+		}
+	}
+	if metrics.Subtitles > 0 {
+		metrics.MeanCharsPerSecond = totalCharsPerSecond / float64(metrics.Subtitles)
+	}
+	return metrics
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// testSubtitle a subtitle of the given text and times, "\n" breaking its lines
+type testSubtitle struct {
+	startTimeMs, stopTimeMs int32
+	text                    string
+}
+
+func testSubtitles(subtitles ...testSubtitle) *api.Asset {
+	asset := &api.Asset{}
+	for _, subtitle := range subtitles {
+		segment := api.TranscriptSegment{StartTimeMs: subtitle.startTimeMs, StopTimeMs: subtitle.stopTimeMs, FirstWord: len(asset.Words)}
+		for i, line := range strings.Split(subtitle.text, "\n") {
+			if i > 0 {
+				asset.Words = append(asset.Words, api.TranscriptWord{Word: "\n"})
+			}
+			for _, field := range strings.Fields(line) {
+				asset.Words = append(asset.Words, api.TranscriptWord{Word: field})
+			}
+		}
+		segment.WordCount = len(asset.Words) - segment.FirstWord
+		asset.Segments = append(asset.Segments, segment)
+	}
+	return asset
+}
+
+func TestSubtitleRulesWithDefaults(t *testing.T) {
+	defaults := subtitleRules{}.withDefaults()
+	if defaults != (subtitleRules{MaxCharsPerSecond: 17, MaxLineLength: 42, MaxLines: 2, MinDurationMs: 833, MaxDurationMs: 7000}) {
+		t.Errorf("withDefaults() = %+v", defaults)
+	}
+	rules := subtitleRules{MaxCharsPerSecond: 20, MaxLines: 3}.withDefaults()
+	if rules.MaxCharsPerSecond != 20 || rules.MaxLines != 3 || rules.MaxLineLength != 42 {
+		t.Errorf("withDefaults() = %+v, want the rules that are set kept", rules)
+	}
+}
+
+func TestSubtitleLines(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		maxLineLength int
+		want          []string
+	}{
+		{"line breaks", "hello there \n general \n\n kenobi", 5, []string{"hello there", "general", "kenobi"}},
+		{"wrapped", "the quick brown fox jumps", 10, []string{"the quick", "brown fox", "jumps"}},
+		{"a word longer than a line", "incomprehensibilities", 10, []string{"incomprehensibilities"}},
+		{"empty", "", 10, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := subtitleLines(test.text, test.maxLineLength)
+			if strings.Join(got, "|") != strings.Join(test.want, "|") {
+				t.Errorf("subtitleLines() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSubtitleEditRate(t *testing.T) {
+	baseline := testSubtitles(testSubtitle{0, 2000, "Hello world"}, testSubtitle{2000, 4000, "good\nmorning"})
+	tests := []struct {
+		name   string
+		output *api.Asset
+		want   float64
+	}{
+		{"identical", testSubtitles(testSubtitle{0, 2000, "Hello world"}, testSubtitle{2000, 4000, "good\nmorning"}), 0},
+		// like the word error rate next to it
+		{"case is ignored", testSubtitles(testSubtitle{0, 2000, "hello WORLD"}, testSubtitle{2000, 4000, "Good\nMorning"}), 0},
+		// the reference has 4 words, 1 line break and 2 subtitle ends
+		{"missing line break", testSubtitles(testSubtitle{0, 2000, "Hello world"}, testSubtitle{2000, 4000, "good morning"}), 1.0 / 7},
+		{"merged subtitles", testSubtitles(testSubtitle{0, 4000, "Hello world\ngood\nmorning"}), 1.0 / 7},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metrics := newSubtitleMetrics(baseline, test.output, subtitleRules{})
+			if diff := metrics.SubtitleEditRate - test.want; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("SubtitleEditRate = %f, want %f", metrics.SubtitleEditRate, test.want)
+			}
+		})
+	}
+	if newSubtitleMetrics(nil, baseline, subtitleRules{}) != nil {
+		t.Error("metrics without a baseline")
+	}
+}
+
+func TestSubtitleViolations(t *testing.T) {
+	rules := subtitleRules{MaxCharsPerSecond: 10, MaxLineLength: 12, MaxLines: 2, MinDurationMs: 1000, MaxDurationMs: 5000}
+	tests := []struct {
+		name     string
+		subtitle testSubtitle
+		rules    string
+	}{
+		{"within the rules", testSubtitle{0, 2000, "hello world"}, ""},
+		// wrapped at the maximum line length
+		{"too fast", testSubtitle{0, 1000, "hello there world"}, "maxCharsPerSecond"},
+		{"line too long", testSubtitle{0, 4000, "hello\nincomprehensible"}, "maxLineLength"},
+		{"too many lines", testSubtitle{0, 4000, "one\ntwo\nthree"}, "maxLines"},
+		{"too short", testSubtitle{0, 500, "hi"}, "minDurationMs"},
+		{"too long", testSubtitle{0, 6000, "hello"}, "maxDurationMs"},
+		{"no duration", testSubtitle{1000, 1000, "hello"}, "maxCharsPerSecond,minDurationMs"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			asset := testSubtitles(test.subtitle)
+			metrics := newSubtitleMetrics(asset, asset, rules)
+			var got string
+			if len(metrics.Violations) > 0 {
+				got = strings.Join(metrics.Violations[0].Rules, ",")
+			}
+			if got != test.rules {
+				t.Errorf("violated %q, want %q", got, test.rules)
+			}
+			counts := metrics.ReadingSpeedViolations + metrics.LineLengthViolations + metrics.LineCountViolations + metrics.MinDurationViolations + metrics.MaxDurationViolations
+			if want := len(strings.Split(test.rules, ",")); test.rules != "" && counts != want {
+				t.Errorf("%d violations counted, want %d", counts, want)
+			}
+		})
+	}
+}
+
+func TestSubtitleViolationsAreCapped(t *testing.T) {
+	var subtitles []testSubtitle
+	for i := 0; i < maxSubtitleViolations+5; i++ {
+		subtitles = append(subtitles, testSubtitle{int32(i * 1000), int32(i*1000 + 100), "hello"})
+	}
+	metrics := newSubtitleMetrics(testSubtitles(subtitles...), testSubtitles(subtitles...), subtitleRules{})
+	if len(metrics.Violations) != maxSubtitleViolations || metrics.MinDurationViolations != maxSubtitleViolations+5 {
+		t.Errorf("%d violations listed and %d counted, want %d and %d", len(metrics.Violations), metrics.MinDurationViolations, maxSubtitleViolations, maxSubtitleViolations+5)
+	}
+	if metrics.Subtitles != maxSubtitleViolations+5 {
+		t.Errorf("%d subtitles, want %d", metrics.Subtitles, maxSubtitleViolations+5)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// defaultTimingTolerancesMs the tolerances the timing errors are checked against when the payload sets none
+var defaultTimingTolerancesMs = []int{100, 250, 500}
+
+// timingErrorStats the distribution of the timing errors of onsets or offsets, in milliseconds. A positive
+// signed error is late.
+type timingErrorStats struct {
+	MeanAbsoluteMs   float64 `json:"meanAbsoluteMs"`
+	MeanSignedMs     float64 `json:"meanSignedMs"`
+	MedianAbsoluteMs float64 `json:"medianAbsoluteMs"`
+	P90AbsoluteMs    float64 `json:"p90AbsoluteMs"`
+	P95AbsoluteMs    float64 `json:"p95AbsoluteMs"`
+}
+
+// toleranceRate the share of the words or segments whose onset and offset are both within the tolerance
+type toleranceRate struct {
+	ToleranceMs int     `json:"toleranceMs"`
+	Rate        float64 `json:"rate"`
+}
+
+// timingLevel the timing accuracy of the words or of the segments
+type timingLevel struct {
+	Count           int              `json:"count"`
+	Onset           timingErrorStats `json:"onset"`
+	Offset          timingErrorStats `json:"offset"`
+	WithinTolerance []toleranceRate  `json:"withinTolerance"`
+}
+
+// timingMetrics the timing accuracy of an output, measured on the words the alignment found correct
+type timingMetrics struct {
+	Words    *timingLevel `json:"words,omitempty"`
+	Segments *timingLevel `json:"segments,omitempty"`
+}
+
+// timingErrors the onset and offset errors of matched words or segments
+type timingErrors struct {
+	onsets  []int32
+	offsets []int32
+}
+
+func (e *timingErrors) add(ref, hyp labelledToken) {
+	e.onsets = append(e.onsets, hyp.startTimeMs-ref.startTimeMs)
+	e.offsets = append(e.offsets, hyp.stopTimeMs-ref.stopTimeMs)
+}
+
+// level the statistics of the errors, nil without errors
+func (e *timingErrors) level(tolerancesMs []int) *timingLevel {
+	if len(e.onsets) == 0 {
+		return nil
+	}
+	level := &timingLevel{
+		Count:  len(e.onsets),
+		Onset:  newTimingErrorStats(e.onsets),
+		Offset: newTimingErrorStats(e.offsets),
+	}
+	for _, tolerance := range tolerancesMs {
+		var within int
+		for i := range e.onsets {
+			if absInt32(e.onsets[i]) <= int32(tolerance) && absInt32(e.offsets[i]) <= int32(tolerance) {
+				within++
+			}
+		}
+		level.WithinTolerance = append(level.WithinTolerance, toleranceRate{
+			ToleranceMs: tolerance,
+			Rate:        float64(within) / float64(len(e.onsets)),
+		})
+	}
+	return level
+}
+
+func newTimingErrorStats(timingErrors []int32) timingErrorStats {
+	absolute := make([]float64, len(timingErrors))
+	var stats timingErrorStats
+	for i, e := range timingErrors {
+		absolute[i] = math.Abs(float64(e))
+		stats.MeanAbsoluteMs += absolute[i]
+		stats.MeanSignedMs += float64(e)
+	}
+	stats.MeanAbsoluteMs /= float64(len(timingErrors))
+	stats.MeanSignedMs /= float64(len(timingErrors))
+
+	sort.Float64s(absolute)
+	stats.MedianAbsoluteMs = percentile(absolute, 50)
+	stats.P90AbsoluteMs = percentile(absolute, 90)
+	stats.P95AbsoluteMs = percentile(absolute, 95)
+	return stats
+}
+
+// percentile the nearest-rank percentile of the sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func absInt32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// timedSegment the timing of a segment as a token, to reuse the error statistics of the words
+func timedSegment(segment api.TranscriptSegment) labelledToken {
+	return labelledToken{startTimeMs: segment.StartTimeMs, stopTimeMs: segment.StopTimeMs}
+}
+
+// newTimingMetrics measure the timing errors of the words the alignment found correct, and of the segments
+// they belong to: each baseline segment is matched with the output segment sharing most of its correct words.
+// It returns the metrics and the word errors, or nil when the baseline or the output is not timed.
+func newTimingMetrics(baseline, asset *api.Asset, alignment []word, tolerancesMs []int) (*timingMetrics, *timingErrors) {
+	if baseline == nil || asset == nil || !isTimed(baseline) || !isTimed(asset) {
+		return nil, nil
+	}
+	if len(tolerancesMs) == 0 {
+		tolerancesMs = defaultTimingTolerancesMs
+	}
+	noLabel := func(api.TranscriptSegment) string { return "" }
+	reference, _ := labelledTokens(baseline, noLabel)
+	hypothesis, _ := labelledTokens(asset, noLabel)
+	pairs := pairAlignment(reference, hypothesis, alignment)
+	if pairs == nil {
+		return nil, nil
+	}
+
+	words := &timingErrors{}
+	// the correct words each baseline segment shares with each output segment
+	shared := make(map[int]map[int]int)
+	for _, pair := range pairs {
+		if pair.action != "C" {
+			continue
+		}
+		ref, hyp := reference[pair.ref], hypothesis[pair.hyp]
+		words.add(ref, hyp)
+		if shared[ref.segment] == nil {
+			shared[ref.segment] = make(map[int]int)
+		}
+		shared[ref.segment][hyp.segment]++
+	}
+
+	segments := &timingErrors{}
+	for refSegment, hypSegments := range shared {
+		best, bestCount := -1, 0
+		for hypSegment, count := range hypSegments {
+			if count > bestCount || (count == bestCount && hypSegment < best) {
+				best, bestCount = hypSegment, count
+			}
+		}
+		segments.add(timedSegment(baseline.Segments[refSegment]), timedSegment(asset.Segments[best]))
+	}
+
+	metrics := &timingMetrics{Words: words.level(tolerancesMs), Segments: segments.level(tolerancesMs)}
+	return metrics, words
+}
+
+// isTimed whether the segments of the asset have times
+func isTimed(asset *api.Asset) bool {
+	for _, segment := range asset.Segments {
+		if segment.StopTimeMs > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// engineTiming the word timing errors of every asset of an engine in the task
+type engineTiming struct {
+	engineName string
+	words      timingErrors
+}
+
+// timingSummary the word timing accuracy of each engine across the task, for the info message
+func timingSummary(byEngine map[string]*engineTiming, tolerancesMs []int) string {
+	if len(tolerancesMs) == 0 {
+		tolerancesMs = defaultTimingTolerancesMs
+	}
+	engineIDs := make([]string, 0, len(byEngine))
+	for engineID := range byEngine {
+		engineIDs = append(engineIDs, engineID)
+	}
+	sort.Strings(engineIDs)
+
+	parts := make([]string, 0, len(engineIDs))
+	for _, engineID := range engineIDs {
+		timing := byEngine[engineID]
+		level := timing.words.level(tolerancesMs)
+		if level == nil {
+			continue
+		}
+		name := timing.engineName
+		if name == "" {
+			name = engineID
+		}
+		within := make([]string, len(level.WithinTolerance))
+		for i, rate := range level.WithinTolerance {
+			within[i] = fmt.Sprintf("%.1f%% within %d ms", rate.Rate*100, rate.ToleranceMs)
+		}
+		parts = append(parts, fmt.Sprintf("%s median onset error %.0f ms, %s", name, level.Onset.MedianAbsoluteMs, strings.Join(within, ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
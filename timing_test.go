@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+func TestPercentile(t *testing.T) {
+	tens := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	tests := []struct {
+		name   string
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{"median", tens, 50, 5},
+		{"p90", tens, 90, 9},
+		// the nearest rank rounds up, 9.5 is the 10th value
+		{"p95", tens, 95, 10},
+		{"p100", tens, 100, 10},
+		{"p0 is the smallest", tens, 0, 1},
+		{"median of an odd count", []float64{1, 2, 3}, 50, 2},
+		{"single value", []float64{7}, 95, 7},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := percentile(test.sorted, test.p); got != test.want {
+				t.Errorf("percentile(%v) = %v, want %v", test.p, got, test.want)
+			}
+		})
+	}
+}
+
+// testWord a word of a timed transcript
+type testWord struct {
+	text        string
+	startTimeMs int32
+	stopTimeMs  int32
+}
+
+// testTimedTranscript an asset with a segment per list of words, spanning its words
+func testTimedTranscript(segments ...[]testWord) *api.Asset {
+	asset := &api.Asset{}
+	for _, words := range segments {
+		segment := api.TranscriptSegment{FirstWord: len(asset.Words), WordCount: len(words), StartTimeMs: words[0].startTimeMs, StopTimeMs: words[len(words)-1].stopTimeMs}
+		for _, w := range words {
+			asset.Words = append(asset.Words, api.TranscriptWord{Word: w.text, StartTimeMs: w.startTimeMs, StopTimeMs: w.stopTimeMs})
+		}
+		asset.Segments = append(asset.Segments, segment)
+	}
+	return asset
+}
+
+func TestNewTimingMetrics(t *testing.T) {
+	baseline := testTimedTranscript(
+		[]testWord{{"a", 0, 500}, {"b", 500, 1000}},
+		[]testWord{{"c", 2000, 2500}, {"d", 2500, 3000}, {"f", 3000, 3500}},
+	)
+	// c is in the first output segment, but most of the second baseline segment is in the second one
+	asset := testTimedTranscript(
+		[]testWord{{"a", 50, 520}, {"b", 600, 1000}, {"c", 1900, 2300}},
+		[]testWord{{"d", 2800, 3000}, {"f", 3000, 3400}, {"e", 3400, 3600}},
+	)
+	alignment := testAlignment("C a", "C b", "C c", "C d", "C f", "I e")
+
+	metrics, words := newTimingMetrics(baseline, asset, alignment, nil)
+	if metrics == nil {
+		t.Fatal("newTimingMetrics() = nil")
+	}
+	if !reflect.DeepEqual(words.onsets, []int32{50, 100, -100, 300, 0}) || !reflect.DeepEqual(words.offsets, []int32{20, 0, -200, 0, -100}) {
+		t.Errorf("word errors = %v, %v", words.onsets, words.offsets)
+	}
+
+	wantWords := &timingLevel{
+		Count:  5,
+		Onset:  timingErrorStats{MeanAbsoluteMs: 110, MeanSignedMs: 70, MedianAbsoluteMs: 100, P90AbsoluteMs: 300, P95AbsoluteMs: 300},
+		Offset: timingErrorStats{MeanAbsoluteMs: 64, MeanSignedMs: -56, MedianAbsoluteMs: 20, P90AbsoluteMs: 200, P95AbsoluteMs: 200},
+		// both the onset and the offset must be within the tolerance
+		WithinTolerance: []toleranceRate{{100, 0.6}, {250, 0.8}, {500, 1}},
+	}
+	if !reflect.DeepEqual(metrics.Words, wantWords) {
+		t.Errorf("words = %+v, want %+v", metrics.Words, wantWords)
+	}
+
+	// 0-1000 matched with 50-2300, 2000-3500 with 2800-3600
+	wantSegments := &timingLevel{
+		Count:           2,
+		Onset:           timingErrorStats{MeanAbsoluteMs: 425, MeanSignedMs: 425, MedianAbsoluteMs: 50, P90AbsoluteMs: 800, P95AbsoluteMs: 800},
+		Offset:          timingErrorStats{MeanAbsoluteMs: 700, MeanSignedMs: 700, MedianAbsoluteMs: 100, P90AbsoluteMs: 1300, P95AbsoluteMs: 1300},
+		WithinTolerance: []toleranceRate{{100, 0}, {250, 0}, {500, 0}},
+	}
+	if !reflect.DeepEqual(metrics.Segments, wantSegments) {
+		t.Errorf("segments = %+v, want %+v", metrics.Segments, wantSegments)
+	}
+
+	// the tolerances of the payload
+	metrics, _ = newTimingMetrics(baseline, asset, alignment, []int{1000, 2000})
+	if want := []toleranceRate{{1000, 0.5}, {2000, 1}}; !reflect.DeepEqual(metrics.Segments.WithinTolerance, want) {
+		t.Errorf("segments within tolerance = %+v, want %+v", metrics.Segments.WithinTolerance, want)
+	}
+
+	untimed := testTranscript(testSegment{text: "a b c d f e"})
+	if metrics, words := newTimingMetrics(baseline, untimed, alignment, nil); metrics != nil || words != nil {
+		t.Error("metrics of an untimed output")
+	}
+}
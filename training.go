@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// trainingBenchmarkKey the key of the training SDO data the benchmark outcome is written under
+const trainingBenchmarkKey = "benchmark"
+
+// the status of the benchmark written to the training SDO
+const (
+	trainingStatusComplete = "complete"
+	trainingStatusFailed   = "failed"
+)
+
+// modelMetrics the mean metrics of the benchmarked assets of a model
+type modelMetrics struct {
+	ModelID       string  `json:"modelId"`
+	EngineID      string  `json:"engineId"`
+	EngineName    string  `json:"engineName"`
+	Assets        int     `json:"assets"`
+	Accuracy      float64 `json:"accuracy"`
+	Precision     float64 `json:"precision"`
+	Recall        float64 `json:"recall"`
+	WordErrorRate float64 `json:"wordErrorRate"`
+	// BLEU the corpus BLEU of its outputs
+	BLEU float64 `json:"bleu"`
+	// outputs the scores of each of its outputs by asset ID, for the champion/challenger decisions
+	outputs map[string]modelOutput
+}
+
+// trainingBenchmark the benchmark outcome written to the training SDO, for the next stage of the training workflow
+type trainingBenchmark struct {
+	Status          string `json:"status"`
+	FailureMessage  string `json:"failureMessage,omitempty"`
+	BenchmarkJobID  string `json:"benchmarkJobId"`
+	BenchmarkTaskID string `json:"benchmarkTaskId"`
+	UpdatedDateTime string `json:"updatedDateTime"`
+	// CandidateModelID the model the training mode benchmarked
+	CandidateModelID string `json:"candidateModelId,omitempty"`
+	// WinningModelID the model the promotion decisions keep, or the model with the best BLEU without a decision
+	WinningModelID string         `json:"winningModelId,omitempty"`
+	Models         []modelMetrics `json:"models"`
+	// Decisions whether the challenger models replace the champion models
+	Decisions []promotionDecision `json:"decisions,omitempty"`
+	// BenchmarkSDOs the benchmark SDOs of the task, including those of previous attempts
+	BenchmarkSDOs []SDOReference `json:"benchmarkSdos"`
+}
+
+// outputScores the scores of a benchmarked output the model metrics are built from. The fields have the names of
+// the benchmark SDO fields, so that they can be read back from the SDOs of the previous attempts of the task.
+type outputScores struct {
+	EngineID      string     `json:"engineId"`
+	EngineName    string     `json:"engineName,omitempty"`
+	ModelID       string     `json:"modelId,omitempty"`
+	Accuracy      float64    `json:"accuracy"`
+	Precision     float64    `json:"precision"`
+	Recall        float64    `json:"recall"`
+	WordErrorRate float64    `json:"wordErrorRate"`
+	BLEUStats     *bleuStats `json:"bleuStats,omitempty"`
+}
+
+func scoresOf(sdo AssetBenchmarkSDODataForTranscription) outputScores {
+	return outputScores{
+		EngineID:      sdo.EngineID,
+		EngineName:    sdo.EngineName,
+		ModelID:       sdo.ModelID,
+		Accuracy:      sdo.Accuracy,
+		Precision:     sdo.Precision,
+		Recall:        sdo.Recall,
+		WordErrorRate: sdo.WordErrorRate,
+		BLEUStats:     sdo.BLEUStats,
+	}
+}
+
+// addModel add the scores of a benchmarked asset to the metrics of its model, or of its engine without a model
+func (s *benchmarkSummary) addModel(tdoID, assetID string, scores outputScores) {
+	key := modelKey(scores.EngineID, scores.ModelID)
+	model, ok := s.Models[key]
+	if !ok {
+		model = &modelMetrics{ModelID: scores.ModelID, EngineID: scores.EngineID, EngineName: scores.EngineName, outputs: make(map[string]modelOutput)}
+		s.Models[key] = model
+	}
+	model.Assets++
+	model.Accuracy += scores.Accuracy
+	model.Precision += scores.Precision
+	model.Recall += scores.Recall
+	model.WordErrorRate += scores.WordErrorRate
+	output := modelOutput{tdoID: tdoID, wordErrorRate: scores.WordErrorRate}
+	if scores.BLEUStats != nil {
+		output.bleu = *scores.BLEUStats
+	}
+	model.outputs[assetID] = output
+}
+
+// addCheckpointedModels add the outputs that a previous attempt of the task benchmarked to the model metrics
+func (s *benchmarkSummary) addCheckpointedModels(cp *checkpoint) {
+	if cp == nil {
+		return
+	}
+	cp.Lock()
+	defer cp.Unlock()
+	for _, entry := range cp.assets {
+		if entry.Scores != nil {
+			s.addModel(entry.TDOID, entry.AssetID, *entry.Scores)
+		}
+	}
+}
+
+// modelAssets the number of benchmarked assets of the model, whichever its engine
+func (s *benchmarkSummary) modelAssets(modelID string) int {
+	assets := 0
+	for _, model := range s.Models {
+		if model.ModelID == modelID {
+			assets += model.Assets
+		}
+	}
+	return assets
+}
+
+// modelMeans the mean metrics and corpus BLEU of each model, by decreasing BLEU like the rankings
+func (s *benchmarkSummary) modelMeans() []modelMetrics {
+	means := make([]modelMetrics, 0, len(s.Models))
+	for _, model := range s.Models {
+		mean := *model
+		mean.Accuracy /= float64(model.Assets)
+		mean.Precision /= float64(model.Assets)
+		mean.Recall /= float64(model.Assets)
+		mean.WordErrorRate /= float64(model.Assets)
+		mean.BLEU = rankModel(model).BLEU
+		means = append(means, mean)
+	}
+	sort.Slice(means, func(i, j int) bool {
+		if means[i].BLEU != means[j].BLEU {
+			return means[i].BLEU > means[j].BLEU
+		}
+		return modelKey(means[i].EngineID, means[i].ModelID) < modelKey(means[j].EngineID, means[j].ModelID)
+	})
+	return means
+}
+
+// winningModel the model the promotion decisions keep: the first promoted challenger, else the champion. Without a
+// decision, the model with the best BLEU. Only the engine of the candidate counts when there is a candidate.
+func winningModel(means []modelMetrics, decisions []promotionDecision, candidateModelID string) string {
+	candidateEngines := make(map[string]bool)
+	for _, model := range means {
+		if model.ModelID != "" && model.ModelID == candidateModelID {
+			candidateEngines[model.EngineID] = true
+		}
+	}
+	counts := func(engineID string) bool {
+		return len(candidateEngines) == 0 || candidateEngines[engineID]
+	}
+
+	champion := ""
+	for _, decision := range decisions {
+		if !counts(decision.EngineID) {
+			continue
+		}
+		if decision.Decision == decisionPromote {
+			return decision.ChallengerModelID
+		}
+		if champion == "" {
+			champion = decision.ChampionModelID
+		}
+	}
+	if champion != "" {
+		return champion
+	}
+	for _, model := range means {
+		if model.ModelID != "" && counts(model.EngineID) {
+			return model.ModelID
+		}
+	}
+	return ""
+}
+
+// updateTrainingSDO write the outcome of the benchmark, failed when benchErr is set, under the benchmark key of the
+// training SDO of the payload, keeping the rest of its data. It does nothing without a training SDO.
+func updateTrainingSDO(parentCtx context.Context, graphQLClient *api.PlatformGraphQLClient, enginePayload *BenchmarkEnginePayload, benchmarkSchemaID string, summary *benchmarkSummary, cp *checkpoint, benchErr error) error {
+	sdoID, schemaID := enginePayload.TaskPayload.TrainingWorkflowSDOID, enginePayload.TaskPayload.TrainingWorkflowSDOSchemaID
+	if sdoID == "" || schemaID == "" {
+		return nil
+	}
+	// the outcome is written even when a shutdown interrupted the benchmark
+	ctx, cancel := context.WithTimeout(detachedContext(parentCtx), persistTimeout)
+	defer cancel()
+
+	outcome := trainingBenchmark{
+		Status:          trainingStatusComplete,
+		BenchmarkJobID:  enginePayload.JobID,
+		BenchmarkTaskID: enginePayload.TaskID,
+		UpdatedDateTime: time.Now().UTC().Format(time.RFC3339),
+		Models:          []modelMetrics{},
+		BenchmarkSDOs:   []SDOReference{},
+	}
+	if benchErr != nil {
+		outcome.Status = trainingStatusFailed
+		outcome.FailureMessage = scrub(benchErr.Error())
+	}
+	if summary != nil {
+		outcome.CandidateModelID = summary.CandidateModelID
+		outcome.Models = summary.modelMeans()
+		outcome.WinningModelID = winningModel(outcome.Models, summary.Decisions, summary.CandidateModelID)
+		outcome.Decisions = summary.Decisions
+	}
+	if references := cp.sdoReferences(benchmarkSchemaID); len(references) > 0 {
+		outcome.BenchmarkSDOs = references
+	}
+
+	if enginePayload.Test {
+		logFrom(ctx).Infof("This is a test, but the training SDO %s would have been updated with: %s", sdoID, toJSONString(outcome))
+		return nil
+	}
+	sdo, err := graphQLClient.FetchSDO(ctx, sdoID, schemaID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch the training SDO %s", sdoID)
+	}
+	data := map[string]interface{}{}
+	if sdo != nil && sdo.Data != nil {
+		data = sdo.Data
+	}
+	data[trainingBenchmarkKey] = outcome
+	if _, err := graphQLClient.UpdateSDO(ctx, sdoID, schemaID, data); err != nil {
+		return errors.Wrapf(err, "failed to update the training SDO %s", sdoID)
+	}
+	logFrom(ctx).Infof("Updated the training SDO %s with the %s benchmark of %d models", sdoID, outcome.Status, len(outcome.Models))
+	return nil
+}
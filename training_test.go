@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWinningModel(t *testing.T) {
+	means := []modelMetrics{
+		{EngineID: "e1", ModelID: "best", BLEU: 40},
+		{EngineID: "e2", ModelID: "other", BLEU: 35},
+		{EngineID: "e1", ModelID: "candidate", BLEU: 30},
+		{EngineID: "e1", ModelID: "champion", BLEU: 20},
+	}
+	tests := []struct {
+		name      string
+		decisions []promotionDecision
+		candidate string
+		want      string
+	}{
+		{"promoted challenger", []promotionDecision{{EngineID: "e1", ChampionModelID: "champion", ChallengerModelID: "candidate", Decision: decisionPromote}}, "candidate", "candidate"},
+		// the candidate is not promoted although its BLEU is above the champion's
+		{"held challenger", []promotionDecision{{EngineID: "e1", ChampionModelID: "champion", ChallengerModelID: "candidate", Decision: decisionHold}}, "candidate", "champion"},
+		{"rejected challenger", []promotionDecision{{EngineID: "e1", ChampionModelID: "champion", ChallengerModelID: "candidate", Decision: decisionReject}}, "candidate", "champion"},
+		{"first promoted of several", []promotionDecision{
+			{EngineID: "e1", ChampionModelID: "champion", ChallengerModelID: "best", Decision: decisionHold},
+			{EngineID: "e1", ChampionModelID: "champion", ChallengerModelID: "candidate", Decision: decisionPromote},
+		}, "", "candidate"},
+		{"best BLEU without a decision", nil, "", "best"},
+		{"best BLEU of the engine of the candidate", nil, "other", "other"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := winningModel(means, test.decisions, test.candidate); got != test.want {
+				t.Errorf("winningModel() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestModelsRebuiltFromCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a previous attempt scored a1 and wrote a checkpoint line without scores for a3
+	file := filepath.Join(dir, "task.jsonl")
+	previous := &checkpoint{key: "task", file: file, assets: make(map[string]checkpointEntry), baselineAssets: make(map[string]bool)}
+	bleu := newBleuStats(strings.Fields("a b c d"), strings.Fields("a b c d"))
+	entries := []checkpointEntry{
+		{TDOID: "tdo1", AssetID: "a1", SDOID: "s1", Scores: &outputScores{EngineID: "e", ModelID: "m1", WordErrorRate: 0.1, BLEUStats: &bleu}},
+		{TDOID: "tdo1", AssetID: "a3", SDOID: "s3"},
+	}
+	for _, entry := range entries {
+		if err := previous.markDone(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cp := &checkpoint{key: "task", file: file, assets: make(map[string]checkpointEntry), baselineAssets: make(map[string]bool)}
+	if err := cp.loadFromFile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	summary := &benchmarkSummary{Models: make(map[string]*modelMetrics)}
+	summary.addCheckpointedModels(cp)
+	// this attempt scores a2 with the same model
+	summary.addModel("tdo2", "a2", outputScores{EngineID: "e", ModelID: "m1", WordErrorRate: 0.3})
+
+	model := summary.Models[modelKey("e", "m1")]
+	if model == nil {
+		t.Fatal("the model of the previous attempt is missing")
+	}
+	if model.Assets != 2 || len(model.outputs) != 2 {
+		t.Errorf("the model has %d assets and %d outputs, want 2", model.Assets, len(model.outputs))
+	}
+	means := summary.modelMeans()
+	if len(means) != 1 || means[0].WordErrorRate < 0.2-1e-9 || means[0].WordErrorRate > 0.2+1e-9 {
+		t.Errorf("means = %+v, want a mean word error rate of 0.2", means)
+	}
+	if means[0].BLEU <= 0 {
+		t.Errorf("corpus BLEU = %f, want the BLEU of the previous attempt", means[0].BLEU)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/veritone/translation-benchmark/api"
+)
+
+// punctuation the characters of a word attached to the previous word instead of separated by a space
+const punctuation = "!?.,:;"
+
+// readVTN stream a VTN-standard engine output, passing each series to onSeries as soon as it is decoded
+// instead of holding all of them in memory. The rest of the output is returned, without its series.
+func readVTN(r io.Reader, onSeries func(api.Series) error) (*api.EngineOutput, error) {
+	decoder := json.NewDecoder(r)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return nil, err
+	}
+
+	output := &api.EngineOutput{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := token.(string)
+		// keys are matched case-insensitively, like json.Unmarshal does
+		switch strings.ToLower(key) {
+		case "series":
+			err = readVTNSeries(decoder, onSeries)
+		case "taskid":
+			err = decoder.Decode(&output.TaskID)
+		case "generateddateutc":
+			err = decoder.Decode(&output.GeneratedDateUTC)
+		case "language":
+			err = decoder.Decode(&output.Language)
+		case "tags":
+			err = decoder.Decode(&output.Tags)
+		default:
+			var skipped json.RawMessage
+			err = decoder.Decode(&skipped)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %q", key)
+		}
+	}
+	return output, expectDelim(decoder, '}')
+}
+
+// readVTNSeries decode the series array one series at a time
+func readVTNSeries(decoder *json.Decoder, onSeries func(api.Series) error) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return errors.Errorf("expected an array, got %v", token)
+	}
+	for decoder.More() {
+		var serie api.Series
+		if err := decoder.Decode(&serie); err != nil {
+			return err
+		}
+		if err := onSeries(serie); err != nil {
+			return err
+		}
+	}
+	return expectDelim(decoder, ']')
+}
+
+func expectDelim(decoder *json.Decoder, expected json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != expected {
+		return errors.Errorf("expected %q, got %v", expected, token)
+	}
+	return nil
+}
+
+// transcriptBuilder builds the transcript, its words and its segments in linear time as the series are read.
+// The series of an output form a lattice: the words of a series are alternatives, and a word spanning
+// utteranceLength series replaces the words of the following series. Only the best path makes the transcript.
+type transcriptBuilder struct {
+	text     strings.Builder
+	words    []api.TranscriptWord
+	segments []api.TranscriptSegment
+
+	lattice         []api.LatticeWord
+	hasAlternatives bool
+	// slot the index of the next series, coveredUntil the first series not spanned by the last best-path word
+	slot         int
+	coveredUntil int
+}
+
+// addSeries add the best-path word of the series as one segment, or extend the previous segment when its word spans this series
+func (b *transcriptBuilder) addSeries(serie api.Series) error {
+	slot := b.slot
+	b.slot++
+	b.addAlternatives(slot, serie.Words)
+
+	if slot < b.coveredUntil {
+		if n := len(b.segments); n > 0 {
+			b.segments[n-1].StopTimeMs = serie.StopTimeMs
+			if b.segments[n-1].WordCount > 0 {
+				b.words[len(b.words)-1].StopTimeMs = serie.StopTimeMs
+			}
+		}
+		return nil
+	}
+
+	segment := api.TranscriptSegment{
+		StartTimeMs: serie.StartTimeMs,
+		StopTimeMs:  serie.StopTimeMs,
+		SpeakerID:   serie.SpeakerID,
+		Language:    serie.Language,
+		FirstWord:   len(b.words),
+	}
+	if word, ok := bestPathWord(serie.Words); ok {
+		b.addWord(serie, word)
+		b.coveredUntil = slot + utteranceLength(word)
+	}
+	segment.WordCount = len(b.words) - segment.FirstWord
+	b.segments = append(b.segments, segment)
+	return nil
+}
+
+// addAlternatives record the words of the series in the lattice. The lattice is only buffered from the first series
+// with alternatives, an output without any has a single path, its best path.
+func (b *transcriptBuilder) addAlternatives(slot int, words []api.Word) {
+	if !b.hasAlternatives {
+		if len(words) < 2 {
+			return
+		}
+		b.hasAlternatives = true
+		b.backfillLattice(slot)
+	}
+	for _, word := range words {
+		b.lattice = append(b.lattice, api.LatticeWord{
+			Word:            word.Word,
+			Confidence:      word.Confidence,
+			BestPath:        word.BestPath,
+			Slot:            slot,
+			UtteranceLength: utteranceLength(word),
+		})
+	}
+}
+
+// backfillLattice record the series before the first alternatives, whose only path is the best path, as one word
+// made of the best-path words so far, spanning these series up to the end of the last best-path word
+func (b *transcriptBuilder) backfillLattice(slot int) {
+	end := slot
+	if b.coveredUntil > end {
+		end = b.coveredUntil
+	}
+	if end == 0 {
+		return
+	}
+	texts := make([]string, len(b.words))
+	for i, word := range b.words {
+		texts[i] = word.Word
+	}
+	b.lattice = append(b.lattice, api.LatticeWord{
+		Word:            strings.Join(texts, " "),
+		BestPath:        true,
+		Slot:            0,
+		UtteranceLength: end,
+	})
+}
+
+func (b *transcriptBuilder) addWord(serie api.Series, word api.Word) {
+	text := strings.TrimSpace(word.Word)
+	if text == "" {
+		return
+	}
+	// punctuation sticks to the previous word
+	if b.text.Len() > 0 && strings.Trim(text, punctuation) != "" {
+		b.text.WriteByte(' ')
+	}
+	b.text.WriteString(text)
+	b.words = append(b.words, api.TranscriptWord{
+		Word:        text,
+		Confidence:  word.Confidence,
+		StartTimeMs: serie.StartTimeMs,
+		StopTimeMs:  serie.StopTimeMs,
+	})
+}
+
+// compile store the built transcript on the asset. The segments without a language have the language of the output.
+func (b *transcriptBuilder) compile(asset *api.Asset) {
+	if asset.Data != nil && asset.Data.Language != "" {
+		for i := range b.segments {
+			if b.segments[i].Language == "" {
+				b.segments[i].Language = asset.Data.Language
+			}
+		}
+	}
+	asset.Transcript = b.text.String()
+	asset.Words = b.words
+	asset.Segments = b.segments
+	if b.hasAlternatives {
+		asset.Lattice = b.lattice
+	}
+}
+
+// bestPathWord the word of the series flagged as best path. Without a flag, a lone word is the best path
+// and among alternatives the most confident one is.
+func bestPathWord(words []api.Word) (api.Word, bool) {
+	if len(words) == 0 {
+		return api.Word{}, false
+	}
+	best := 0
+	for i, word := range words {
+		if word.BestPath {
+			return word, true
+		}
+		if word.Confidence > words[best].Confidence {
+			best = i
+		}
+	}
+	return words[best], true
+}
+
+// utteranceLength how many series the word spans, at least its own
+func utteranceLength(word api.Word) int {
+	if word.UtteranceLength < 1 {
+		return 1
+	}
+	return word.UtteranceLength
+}
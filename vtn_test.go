@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/veritone/translation-benchmark/api"
+)
+
+func TestReadVTN(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		transcript string
+		segments   int
+		language   string
+		wantErr    bool
+	}{
+		{
+			name:       "best path words and punctuation",
+			output:     `{"language":"en","series":[{"startTimeMs":0,"stopTimeMs":500,"words":[{"word":"hello","bestPath":true},{"word":"yellow"}]},{"startTimeMs":500,"stopTimeMs":600,"words":[{"word":","}]},{"startTimeMs":600,"stopTimeMs":900,"words":[{"word":"world"}]}]}`,
+			transcript: "hello, world",
+			segments:   3,
+			language:   "en",
+		},
+		{
+			name:       "utterance spanning series",
+			output:     `{"Series":[{"startTimeMs":0,"stopTimeMs":500,"words":[{"word":"new york","utteranceLength":2}]},{"startTimeMs":500,"stopTimeMs":900,"words":[{"word":"york"}]}]}`,
+			transcript: "new york",
+			segments:   1,
+		},
+		{
+			name:       "unknown keys are skipped",
+			output:     `{"schemaId":"s","object":{"a":[1,2]},"series":null,"tags":[{"key":"modelId","value":"m"}]}`,
+			transcript: "",
+		},
+		{name: "not an object", output: `[]`, wantErr: true},
+		{name: "truncated", output: `{"series":[{"words":[{"word":"a"}]}`, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			builder := &transcriptBuilder{}
+			output, err := readVTN(strings.NewReader(test.output), builder.addSeries)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("readVTN() error = %v, want an error %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			asset := &api.Asset{Data: output}
+			builder.compile(asset)
+			if asset.Transcript != test.transcript {
+				t.Errorf("transcript = %q, want %q", asset.Transcript, test.transcript)
+			}
+			if len(asset.Segments) != test.segments {
+				t.Errorf("%d segments, want %d", len(asset.Segments), test.segments)
+			}
+			if output.Language != test.language {
+				t.Errorf("language = %q, want %q", output.Language, test.language)
+			}
+		})
+	}
+}
+
+func TestTranscriptBuilderLattice(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		reference string
+		// entries the lattice words kept, the series before the first alternatives being one word
+		entries      int
+		oracleErrors int
+	}{
+		{
+			name:      "no alternatives",
+			output:    `{"series":[{"words":[{"word":"the"}]},{"words":[{"word":"cat"}]}]}`,
+			reference: "the cat",
+		},
+		{
+			name:         "alternatives after an utterance",
+			output:       `{"series":[{"words":[{"word":"The"}]},{"words":[{"word":"new york","utteranceLength":2}]},{"words":[{"word":"york"}]},{"words":[{"word":"hat","bestPath":true},{"word":"cat"}]},{"words":[{"word":"sat"}]}]}`,
+			reference:    "the new york cat sat",
+			entries:      4,
+			oracleErrors: 0,
+		},
+		{
+			name:         "first alternatives inside an utterance",
+			output:       `{"series":[{"words":[{"word":"new york","utteranceLength":2}]},{"words":[{"word":"yolk","bestPath":true},{"word":"york"}]},{"words":[]},{"words":[{"word":"today"},{"word":"to day"}]}]}`,
+			reference:    "new york to day",
+			entries:      5,
+			oracleErrors: 0,
+		},
+		{
+			name:         "alternatives in the first series",
+			output:       `{"series":[{"words":[{"word":"hat","bestPath":true},{"word":"cat"}]},{"words":[{"word":"sat"}]}]}`,
+			reference:    "the cat sat",
+			entries:      3,
+			oracleErrors: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			builder := &transcriptBuilder{}
+			if _, err := readVTN(strings.NewReader(test.output), builder.addSeries); err != nil {
+				t.Fatal(err)
+			}
+			asset := &api.Asset{}
+			builder.compile(asset)
+			if len(asset.Lattice) != test.entries {
+				t.Fatalf("lattice = %+v, want %d words", asset.Lattice, test.entries)
+			}
+			if test.entries == 0 {
+				return
+			}
+			if errors := oracleErrors(strings.Fields(test.reference), asset.Lattice); errors != test.oracleErrors {
+				t.Errorf("oracleErrors() = %d, want %d", errors, test.oracleErrors)
+			}
+		})
+	}
+}
+
+// BenchmarkReadVTN the time per word should stay flat from 10k to 1M words. An output without alternatives keeps
+// no lattice.
+func BenchmarkReadVTN(b *testing.B) {
+	for _, alternatives := range []bool{false, true} {
+		for _, words := range []int{10000, 100000, 1000000} {
+			output := vtnOutput(words, alternatives)
+			b.Run(fmt.Sprintf("%dwords/alternatives=%v", words, alternatives), func(b *testing.B) {
+				b.SetBytes(int64(len(output)))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					builder := &transcriptBuilder{}
+					if _, err := readVTN(bytes.NewReader(output), builder.addSeries); err != nil {
+						b.Fatal(err)
+					}
+					builder.compile(&api.Asset{})
+				}
+			})
+		}
+	}
+}
+
+// vtnOutput a VTN-standard transcript of the given number of words, a series per word, each with an alternative
+// when alternatives is set
+func vtnOutput(words int, alternatives bool) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"language":"en","series":[`)
+	for i := 0; i < words; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, `{"startTimeMs":%d,"stopTimeMs":%d,"words":[{"word":"word%d","confidence":0.9,"bestPath":true}`, i*300, i*300+300, i%1000)
+		if alternatives {
+			fmt.Fprintf(&buf, `,{"word":"ward%d","confidence":0.1}`, i%1000)
+		}
+		buf.WriteString(`]}`)
+	}
+	buf.WriteString(`]}`)
+	return buf.Bytes()
+}